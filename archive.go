@@ -0,0 +1,214 @@
+package piku
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	zipFileForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			path, err := strval(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			arg := args[1]
+			if op == "zipextract" {
+				dest, err := strval(arg)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+				}
+				written, err := zipExtract(path, dest)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+				}
+				return mkstrlist(written), nil
+			}
+			files, err := strlist(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			n, err := zipCreate(path, files)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			return &Value{kind: KindInt, varval: n}, nil
+		}
+	}
+	defEager("io", "zipcreate", arity{2, 2}, zipFileForm("zipcreate"))
+	defEager("io", "zipextract", arity{2, 2}, zipFileForm("zipextract"))
+	defEager("io", "ziplist", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		path, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("ziplist: %v, line: %d", err, ln)
+		}
+		names, err := zipList(path)
+		if err != nil {
+			return nil, fmt.Errorf("ziplist: %v, line: %d", err, ln)
+		}
+		return mkstrlist(names), nil
+	})
+	gzipForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v := args[0]
+			data, err := bytesval(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			if op == "gzip" {
+				data, err = gzipBytes(data)
+			} else {
+				data, err = gunzipBytes(data)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			return mkbytes(data), nil
+		}
+	}
+	defEager("core", "gzip", arity{1, 1}, gzipForm("gzip"))
+	defEager("core", "gunzip", arity{1, 1}, gzipForm("gunzip"))
+}
+
+// zipCreate writes the given files, and directories recursively, into a new
+// archive at path and returns the number of files stored.
+func zipCreate(path string, files []string) (int, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	zw := zip.NewWriter(out)
+	count := 0
+	add := func(name string, info fs.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		hdr.Method = zip.Deflate
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		count++
+		return err
+	}
+	for _, file := range files {
+		err = filepath.WalkDir(file, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return add(p, info)
+		})
+		if err != nil {
+			break
+		}
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return count, err
+}
+
+// zipExtract unpacks the archive at path below dest and returns the paths
+// written. Entries that would land outside dest are rejected.
+func zipExtract(path, dest string) ([]string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var written []string
+	for _, f := range zr.File {
+		target := filepath.Join(dest, filepath.FromSlash(f.Name))
+		if rel, err := filepath.Rel(dest, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return written, fmt.Errorf("illegal path in archive: %s", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return written, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return written, err
+		}
+		if err := extractFile(f, target); err != nil {
+			return written, err
+		}
+		written = append(written, target)
+	}
+	return written, nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode().Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// zipList returns the names of the entries in the archive at path.
+func zipList(path string) ([]string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names, nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
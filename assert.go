@@ -0,0 +1,54 @@
+package piku
+
+import "fmt"
+
+func init() {
+	assertForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			var ok bool
+			var msg string
+			if op == "assert" {
+				ok, msg, args = truthy(args[0]), describe(args[0])+" is not true", args[1:]
+			} else {
+				ok, msg, args = equal(args[0], args[1]), describe(args[0])+" is not equal to "+describe(args[1]), args[2:]
+			}
+			if len(args) > 0 {
+				s, err := strval(args[0])
+				if err != nil {
+					return nil, fmt.Errorf("%s: message: %v, line: %d", op, err, ln)
+				}
+				msg = s
+			}
+			if err := env.interp.assertion(ok, msg, ln); err != nil {
+				return nil, err
+			}
+			return mknil(), nil
+		}
+	}
+	defEager("core", "assert", arity{1, 2}, assertForm("assert"))
+	defEager("core", "asserteq", arity{2, 3}, assertForm("asserteq"))
+}
+
+// assertTally records the assertions of a piku test run. Without one, the
+// first failing assertion is an error like any other.
+type assertTally struct {
+	passed, failed int
+	failures       []string
+}
+
+// assertion handles the outcome of an assert or asserteq at line ln.
+func (in *Interpreter) assertion(ok bool, msg string, ln int) error {
+	if in != nil && in.asserts != nil {
+		if ok {
+			in.asserts.passed++
+		} else {
+			in.asserts.failed++
+			in.asserts.failures = append(in.asserts.failures, fmt.Sprintf("line %d: %s", ln, msg))
+		}
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	return &scriptError{msg: "assertion failed: " + msg, line: ln}
+}
@@ -0,0 +1,93 @@
+package piku
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LoadFile keeps the parsed form of the larger files it reads in the user
+// cache directory, in the format of piku build, so that a library imported
+// by many programs is parsed once. Entries are keyed by a hash of the
+// source and of the piku executable's path, size and modification time,
+// so neither an edited file nor a rebuilt piku reads a stale one.
+
+// minCachedSource is the size below which parsing a file is quicker than
+// reading its cache entry.
+const minCachedSource = 4096
+
+// astCachePath returns the cache entry for source, or "" if there is no
+// cache directory.
+func astCachePath(source []byte) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00", exe, info.Size(), info.ModTime().UnixNano())
+	h.Write(source)
+	return filepath.Join(dir, "piku", "ast", hex.EncodeToString(h.Sum(nil))+".pic")
+}
+
+// sourceHash returns the sha256 of source in hex.
+func sourceHash(source []byte) string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedAST returns the nodes cached for source, or nil.
+func cachedAST(source []byte) []*Node {
+	if len(source) < minCachedSource {
+		return nil
+	}
+	path := astCachePath(source)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	prog, err := readCompiled(bytes.NewReader(data))
+	if err != nil || prog.Hash != sourceHash(source) {
+		return nil
+	}
+	return prog.Nodes
+}
+
+// cacheAST saves the nodes parsed from source. Failing to is not an error:
+// the file is parsed again next time.
+func cacheAST(source []byte, nodes []*Node) {
+	if len(source) < minCachedSource {
+		return
+	}
+	path := astCachePath(source)
+	if path == "" || os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".ast-")
+	if err != nil {
+		return
+	}
+	err = writeCompiled(f, &compiledProgram{Hash: sourceHash(source), Nodes: nodes})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
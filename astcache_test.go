@@ -0,0 +1,45 @@
+package piku
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestASTCacheKeepsAHashNotTheSource(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	source := []byte(strings.Repeat("[echo [add 1 2]]\n", minCachedSource/10))
+	nodes, diags := parseSource(string(source))
+	if len(diags) > 0 {
+		t.Fatal(diags)
+	}
+	cacheAST(source, nodes)
+	path := astCachePath(source)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := readCompiled(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prog.Source != "" || prog.Hash != sourceHash(source) {
+		t.Errorf("entry has Source %d bytes long and Hash %q", len(prog.Source), prog.Hash)
+	}
+	if got := cachedAST(source); len(got) != len(nodes) {
+		t.Errorf("got %d nodes from the cache, want %d", len(got), len(nodes))
+	}
+	// An entry whose hash does not match is not used.
+	prog.Hash = sourceHash([]byte("other"))
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCompiled(f, prog)
+	f.Close()
+	if got := cachedAST(source); got != nil {
+		t.Error("a mismatched entry was used")
+	}
+}
@@ -0,0 +1,108 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// piku --tokens-json and --ast-json print what the tokenizer and the parser
+// make of a file as JSON instead of running it, for tools that would rather
+// not link the Go code. Offsets are in bytes from the start of the file;
+// lines and columns count from 1, columns in characters. An end position
+// is just past the token or node. Syntax errors are listed rather than
+// stopping the output, with the parts that could be read.
+
+type jsonToken struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Offset int    `json:"offset"`
+	End    int    `json:"end"`
+	Line   int    `json:"line"`
+	Col    int    `json:"col"`
+}
+
+type jsonNode struct {
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	EndLine int    `json:"endLine"`
+	EndCol  int    `json:"endCol"`
+	// Children is set, if only to an empty list, for LIST nodes alone.
+	Children *[]*jsonNode `json:"children,omitempty"`
+}
+
+type jsonDiagnostic struct {
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Message string `json:"message"`
+}
+
+type jsonSyntax struct {
+	File   string           `json:"file"`
+	Tokens *[]jsonToken     `json:"tokens,omitempty"`
+	Nodes  *[]*jsonNode     `json:"nodes,omitempty"`
+	Errors []jsonDiagnostic `json:"errors"`
+}
+
+func toJSONNode(n *Node) *jsonNode {
+	j := &jsonNode{Type: n.Type, Value: n.Value, Start: n.Start, End: n.End,
+		Line: n.Line, Col: n.Col, EndLine: n.EndLine, EndCol: n.EndCol}
+	if n.Type == "LIST" {
+		children := make([]*jsonNode, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = toJSONNode(c)
+		}
+		j.Children = &children
+	}
+	return j
+}
+
+// printSyntaxJSON writes the tokens or the parse tree of each file, or
+// both, as a JSON object to standard output. It fails with exit status 1
+// if any file has syntax errors.
+func printSyntaxJSON(files []string, tokens, ast bool) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	failed := false
+	for _, file := range files {
+		data, err := readSource(file)
+		if err != nil {
+			return err
+		}
+		toks, diags := tokenizeRecover(string(data))
+		out := jsonSyntax{File: file, Errors: []jsonDiagnostic{}}
+		if tokens {
+			list := make([]jsonToken, len(toks))
+			for i, t := range toks {
+				list[i] = jsonToken{Type: t.Type, Value: t.Value, Offset: t.Offset,
+					End: t.Offset + len(t.Value), Line: t.Line, Col: t.Col}
+			}
+			out.Tokens = &list
+		}
+		if ast {
+			nodes, pdiags := parseRecover(toks)
+			diags = append(diags, pdiags...)
+			list := make([]*jsonNode, len(nodes))
+			for i, n := range nodes {
+				list[i] = toJSONNode(n)
+			}
+			out.Nodes = &list
+		}
+		for _, d := range diags {
+			out.Errors = append(out.Errors, jsonDiagnostic{Line: d.Line, Col: d.Col, Message: d.Msg})
+		}
+		failed = failed || len(diags) > 0
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	if failed {
+		return &exitError{code: 1}
+	}
+	return nil
+}
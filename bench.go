@@ -0,0 +1,99 @@
+package piku
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// [bench n expr] evaluates expr n times and returns a dict of how long a
+// run took: the fewest, mean and most milliseconds, and the mean number
+// of heap allocations. piku bench runs a file with a benchLog, which keeps
+// the timings of every bench form as well.
+
+func init() {
+	defSpecial("core", "bench", arity{2, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		nv, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if nv.kind != KindInt {
+			return nil, typeError("number", nv, ln), nil
+		}
+		name := fmt.Sprintf("line %d", ln)
+		if len(node.Children) == 4 {
+			v, err, nenv := eval(node.Children[3], env, ln)
+			if err != nil {
+				return nil, err, nil
+			}
+			env = nenv
+			if name, err = strval(v); err != nil {
+				return nil, fmt.Errorf("bench: name: %v, line: %d", err, ln), nil
+			}
+		}
+		v, err := env.interp.bench(name, nv.varval, node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		return v, nil, env
+	})
+}
+
+// benchResult is the timing of one bench form.
+type benchResult struct {
+	Name string  `json:"name"`
+	Runs int     `json:"runs"`
+	Min  float64 `json:"min_ms"`
+	Avg  float64 `json:"avg_ms"`
+	Max  float64 `json:"max_ms"`
+	// Allocs is the mean number of allocations a run made, counting those
+	// of any other task running at the same time.
+	Allocs float64 `json:"allocs"`
+}
+
+type benchLog struct {
+	results []benchResult
+}
+
+// bench times n evaluations of expr, named name in the log.
+func (in *Interpreter) bench(name string, n int, expr *Node, env *Env, ln int) (*Value, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("bench expects at least 1 run, got %d, line: %d", n, ln)
+	}
+	var min, max, total time.Duration
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	mallocs := mem.Mallocs
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		_, err, nenv := eval(expr, env, ln)
+		d := time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		env = nenv
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		total += d
+	}
+	runtime.ReadMemStats(&mem)
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	r := benchResult{Name: name, Runs: n, Min: ms(min), Avg: ms(total) / float64(n), Max: ms(max),
+		Allocs: float64(mem.Mallocs-mallocs) / float64(n)}
+	if in != nil && in.benches != nil {
+		in.benches.results = append(in.benches.results, r)
+	}
+	return &Value{kind: KindDict, dictval: map[string]Value{
+		"runs":   {kind: KindInt, varval: n},
+		"min":    *mkfloat(r.Min),
+		"avg":    *mkfloat(r.Avg),
+		"max":    *mkfloat(r.Max),
+		"allocs": *mkfloat(r.Allocs),
+	}}, nil
+}
@@ -0,0 +1,49 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// benchCmd implements "piku bench file.pi": it runs the file and reports
+// the timing of each bench form in it, as a table or, for comparing runs
+// across changes, as JSON.
+func benchCmd(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the timings as JSON")
+	var file string
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		file, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" && fs.NArg() == 1 {
+		file = fs.Arg(0)
+	} else if fs.NArg() > 0 || file == "" {
+		return errors.New("usage: piku bench file.pi [--json]")
+	}
+	in := &Interpreter{benches: &benchLog{}}
+	if _, err := runfile(file, newEnv(in)); err != nil {
+		return err
+	}
+	results := in.benches.results
+	if len(results) == 0 {
+		return fmt.Errorf("no bench forms in %s", file)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	fmt.Printf("%-30s %8s %12s %12s %12s %12s\n", "bench", "runs", "min ms", "avg ms", "max ms", "allocs/run")
+	for _, r := range results {
+		fmt.Printf("%-30s %8d %12.4f %12.4f %12.4f %12.1f\n", r.Name, r.Runs, r.Min, r.Avg, r.Max, r.Allocs)
+	}
+	return nil
+}
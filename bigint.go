@@ -0,0 +1,167 @@
+package piku
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Integer arithmetic that would overflow an int promotes its result to a
+// big integer (KindBigInt), so that results stay exact. A
+// big integer is only used for values outside the range of an int: any
+// result that fits is an ordinary integer again, so every integer has one
+// form and equal can compare them by variant. Scripts see both as numbers.
+
+// The integers from minSmallInt up to maxSmallInt, which loop counters,
+// indices and the results of most arithmetic in between are, are made
+// once and shared. Values are never changed in place, so an integer need
+// not be a value of its own, and a loop counting in this range allocates
+// nothing for it.
+const minSmallInt, maxSmallInt = -128, 1024
+
+var smallInts = func() (s [maxSmallInt - minSmallInt]Value) {
+	for i := range s {
+		s[i] = Value{kind: KindInt, varval: i + minSmallInt}
+	}
+	return s
+}()
+
+// mknum returns n as an integer value.
+func mknum(n int) *Value {
+	if n >= minSmallInt && n < maxSmallInt {
+		return &smallInts[n-minSmallInt]
+	}
+	return &Value{kind: KindInt, varval: n}
+}
+
+// mkint returns x as an integer value, big only when it has to be.
+func mkint(x *big.Int) *Value {
+	if x.IsInt64() {
+		if n := x.Int64(); int64(int(n)) == n {
+			return mknum(int(n))
+		}
+	}
+	return &Value{kind: KindBigInt, ref: x}
+}
+
+// isInteger reports whether v is an integer, big or not.
+func isInteger(v *Value) bool {
+	return v != nil && (v.kind == KindInt || v.kind == KindBigInt)
+}
+
+// bigOf returns the integer v as a big.Int.
+func bigOf(v *Value) *big.Int {
+	if v.kind == KindBigInt {
+		return v.big()
+	}
+	return big.NewInt(int64(v.varval))
+}
+
+// bigFloat returns the nearest float to a big integer.
+func bigFloat(x *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(x).Float64()
+	return f
+}
+
+// intArith applies op to two integers, promoting to a big integer when
+// the result does not fit. y is not zero for div and mod.
+func intArith(op string, a, b *Value) *Value {
+	if a.kind == KindInt && b.kind == KindInt {
+		x, y := a.varval, b.varval
+		switch op {
+		case "add":
+			if s := x + y; (s^x)&(s^y) >= 0 {
+				return mknum(s)
+			}
+		case "sub":
+			if d := x - y; (x^y)&(d^x) >= 0 {
+				return mknum(d)
+			}
+		case "mul":
+			if x == 0 || y == 0 {
+				return mknum(0)
+			}
+			if p := x * y; p/y == x && !(x == -1 && y == math.MinInt) && !(y == -1 && x == math.MinInt) {
+				return mknum(p)
+			}
+		case "div":
+			if !(x == math.MinInt && y == -1) {
+				return mknum(x / y)
+			}
+		case "mod":
+			if y == -1 {
+				return mknum(0)
+			}
+			return mknum(x % y)
+		}
+	}
+	x, y, z := bigOf(a), bigOf(b), new(big.Int)
+	switch op {
+	case "add":
+		z.Add(x, y)
+	case "sub":
+		z.Sub(x, y)
+	case "mul":
+		z.Mul(x, y)
+	case "div":
+		z.Quo(x, y)
+	case "mod":
+		z.Rem(x, y)
+	}
+	return mkint(z)
+}
+
+// isZero reports whether the integer v is zero.
+func isZero(v *Value) bool {
+	return v.kind == KindInt && v.varval == 0
+}
+
+// negInt negates an integer.
+func negInt(v *Value) *Value {
+	if v.kind == KindInt && v.varval != math.MinInt {
+		return mknum(-v.varval)
+	}
+	return mkint(new(big.Int).Neg(bigOf(v)))
+}
+
+// parseInt reads an integer literal, as a big integer when it is too large
+// for an int.
+func parseInt(s string) (*Value, error) {
+	x, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %s", s)
+	}
+	return mkint(x), nil
+}
+
+// bitOp applies the bitwise operator op to integers, which behave as in
+// two's complement with as many bits as they need. b is the shift for shl
+// and shr, and ignored by bnot.
+func bitOp(op string, a, b *Value, ln int) (*Value, error) {
+	if !isInteger(a) {
+		return nil, typeError("integer", a, ln)
+	}
+	x, r := bigOf(a), new(big.Int)
+	if op == "bnot" {
+		return mkint(r.Not(x)), nil
+	}
+	if !isInteger(b) {
+		return nil, typeError("integer", b, ln)
+	}
+	y := bigOf(b)
+	switch op {
+	case "band":
+		return mkint(r.And(x, y)), nil
+	case "bor":
+		return mkint(r.Or(x, y)), nil
+	case "bxor":
+		return mkint(r.Xor(x, y)), nil
+	}
+	if y.Sign() < 0 || !y.IsInt64() || (op == "shl" && int64(x.BitLen())+y.Int64() > maxPowBits) {
+		return nil, fmt.Errorf("%s: shift must be between 0 and %d bits, line: %d", op, maxPowBits, ln)
+	}
+	if op == "shl" {
+		return mkint(r.Lsh(x, uint(y.Int64()))), nil
+	}
+	return mkint(r.Rsh(x, uint(y.Int64()))), nil
+}
@@ -0,0 +1,117 @@
+package piku
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Compiled programs are the parsed AST encoded with gob behind a short
+// header, so running them skips tokenizing and parsing.
+const picMagic = "PIKUC1\n"
+
+// A compiled program carries its source map: every node keeps the line
+// and column it was parsed from, and Source names the file, so errors and
+// stack traces from running it point into the source and not the .pic.
+// The optimizer, run on the nodes as they are loaded, keeps the position
+// of each node it leaves and gives a folded constant that of the form it
+// replaces.
+type compiledProgram struct {
+	Source string
+	// Hash is the sha256 of the source text, which the AST cache checks
+	// an entry against; piku build leaves it empty.
+	Hash  string
+	Nodes []*Node
+}
+
+// compiledSources maps each compiled program loaded to its Source.
+var compiledSources sync.Map
+
+// sourceName is the name stack traces give the file filename: the source
+// of a compiled program, or "" for standard input.
+func sourceName(filename string) string {
+	if src, ok := compiledSources.Load(filename); ok {
+		return src.(string)
+	}
+	if filename == "-" {
+		return ""
+	}
+	return filename
+}
+
+func writeCompiled(w io.Writer, prog *compiledProgram) error {
+	if _, err := io.WriteString(w, picMagic); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(prog)
+}
+
+func readCompiled(r io.Reader) (*compiledProgram, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(picMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != picMagic {
+		return nil, errors.New("not a compiled piku program")
+	}
+	prog := &compiledProgram{}
+	if err := gob.NewDecoder(br).Decode(prog); err != nil {
+		return nil, fmt.Errorf("corrupt compiled program: %v", err)
+	}
+	return prog, nil
+}
+
+func loadCompiled(filename string) ([]*Node, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prog, err := readCompiled(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if prog.Source != "" {
+		compiledSources.Store(filename, prog.Source)
+	}
+	return prog.Nodes, nil
+}
+
+// buildCmd implements "piku build file.pi [-o file.pic]".
+func buildCmd(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default: source name with .pic extension)")
+	var src string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		src, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if src == "" && fs.NArg() > 0 {
+		src = fs.Arg(0)
+	}
+	if src == "" {
+		return errors.New("usage: piku build file.pi [-o file.pic]")
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(src, ".pi") + ".pic"
+	}
+	nodes, err := LoadFile(src)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := writeCompiled(f, &compiledProgram{Source: src, Nodes: nodes}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,108 @@
+package piku
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+func init() {
+	defEager("core", "ttlcache", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if !isNumber(v) || floatval(v) <= 0 {
+			return nil, fmt.Errorf("ttlcache expects a positive number of seconds, line: %d", ln)
+		}
+		return &Value{kind: KindHandle, ref: newTTLCache(time.Duration(floatval(v) * float64(time.Second)))}, nil
+	})
+	defEager("core", "cache-get", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h, kv := args[0], args[1]
+		c, err := cachehandle(h, "cache-get", ln)
+		if err != nil {
+			return nil, err
+		}
+		key, err := strval(kv)
+		if err != nil {
+			return nil, fmt.Errorf("cache-get: %v, line: %d", err, ln)
+		}
+		if v, ok := c.get(key); ok {
+			return v, nil
+		}
+		return mknil(), nil
+	})
+	defEager("core", "cache-put", arity{3, 3}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h, kv, v := args[0], args[1], args[2]
+		c, err := cachehandle(h, "cache-put", ln)
+		if err != nil {
+			return nil, err
+		}
+		key, err := strval(kv)
+		if err != nil {
+			return nil, fmt.Errorf("cache-put: %v, line: %d", err, ln)
+		}
+		c.put(key, v)
+		return v, nil
+	})
+}
+
+// ttlCache is the handle value behind ttlcache: a map from strings to
+// values in which each entry expires a fixed time after it was put.
+// Expired entries are dropped when they are next looked up or when a put
+// finds the cache has doubled since it was last swept.
+type ttlCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	swept   int
+}
+
+type cacheEntry struct {
+	val     Value
+	expires time.Time
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+func (c *ttlCache) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("ttlcache %v, size %d", c.ttl, len(c.entries))
+}
+
+func (c *ttlCache) get(key string) (*Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return &e.val, true
+}
+
+func (c *ttlCache) put(key string, v *Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= 2*c.swept+16 {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = len(c.entries)
+	}
+	c.entries[key] = cacheEntry{val: *v, expires: now.Add(c.ttl)}
+}
+
+// cachehandle extracts the cache behind a handle value.
+func cachehandle(v *Value, op string, ln int) (*ttlCache, error) {
+	if c, ok := v.handle().(*ttlCache); ok && v.kind == KindHandle {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%s expects a ttlcache handle, got %s, line: %d", op, typename(v), ln)
+}
@@ -0,0 +1,337 @@
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The checker walks a parsed program without running it and reports
+// mistakes that would otherwise only show up when evaluation reaches them.
+// It is best effort: a name bound anywhere in the program or in a file it
+// imports counts as defined everywhere.
+
+type checker struct {
+	defined map[string]bool
+	macros  map[string]bool
+	load    func(name, sum, dir string) ([]*Node, string, error)
+	loaded  map[string]bool
+	diags   Diagnostics
+	// dir is the directory of the file being collected from.
+	dir string
+}
+
+// checkProgram returns the problems found in nodes, the program in dir.
+// load reads the program named by an import form in a file in dir and
+// returns it with the file it came from.
+func checkProgram(nodes []*Node, dir string, load func(name, sum, dir string) ([]*Node, string, error)) Diagnostics {
+	c := &checker{defined: map[string]bool{}, macros: map[string]bool{}, load: load, loaded: map[string]bool{}, dir: dir}
+	c.collect(nodes)
+	for _, n := range nodes {
+		c.walk(n, nil)
+	}
+	sortDiagnostics(c.diags)
+	return c.diags
+}
+
+func sortDiagnostics(diags Diagnostics) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+	})
+}
+
+func (c *checker) report(n *Node, format string, args ...any) {
+	c.diags = append(c.diags, &Diagnostic{Line: n.Line, Col: n.Col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// collect records every name bound by set, const, setmany, foreach, try
+// or macro in nodes, following imports.
+func (c *checker) collect(nodes []*Node) {
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		if n.Type != "LIST" || len(n.Children) == 0 {
+			return
+		}
+		switch head := n.Children[0]; head.Value {
+		case "set", "const", "foreach", "macro":
+			if len(n.Children) > 1 && n.Children[1].Type == "IDENTIFIER" {
+				c.defined[n.Children[1].Value] = true
+				if head.Value == "macro" {
+					c.macros[n.Children[1].Value] = true
+				}
+			}
+		case "importdata":
+			if len(n.Children) == 3 && n.Children[2].Type == "IDENTIFIER" {
+				c.defined[n.Children[2].Value] = true
+			} else if len(n.Children) == 2 && n.Children[1].Type == "STRING" {
+				c.defined[dataName(n.Children[1].Value)] = true
+			}
+		case "try":
+			if len(n.Children) > 2 && n.Children[2].Type == "IDENTIFIER" {
+				c.defined[n.Children[2].Value] = true
+			}
+		case "setmany":
+			if len(n.Children) > 1 {
+				for _, name := range n.Children[1].Children {
+					c.defined[name.Value] = true
+				}
+			}
+		case "import":
+			if (len(n.Children) == 2 || len(n.Children) == 3) && !c.loaded[n.Children[1].Value] {
+				name, sum := n.Children[1].Value, ""
+				if len(n.Children) == 3 {
+					sum = n.Children[2].Value
+				}
+				c.loaded[name] = true
+				imported, file, err := c.load(name, sum, c.dir)
+				if err != nil {
+					c.report(n, "cannot load import %s: %v", name, err)
+					return
+				}
+				saved := c.dir
+				c.dir = filepath.Dir(file)
+				c.collect(imported)
+				c.dir = saved
+			}
+		}
+		for _, ch := range n.Children {
+			visit(ch)
+		}
+	}
+	for _, n := range nodes {
+		visit(n)
+	}
+}
+
+// walk checks n in a scope holding the parameters of the enclosing
+// functions and macros.
+func (c *checker) walk(n *Node, params map[string]bool) {
+	switch n.Type {
+	case "IDENTIFIER":
+		if !params[n.Value] && !c.defined[n.Value] {
+			c.report(n, "undefined identifier: %s", n.Value)
+		}
+		return
+	case "LIST":
+	default:
+		return
+	}
+	if len(n.Children) == 0 {
+		c.report(n, "empty form")
+		return
+	}
+	head := n.Children[0]
+	if head.Type != "IDENTIFIER" {
+		c.report(head, "form must start with a name")
+		return
+	}
+	if c.macros[head.Value] {
+		// Macro arguments are code passed as data.
+		return
+	}
+	ar, ok := builtinArity(head.Value)
+	if !ok {
+		c.report(head, "unknown form: %s", head.Value)
+		return
+	}
+	args := n.Children[1:]
+	if len(args) < ar.min || (ar.max >= 0 && len(args) > ar.max) {
+		c.report(head, "%s expects %s, got %d", head.Value, ar, len(args))
+		return
+	}
+	switch head.Value {
+	case "quote":
+		return
+	case "set", "const":
+		if args[0].Type != "IDENTIFIER" {
+			c.report(args[0], "%s expects a name", head.Value)
+		}
+		c.walk(args[1], params)
+		return
+	case "help":
+		if args[0].Type != "IDENTIFIER" {
+			c.report(args[0], "help expects a name")
+		}
+		return
+	case "import":
+		if args[0].Type != "IDENTIFIER" && !(args[0].Type == "STRING" && isURL(args[0].Value)) {
+			c.report(args[0], "import expects a name or a URL")
+		}
+		if len(args) == 2 && (args[1].Type != "STRING" || !isURL(args[0].Value)) {
+			c.report(args[1], "import takes a hash string only after a URL")
+		}
+		return
+	case "importdata":
+		if len(args) == 2 && args[1].Type != "IDENTIFIER" {
+			c.report(args[1], "importdata expects a name")
+		} else if len(args) == 1 && args[0].Type == "STRING" && !isIdent(dataName(args[0].Value)) {
+			c.report(args[0], "importdata needs a name for %s", args[0].Value)
+		}
+		c.walk(args[0], params)
+		return
+	case "setmany":
+		c.walk(args[1], params)
+		return
+	case "func", "genfunc", "macro":
+		list, body := args[0], args[len(args)-1]
+		if head.Value == "macro" {
+			list = args[1]
+		} else if len(args) == 3 && args[1].Type != "STRING" {
+			c.report(args[1], "%s expects a documentation string before the body", head.Value)
+		}
+		inner := map[string]bool{}
+		for k := range params {
+			inner[k] = true
+		}
+		for _, p := range list.Children {
+			name, _, def, ok := paramParts(p)
+			if !ok || (head.Value == "macro" && p.Type != "IDENTIFIER") {
+				c.report(p, "invalid parameter")
+				continue
+			}
+			if def != nil {
+				c.walk(def, inner)
+			}
+			inner[name.Value] = true
+		}
+		c.walk(body, inner)
+		return
+	case "default":
+		// default exists to catch an undefined name.
+		if args[0].Type != "IDENTIFIER" {
+			c.walk(args[0], params)
+		}
+		c.walk(args[1], params)
+		return
+	case "if":
+		if v, known := literalTruth(args[0]); known {
+			branch, which := args[2], "else"
+			if !v {
+				branch, which = args[1], "then"
+			}
+			c.report(branch, "unreachable %s branch: the condition is always %v", which, v)
+		}
+	case "call":
+		c.walk(args[0], params)
+		for _, a := range args[1:] {
+			if a.Type == "LIST" && len(a.Children) == 2 && a.Children[0].Type == "IDENTIFIER" && !isBuiltin(a.Children[0].Value) && !c.macros[a.Children[0].Value] {
+				// A named argument.
+				c.walk(a.Children[1], params)
+				continue
+			}
+			c.walk(a, params)
+		}
+		return
+	case "exec":
+		c.walk(args[0], params)
+		c.walk(args[1], params)
+		for _, opt := range args[2:] {
+			if opt.Type != "LIST" || len(opt.Children) != 2 || (opt.Children[0].Value != "timeout" && opt.Children[0].Value != "env") {
+				c.report(opt, "exec options are written [timeout seconds] or [env vars]")
+				continue
+			}
+			c.walk(opt.Children[1], params)
+		}
+		return
+	case "dict":
+		for _, e := range args {
+			if e.Type != "LIST" || len(e.Children) != 2 || (e.Children[0].Type != "IDENTIFIER" && e.Children[0].Type != "STRING") {
+				c.report(e, "dict entries are written [key value]")
+				continue
+			}
+			c.walk(e.Children[1], params)
+		}
+		return
+	case "pipeline":
+		for _, stage := range args {
+			if stage.Type != "LIST" {
+				c.report(stage, "pipeline expects commands written as [cmd args...]")
+				continue
+			}
+			for _, w := range stage.Children {
+				c.walk(w, params)
+			}
+		}
+		return
+	}
+	for _, a := range args {
+		c.walk(a, params)
+	}
+}
+
+// literalTruth reports how if would treat n when n is a literal.
+func literalTruth(n *Node) (bool, bool) {
+	switch n.Type {
+	case "INTEGER", "FLOAT":
+		return !strings.HasPrefix(n.Value, "-") && strings.Trim(n.Value, "0.") != "", true
+	case "STRING":
+		return true, true
+	case "CHAR":
+		return charValue(n).varval > 0, true
+	}
+	return false, false
+}
+
+func (a arity) String() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case a.max < 0:
+		return "at least " + plural(a.min)
+	case a.min == a.max:
+		return plural(a.min)
+	}
+	return fmt.Sprintf("%d to %d arguments", a.min, a.max)
+}
+
+// checkCmd implements "piku check file.pi [--types]".
+func checkCmd(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	types := fs.Bool("types", false, "also infer types and report mismatched arguments")
+	path := fs.String("path", "", "colon-separated directories to look for imports in")
+	var src string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		src, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if src == "" && fs.NArg() > 0 {
+		src = fs.Arg(0)
+	}
+	if src == "" {
+		return errors.New("usage: piku check file.pi [--types]")
+	}
+	importSearch = filepath.SplitList(*path)
+	nodes, err := LoadFile(src)
+	if err != nil {
+		return err
+	}
+	diags := checkProgram(nodes, filepath.Dir(src), func(name, sum, dir string) ([]*Node, string, error) {
+		file, err := importFile(name, sum, dir)
+		if err != nil {
+			return nil, "", err
+		}
+		nodes, err := LoadFile(file)
+		return nodes, file, err
+	})
+	if *types {
+		diags = append(diags, typecheck(nodes)...)
+		sortDiagnostics(diags)
+	}
+	for _, d := range diags {
+		fmt.Printf("%s:%d:%d: %s\n", src, d.Line, d.Col, d.Msg)
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(diags))
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+// Main carries out the command line args of the piku command and returns
+// the exit status.
+func Main(args []string) int {
+	defer cleanupTemps()
+	defer cleanupProcs()
+	var err error
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "lsp":
+		runLSP()
+		return 0
+	case "build":
+		err = buildCmd(args[1:])
+	case "transpile":
+		err = transpileCmd(args[1:])
+	case "check":
+		err = checkCmd(args[1:])
+	case "vet":
+		err = vetCmd(args[1:])
+	case "debug":
+		err = debugCmd(args[1:])
+	case "new":
+		err = newCmd(args[1:])
+	case "stats":
+		err = statsCmd(args[1:])
+	case "grade":
+		err = gradeCmd(args[1:])
+	case "notebook":
+		err = notebookCmd(args[1:])
+	case "upgrade":
+		err = upgradeCmd(args[1:])
+	case "examples":
+		err = examplesCmd(args[1:])
+	case "learn":
+		err = learnCmd(args[1:])
+	case "test":
+		err = testCmd(args[1:])
+	case "selftest":
+		err = selftestCmd(args[1:])
+	case "bench":
+		err = benchCmd(args[1:])
+	case "watch":
+		err = watchCmd(args[1:])
+	case "get":
+		err = getCmd(args[1:])
+	case "run":
+		if len(args) < 2 {
+			err = errors.New("usage: piku run [flags] file.pic")
+			break
+		}
+		err = runCmd(args[1:])
+	default:
+		err = runCmd(args)
+	}
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		// The flags of the command have been printed, as asked.
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("Error %v%s\n", err, traceback(err))
+		// As a shell reports a program killed by the signal.
+		var sig *interruption
+		if errors.As(err, &sig) {
+			return 128 + signalNumbers[sig.signal]
+		}
+		return 1
+	}
+	return 0
+}
+
+// runCmd runs program files in order, or the program on standard input
+// for "-" or when none is given, starting the REPL instead if that is a
+// terminal.
+func runCmd(args []string) (err error) {
+	fs := flag.NewFlagSet("piku", flag.ContinueOnError)
+	in := &Interpreter{}
+	fs.IntVar(&in.MaxSteps, "max-steps", 0, "abort after evaluating this many nodes (0 means no limit)")
+	fs.IntVar(&in.MaxListLen, "max-list", 0, "maximum number of elements in a list (0 means no limit)")
+	fs.BoolVar(&in.Restricted, "restricted", false, "disable import, file access, process and network builtins")
+	disable := fs.String("disable", "", "comma-separated builtins or namespaces of them, such as io or net, to disable")
+	fs.BoolVar(&in.Optimize, "optimize", false, "fold constant forms before running")
+	fs.BoolVar(&in.Immutable, "immutable", false, "make list build persistent lists, which append and edit never change in place")
+	fs.BoolVar(&in.CheckedArithmetic, "checked-arithmetic", false, "fail on integer arithmetic that overflows an int instead of going on with a big integer")
+	fs.IntVar(&in.PrintDepth, "print-depth", 0, "show values this many containers deep when printing them (0 means no limit)")
+	fs.IntVar(&in.PrintWidth, "print-width", 0, "show this many elements of each container when printing values (0 means no limit)")
+	fs.BoolVar(&in.CharLists, "char-lists", false, "show strings as lists of character codes when printing values; echostr still shows text")
+	fs.StringVar(&in.LogLevel, "log-level", "info", "write log lines at this level and above: debug, info, warn or error")
+	timeout := fs.Duration("timeout", 0, "abort evaluation after this long, e.g. 5s (0 means no limit)")
+	visualize := fs.String("visualize", "", "write an HTML page replaying the run step by step to this file")
+	traceMode := fs.Bool("trace", false, "log every form evaluated, with its result, to standard error")
+	profile := fs.Bool("profile", false, "print the time spent in each function and form to standard error at exit")
+	pprofOut := fs.String("pprof", "", "write a profile of the function calls in pprof format to this file")
+	expr := fs.String("e", "", "run this program text instead of a file")
+	loadFrom := fs.String("load-state", "", "start with the variables saved by savestate in this file")
+	debugMode := fs.Bool("debug", false, "open a debugger in the failing scope when the program fails")
+	isolate := fs.Bool("isolate", false, "run each file in a fresh environment instead of sharing one")
+	path := fs.String("path", "", "colon-separated directories to look for imports in")
+	plugins := fs.String("plugin", "", "colon-separated Go plugins to load builtins from")
+	tokensJSON := fs.Bool("tokens-json", false, "print the tokens of the program as JSON instead of running it")
+	astJSON := fs.Bool("ast-json", false, "print the parse tree of the program as JSON instead of running it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkLogLevel(in.LogLevel); err != nil {
+		return err
+	}
+	if *disable != "" {
+		in.Disabled = strings.Split(*disable, ",")
+		for _, d := range in.Disabled {
+			if !isBuiltin(d) && len(builtinNames(d)) == 0 {
+				return fmt.Errorf("--disable: %s is not a builtin or namespace", d)
+			}
+		}
+	}
+	importSearch = filepath.SplitList(*path)
+	for _, p := range filepath.SplitList(*plugins) {
+		if err := in.loadPlugin(p); err != nil {
+			return err
+		}
+	}
+	if *timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		in.Ctx = ctx
+	}
+	fresh := func() (*Env, error) {
+		env := newEnv(in)
+		if *loadFrom != "" {
+			if err := loadState(*loadFrom, env); err != nil {
+				return nil, err
+			}
+		}
+		return env, nil
+	}
+	env, err := fresh()
+	if err != nil {
+		return err
+	}
+	defer in.notifySignals()()
+	// With no file, the program is read from standard input unless that
+	// is a terminal, in which case the REPL starts.
+	files := fs.Args()
+	if *expr != "" {
+		if len(files) > 0 {
+			return errors.New("piku -e takes the program text instead of a file")
+		}
+		// The text stands in for standard input, which is not read.
+		stdinSource, files = []byte(*expr), []string{"-"}
+	}
+	if *tokensJSON || *astJSON {
+		if len(files) == 0 {
+			files = []string{"-"}
+		}
+		return printSyntaxJSON(files, *tokensJSON, *astJSON)
+	}
+	if len(files) == 0 {
+		if isTerminal(int(os.Stdin.Fd())) {
+			return repl(env)
+		}
+		files = []string{"-"}
+	}
+	// file is the file being run, for the crash report.
+	file := files[0]
+	if *visualize != "" {
+		if len(files) > 1 {
+			return errors.New("--visualize replays a single file")
+		}
+		source, err := readSource(file)
+		if err != nil {
+			return err
+		}
+		viz := &visualizer{}
+		in.Hook = viz.record
+		in.Stdout = io.MultiWriter(in.stdout(), &viz.output)
+		defer func() {
+			if werr := viz.write(*visualize, file, string(source)); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+	}
+	if *traceMode {
+		t := &tracer{w: os.Stderr}
+		hook := in.Hook
+		in.Enter = t.enter
+		in.Hook = func(s *EvalStep) {
+			if hook != nil {
+				hook(s)
+			}
+			t.leave(s)
+		}
+	}
+	if *profile || *pprofOut != "" {
+		p := newProfiler()
+		in.prof = p
+		enter, hook := in.Enter, in.Hook
+		in.Enter = func(s *EvalStep) {
+			if enter != nil {
+				enter(s)
+			}
+			p.enter(s)
+		}
+		in.Hook = func(s *EvalStep) {
+			if hook != nil {
+				hook(s)
+			}
+			p.leave(s)
+		}
+		defer func() {
+			if *profile {
+				p.report(os.Stderr)
+			}
+			if *pprofOut != "" {
+				if werr := writeProfile(p, *pprofOut); werr != nil && err == nil {
+					err = werr
+				}
+			}
+		}()
+	}
+	if *debugMode {
+		pm := &postMortem{}
+		hook := in.Hook
+		in.Hook = func(s *EvalStep) {
+			if hook != nil {
+				hook(s)
+			}
+			pm.record(s)
+		}
+		defer func() {
+			var exit *exitError
+			if err != nil && !errors.As(err, &exit) {
+				pm.run(err)
+				// The debugger has shown the error already.
+				err = &exitError{code: 1}
+			}
+		}()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = reportCrash(r, debug.Stack(), in, file, os.Args[1:])
+		}
+	}()
+	for i, f := range files {
+		file = f
+		if *isolate && i > 0 {
+			if env, err = fresh(); err != nil {
+				return err
+			}
+		}
+		if env, err = runfile(file, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeProfile saves the pprof profile of p to path.
+func writeProfile(p *profiler, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.writePprof(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
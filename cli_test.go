@@ -0,0 +1,13 @@
+//go:build !(js && wasm)
+
+package piku
+
+import "testing"
+
+func TestHelpSucceeds(t *testing.T) {
+	for _, args := range [][]string{{"--help"}, {"-h"}, {"run", "--help"}, {"new", "-help"}, {"selftest", "-h"}} {
+		if code := Main(args); code != 0 {
+			t.Errorf("piku %v exited with %d, want 0", args, code)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	defEager("io", "clipget", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		s, err := clipboardGet()
+		if err != nil {
+			return nil, fmt.Errorf("clipget: %v, line: %d", err, ln)
+		}
+		return mkstr(s), nil
+	})
+	defEager("io", "clipset", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		s, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("clipset: %v, line: %d", err, ln)
+		}
+		if err := clipboardSet(s); err != nil {
+			return nil, fmt.Errorf("clipset: %v, line: %d", err, ln)
+		}
+		return mknil(), nil
+	})
+}
+
+// The clipboard is reached through the usual command line tools of each
+// platform; the first one installed is used.
+type clipTool struct {
+	get, set []string
+}
+
+func clipTools() []clipTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipTool{{[]string{"pbpaste"}, []string{"pbcopy"}}}
+	case "windows":
+		return []clipTool{{[]string{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}, []string{"clip"}}}
+	}
+	return []clipTool{
+		{[]string{"wl-paste", "--no-newline"}, []string{"wl-copy"}},
+		{[]string{"xclip", "-selection", "clipboard", "-o"}, []string{"xclip", "-selection", "clipboard"}},
+		{[]string{"xsel", "--clipboard", "--output"}, []string{"xsel", "--clipboard", "--input"}},
+	}
+}
+
+func findClipTool() (clipTool, error) {
+	for _, t := range clipTools() {
+		if _, err := exec.LookPath(t.get[0]); err == nil {
+			return t, nil
+		}
+	}
+	return clipTool{}, errors.New("no clipboard tool found")
+}
+
+func clipboardGet() (string, error) {
+	t, err := findClipTool()
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(t.get[0], t.get[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func clipboardSet(s string) error {
+	t, err := findClipTool()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(t.set[0], t.set[1:]...)
+	cmd.Stdin = strings.NewReader(s)
+	return cmd.Run()
+}
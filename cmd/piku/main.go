@@ -0,0 +1,16 @@
+//go:build !(js && wasm)
+
+// Command piku runs piku programs and the tools around them. It is a thin
+// wrapper: the language and the commands are package piku, which a Go
+// program can import to embed piku.
+package main
+
+import (
+	"os"
+
+	"github.com/bora-yilmaz/PikuLang"
+)
+
+func main() {
+	os.Exit(piku.Main(os.Args[1:]))
+}
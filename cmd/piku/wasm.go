@@ -0,0 +1,21 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/bora-yilmaz/PikuLang"
+)
+
+// main exposes RunSource to JavaScript as a global function and keeps the
+// module alive so it can be called repeatedly.
+func main() {
+	js.Global().Set("RunSource", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if len(args) < 1 {
+			return "Error RunSource expects the program source"
+		}
+		return piku.RunSource(args[0].String())
+	}))
+	select {}
+}
@@ -0,0 +1,113 @@
+package piku
+
+import "fmt"
+
+// compose and partial make functions with no body of their own: the
+// parts of the Function hold what they were made from, and bindargs
+// calls that in place of evaluating a body. Their parameters are those of
+// the function called first, less any that partial filled in, so arity
+// checks, named arguments and help work on them as on any function.
+
+func init() {
+	defSpecial("core", "apply", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		f, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln), nil
+		}
+		lst, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if lst = asList(lst); lst.kind != KindList && lst.kind != KindTuple {
+			return nil, typeError("list", lst, ln), nil
+		}
+		args := make([]*Value, len(*lst.listval))
+		for i := range *lst.listval {
+			args[i] = &(*lst.listval)[i]
+		}
+		name := "function"
+		if node.Children[1].Type == "IDENTIFIER" {
+			name = node.Children[1].Value
+		}
+		if len(args) > len(f.fn().Args) {
+			return nil, fmt.Errorf("%s expects %s, got %d, line: %d", name, f.fn().arity(), len(args), ln), nil
+		}
+		return bindargs(f, name, args, nil, env, ln)
+	})
+	composeForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			if op == "partial" {
+				if args[0].kind != KindFunc {
+					return nil, typeError("function", args[0], ln)
+				}
+				p, err := partially(args[0], args[1:])
+				if err != nil {
+					return nil, fmt.Errorf("partial: %v, line: %d", err, ln)
+				}
+				return p, nil
+			}
+			for _, f := range args {
+				if f.kind != KindFunc {
+					return nil, typeError("function", f, ln)
+				}
+			}
+			return composed(args), nil
+		}
+	}
+	defEager("core", "compose", arity{2, -1}, composeForm("compose"))
+	defEager("core", "partial", arity{1, -1}, composeForm("partial"))
+}
+
+type fnParts struct {
+	// fns are the functions to call, the last first, each on the result
+	// of the one after it. partial makes a function with one.
+	fns []*Value
+	// bound are the arguments given to partial, passed ahead of those of
+	// each call.
+	bound []*Value
+}
+
+// composed returns the function that calls the last of fns with its
+// arguments and each of the others, from the last, on the result.
+func composed(fns []*Value) *Value {
+	first := fns[len(fns)-1].fn()
+	f := &Function{Args: first.Args, Defaults: first.Defaults, Types: first.Types, parts: &fnParts{fns: fns}}
+	return &Value{kind: KindFunc, ref: f}
+}
+
+// partially returns the function that calls f with bound followed by its
+// own arguments.
+func partially(f *Value, bound []*Value) (*Value, error) {
+	inner := f.fn()
+	if len(bound) > len(inner.Args) {
+		return nil, fmt.Errorf("the function expects %s, got %d", inner.arity(), len(bound))
+	}
+	p := &Function{Args: inner.Args[len(bound):], parts: &fnParts{fns: []*Value{f}, bound: bound}}
+	if len(inner.Defaults) > len(bound) {
+		p.Defaults = inner.Defaults[len(bound):]
+	}
+	if len(inner.Types) > len(bound) {
+		p.Types = inner.Types[len(bound):]
+	}
+	return &Value{kind: KindFunc, ref: p}, nil
+}
+
+// callparts calls the function f made by compose or partial.
+func callparts(f *Value, name string, args []*Value, named map[string]*Value, env *Env, ln int) (*Value, error, *Env) {
+	parts := f.fn().parts
+	last := len(parts.fns) - 1
+	if len(parts.bound) > 0 {
+		args = append(append([]*Value(nil), parts.bound...), args...)
+	}
+	v, err, _ := bindargs(parts.fns[last], name, args, named, env, ln)
+	for i := last - 1; i >= 0 && err == nil; i-- {
+		v, err, _ = applyfunc(parts.fns[i], []*Value{v}, env, ln)
+	}
+	if err != nil {
+		return nil, err, nil
+	}
+	return v, nil, env
+}
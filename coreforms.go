@@ -0,0 +1,627 @@
+package piku
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The builtins of the core language, registered as forms.go describes:
+// definitions, control flow, lists, dicts and printing. The builtins of
+// each other feature are registered in its own file, with their
+// documentation in help.go and their types in types.go.
+
+func init() {
+	defSpecial("core", "call", arity{1, -1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		f, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if f.kind == KindFunc {
+			name := "function"
+			if node.Children[1].Type == "IDENTIFIER" {
+				name = node.Children[1].Value
+			}
+			a, b, env := callfunc(f, name, env, ln, node.Children[2:])
+			return a, b, env
+		}
+		return nil, typeError("function", f, ln), nil
+	})
+	defSpecial("core", "set", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		if env.constant(node.Children[1].Value) {
+			return nil, fmt.Errorf("cannot set constant %s, line: %d", node.Children[1].Value, ln), nil
+		}
+		a, err, env := eval(node.Children[2], env, ln)
+		if err == nil {
+			env.vals[node.Children[1].Value] = a
+			return mknil(), nil, env
+		}
+		return nil, err, nil
+	})
+	defSpecial("core", "const", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		name := node.Children[1].Value
+		if env.constant(name) {
+			return nil, fmt.Errorf("cannot redefine constant %s, line: %d", name, ln), nil
+		}
+		a, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if env.consts == nil {
+			env.consts = map[string]bool{}
+		}
+		// The constant keeps a copy, so that editing the list it was
+		// made from does not change it.
+		env.vals[name] = copyValue(a)
+		env.consts[name] = true
+		return mknil(), nil, env
+	})
+	defEager("core", "echo", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		err, _ := pv(args[0], env, ln)
+		fmt.Fprintln(env.interp.stdout())
+		return nil, err
+	})
+	defEager("core", "echostr", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		if _, err := fmt.Fprintln(env.interp.stdout(), env.interp.renderText(args[0])); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+	defEager("core", "copy", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return copyValue(args[0]), nil
+	})
+	defSpecial("core", "help", arity{0, 1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		if len(node.Children) == 1 {
+			listBuiltins(env.interp.stdout())
+			return mknil(), nil, env
+		}
+		name := node.Children[1]
+		if name.Type != "IDENTIFIER" {
+			return nil, fmt.Errorf("help expects a name, line: %d", ln), nil
+		}
+		text, ok := helpText(name.Value, env)
+		if !ok {
+			return nil, fmt.Errorf("help: no builtin or function named %s, line: %d", name.Value, ln), nil
+		}
+		fmt.Fprintln(env.interp.stdout(), text)
+		return mknil(), nil, env
+	})
+	funcForm := func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		f, err := parseParams(node.Children[1], ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if len(node.Children) == 4 {
+			if node.Children[2].Type != "STRING" {
+				return nil, fmt.Errorf("%s expects a documentation string before the body, line: %d", node.Children[0].Value, ln), nil
+			}
+			f.Doc = node.Children[2].Value
+		}
+		f.expr = node.Children[len(node.Children)-1]
+		f.env = env
+		if env.interp != nil {
+			f.file = env.interp.file
+		}
+		f.gen = node.Children[0].Value == "genfunc"
+		return &Value{kind: KindFunc, ref: f}, nil, env
+	}
+	defSpecial("core", "func", arity{2, 3}, funcForm)
+	defSpecial("core", "genfunc", arity{2, 3}, funcForm)
+	arithForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			av, bv := args[0], args[1]
+			v, err := arith(op, av, bv, ln)
+			if err != nil {
+				return nil, err
+			}
+			if v.kind == KindBigInt && av.kind == KindInt && bv.kind == KindInt && env.interp.checksArithmetic() {
+				return nil, &OverflowError{Op: op, Line: ln}
+			}
+			return v, nil
+		}
+	}
+	for _, op := range []string{"add", "sub", "mul", "div", "mod"} {
+		defEager("core", op, arity{2, 2}, arithForm(op))
+	}
+	defEager("core", "neg", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		av := args[0]
+		if av.kind == KindFloat {
+			return mkfloat(-av.realval), nil
+		}
+		if !isInteger(av) {
+			return nil, typeError("number", av, ln)
+		}
+		if av.kind == KindInt && av.varval == math.MinInt && env.interp.checksArithmetic() {
+			return nil, &OverflowError{Op: "neg", Line: ln}
+		}
+		return negInt(av), nil
+	})
+	defSpecial("core", "if", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		res, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if !truthy(res) {
+			return eval(node.Children[3], env, ln)
+		}
+		return eval(node.Children[2], env, ln)
+	})
+	defEager("core", "list", arity{0, -1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		lst := make([]Value, len(args))
+		for i, a := range args {
+			lst[i] = *a
+		}
+		if env.interp != nil && env.interp.Immutable {
+			return mkplist(plistOf(lst)), nil
+		}
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	defEager("core", "plist", arity{0, -1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		p := emptyPlist
+		for _, a := range args {
+			p = p.push(a)
+		}
+		return mkplist(p), nil
+	})
+	defEager("core", "append", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		l, v := args[0], args[1]
+		switch l.kind {
+		case KindPList:
+			return mkplist(l.plist().push(v)), nil
+		case KindList:
+			lst := append(append(make([]Value, 0, len(*l.listval)+1), *l.listval...), *v)
+			return &Value{kind: KindList, listval: &lst, text: l.text}, nil
+		}
+		return nil, typeError("list", l, ln)
+	})
+	defEager("core", "index", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a := args[0]
+		i, err := listIndex(a, args[1], "index", false, ln)
+		if err != nil {
+			return nil, err
+		}
+		if a.kind == KindPList {
+			return a.plist().get(i), nil
+		}
+		e := (*a.listval)[i]
+		return &e, nil
+	})
+	defEager("core", "range", arity{3, 3}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a, b, c := args[0], args[1], args[2]
+		from, err := listIndex(a, b, "range", true, ln)
+		if err != nil {
+			return nil, err
+		}
+		to := listLen(a)
+		if c.kind != KindInt || c.varval != 0 {
+			if to, err = listIndex(a, c, "range", true, ln); err != nil {
+				return nil, err
+			}
+		}
+		if from > to {
+			return nil, fmt.Errorf("range start %d is after its end %d, line: %d", b.varval, c.varval, ln)
+		}
+		if a.kind == KindPList {
+			p := emptyPlist
+			for i := from; i < to; i++ {
+				p = p.push(a.plist().get(i))
+			}
+			return mkplist(p), nil
+		}
+		d := append([]Value{}, (*(a.listval))[from:to]...)
+		return &Value{kind: KindList, listval: &d, text: a.text}, nil
+	})
+	defSpecial("core", "edit", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		lin := node.Children[1].Value
+		if env.constant(lin) {
+			return nil, fmt.Errorf("cannot edit constant %s, line: %d", lin, ln), nil
+		}
+		i, err2, env := eval(node.Children[2], env, ln)
+		if err2 != nil {
+			return nil, err2, nil
+		}
+		val, err3, env := eval(node.Children[3], env, ln)
+		if err3 != nil {
+			return nil, err3, nil
+		}
+		l, ok := env.get(lin)
+		if !ok {
+			return nil, &NameError{Name: lin, Line: ln}, nil
+		}
+		n, err := listIndex(l, i, "edit", false, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		if l.kind == KindPList {
+			// The name is bound to the new version; the old one is
+			// left as it was for whatever else holds it.
+			l = mkplist(l.plist().set(n, val))
+			env.assign(lin, l)
+			return l, nil, env
+		}
+		(*(l.listval))[n] = *val
+		return l, nil, env
+	})
+	defEager("core", "printchar", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		cp := args[0]
+		if cp.kind != KindInt {
+			return nil, typeError("number", cp, ln)
+		}
+		fmt.Fprintf(env.interp.stdout(), "%c", rune(cp.varval))
+		return mknil(), nil
+	})
+	defEager("core", "newline", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		fmt.Fprintln(env.interp.stdout())
+		return mknil(), nil
+	})
+	defEager("core", "print", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		cs := args[0]
+		// A list of character codes is printed as text and anything
+		// else as echo shows it.
+		text, err := strval(cs)
+		if err != nil {
+			text = env.interp.render(cs)
+		}
+		fmt.Fprint(env.interp.stdout(), text)
+		return mknil(), nil
+	})
+	defSpecial("core", "quote", arity{1, 1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		return quotenode(node.Children[1]), nil, env
+	})
+	defEager("core", "eval", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		code, err := unquote(args[0], ln)
+		if err != nil {
+			return nil, err
+		}
+		v, err, _ := eval(code, env, ln)
+		return v, err
+	})
+	defSpecial("core", "default", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		x, err, nenv := eval(node.Children[1], env, ln)
+		if err != nil && !catchable(err) {
+			return nil, err, nil
+		}
+		if err != nil || isnil(x) {
+			return eval(node.Children[2], env, ln)
+		}
+		return x, nil, nenv
+	})
+	defSpecial("core", "try-getpath", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		v, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		path, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		path = asList(path)
+		if path.kind != KindList {
+			return nil, fmt.Errorf("try-getpath expects a list path, line: %d", ln), nil
+		}
+		for _, key := range *path.listval {
+			next, ok := lookup(v, &key)
+			if !ok {
+				return eval(node.Children[3], env, ln)
+			}
+			v = next
+		}
+		return v, nil, env
+	})
+	defEager("core", "get", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		d, key := args[0], args[1]
+		if d.kind != KindDict {
+			return nil, fmt.Errorf("get expects a dict, got %s, line: %d", typename(d), ln)
+		}
+		v, ok := lookup(d, key)
+		if !ok {
+			return mknil(), nil
+		}
+		return v, nil
+	})
+	defEager("core", "tuple", arity{0, -1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		vals := make([]Value, len(args))
+		for i, a := range args {
+			vals[i] = *a
+		}
+		return &Value{kind: KindTuple, listval: &vals}, nil
+	})
+	defSpecial("core", "setmany", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		names := node.Children[1].Children
+		v, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		v = asList(v)
+		if v.kind != KindTuple && v.kind != KindList {
+			return nil, fmt.Errorf("setmany expects a tuple or list, got %s, line: %d", typename(v), ln), nil
+		}
+		if len(*v.listval) != len(names) {
+			return nil, fmt.Errorf("setmany expects %d values, got %d, line: %d", len(names), len(*v.listval), ln), nil
+		}
+		for _, n := range names {
+			if env.constant(n.Value) {
+				return nil, fmt.Errorf("cannot set constant %s, line: %d", n.Value, ln), nil
+			}
+		}
+		for i, n := range names {
+			e := (*v.listval)[i]
+			env.vals[n.Value] = &e
+		}
+		return mknil(), nil, env
+	})
+	defEager("core", "divmod", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		av, bv := args[0], args[1]
+		if !isInteger(av) {
+			return nil, typeError("number", av, ln)
+		}
+		if !isInteger(bv) {
+			return nil, typeError("number", bv, ln)
+		}
+		if isZero(bv) {
+			return nil, fmt.Errorf("division by zero, line: %d", ln)
+		}
+		vals := []Value{*intArith("div", av, bv), *intArith("mod", av, bv)}
+		if vals[0].kind == KindBigInt && av.kind == KindInt && bv.kind == KindInt && env.interp.checksArithmetic() {
+			return nil, &OverflowError{Op: "divmod", Line: ln}
+		}
+		return &Value{kind: KindTuple, listval: &vals}, nil
+	})
+	defEager("core", "isnil", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		if isnil(args[0]) {
+			return &Value{kind: KindInt, varval: 1}, nil
+		}
+		return &Value{kind: KindInt, varval: 0}, nil
+	})
+	defEager("core", "typeof", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return mkstr(typeof(args[0])), nil
+	})
+	defEager("core", "sort", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := asList(args[0])
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		lst := append([]Value{}, *v.listval...)
+		var err error
+		sort.SliceStable(lst, func(i, j int) bool {
+			c, ok := compare(&lst[i], &lst[j])
+			if !ok && err == nil {
+				err = fmt.Errorf("sort: cannot compare %s with %s, line: %d", typename(&lst[i]), typename(&lst[j]), ln)
+			}
+			return c < 0
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Value{kind: KindList, listval: &lst, text: v.text}, nil
+	})
+	defEager("core", "sortby", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f, v := args[0], asList(args[1])
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		// The comparator is true when its first argument sorts first.
+		lst := append([]Value{}, *v.listval...)
+		var err error
+		sort.SliceStable(lst, func(i, j int) bool {
+			if err != nil {
+				return false
+			}
+			var r *Value
+			r, err, _ = applyfunc(f, []*Value{&lst[i], &lst[j]}, env, ln)
+			return err == nil && truthy(r)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	defEager("core", "reverse", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := asList(args[0])
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		lst := make([]Value, len(*v.listval))
+		for i, e := range *v.listval {
+			lst[len(lst)-1-i] = e
+		}
+		return &Value{kind: KindList, listval: &lst, text: v.text}, nil
+	})
+	defEager("core", "contains", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v, x := args[0], args[1]
+		v = asList(v)
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		for i := range *v.listval {
+			if equal(&(*v.listval)[i], x) {
+				return &Value{kind: KindInt, varval: 1}, nil
+			}
+		}
+		return &Value{kind: KindInt, varval: 0}, nil
+	})
+	defEager("core", "find", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f, v := args[0], args[1]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		v = asList(v)
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		for i := range *v.listval {
+			e := (*v.listval)[i]
+			r, err, _ := applyfunc(f, []*Value{&e}, env, ln)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(r) {
+				return &e, nil
+			}
+		}
+		return mknil(), nil
+	})
+	defEager("core", "flatten", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := asList(args[0])
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		// Only one level is flattened, so lists of strings stay strings.
+		lst := []Value{}
+		for _, e := range *v.listval {
+			e := asList(&e)
+			if e.kind == KindList {
+				lst = append(lst, *e.listval...)
+			} else {
+				lst = append(lst, *e)
+			}
+		}
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	zipConcatForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			lists := make([]*Value, len(args))
+			for i, b := range args {
+				if lists[i] = asList(b); lists[i].kind != KindList {
+					return nil, typeError("list", b, ln)
+				}
+			}
+			lst := []Value{}
+			if op == "concat" {
+				// Strings joined make a string.
+				text := true
+				for _, l := range lists {
+					lst = append(lst, *l.listval...)
+					text = text && l.text
+				}
+				return &Value{kind: KindList, listval: &lst, text: text}, nil
+			}
+			// zip stops at the end of the shortest list.
+			for i := 0; ; i++ {
+				row := []Value{}
+				for _, l := range lists {
+					if i >= len(*l.listval) {
+						return &Value{kind: KindList, listval: &lst}, nil
+					}
+					row = append(row, (*l.listval)[i])
+				}
+				lst = append(lst, Value{kind: KindTuple, listval: &row})
+			}
+		}
+	}
+	defEager("core", "zip", arity{2, -1}, zipConcatForm("zip"))
+	defEager("core", "concat", arity{1, -1}, zipConcatForm("concat"))
+	defSpecial("core", "while", arity{2, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		for {
+			c, err, nenv := eval(node.Children[1], env, ln)
+			if err != nil {
+				return nil, err, nil
+			}
+			env = nenv
+			if !truthy(c) {
+				return mknil(), nil, env
+			}
+			_, err, nenv = eval(node.Children[2], env, ln)
+			if err != nil {
+				brk, err := loopControl(err)
+				if err != nil {
+					return nil, err, nil
+				}
+				if brk {
+					return mknil(), nil, env
+				}
+				continue
+			}
+			env = nenv
+		}
+	})
+	defSpecial("core", "foreach", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		// The loop variable is bound like set, so the body can update
+		// variables outside the loop.
+		name := node.Children[1]
+		if name.Type != "IDENTIFIER" {
+			return nil, fmt.Errorf("foreach expects a variable name, line: %d", ln), nil
+		}
+		lv, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		var elems []Value
+		switch lv = asList(lv); lv.kind {
+		case KindList, KindTuple:
+			elems = append(elems, *lv.listval...)
+		case KindSet:
+			elems = setElems(lv)
+		default:
+			return nil, typeError("list", lv, ln), nil
+		}
+		if env.constant(name.Value) {
+			return nil, fmt.Errorf("cannot set constant %s, line: %d", name.Value, ln), nil
+		}
+		for _, e := range elems {
+			e := e
+			env.vals[name.Value] = &e
+			_, err, nenv := eval(node.Children[3], env, ln)
+			if err != nil {
+				brk, err := loopControl(err)
+				if err != nil {
+					return nil, err, nil
+				}
+				if brk {
+					break
+				}
+				continue
+			}
+			env = nenv
+		}
+		return mknil(), nil, env
+	})
+	loopControlForm := func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		return nil, &control{kind: node.Children[0].Value, line: ln}, nil
+	}
+	defSpecial("core", "break", arity{0, 0}, loopControlForm)
+	defSpecial("core", "continue", arity{0, 0}, loopControlForm)
+	defEager("core", "return", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		return nil, &control{kind: "return", val: v, line: ln}
+	})
+	defSpecial("core", "dict", arity{0, -1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		// Entries are written [key value], with the key a name or a
+		// string literal.
+		d := map[string]Value{}
+		for _, e := range node.Children[1:] {
+			if e.Type != "LIST" || len(e.Children) != 2 || (e.Children[0].Type != "IDENTIFIER" && e.Children[0].Type != "STRING") {
+				return nil, fmt.Errorf("dict entries are written [key value], line: %d", ln), nil
+			}
+			key := e.Children[0].Value
+			if _, dup := d[key]; dup {
+				return nil, fmt.Errorf("dict key %s given twice, line: %d", key, ln), nil
+			}
+			v, err, nenv := eval(e.Children[1], env, ln)
+			if err != nil {
+				return nil, err, nil
+			}
+			env = nenv
+			d[key] = *v
+		}
+		return &Value{kind: KindDict, dictval: d}, nil, env
+	})
+	defEager("core", "exit", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if v.kind != KindInt || v.varval < 0 || v.varval > 255 {
+			return nil, fmt.Errorf("exit expects a status from 0 to 255, got %s, line: %d", describe(v), ln)
+		}
+		return nil, &exitError{code: v.varval, line: ln}
+	})
+	defSpecial("core", "macro", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		arg := []string{}
+		for _, a := range node.Children[2].Children {
+			arg = append(arg, a.Value)
+		}
+		env.vals[node.Children[1].Value] = &Value{kind: KindMacro, ref: &Function{Args: arg, expr: node.Children[3]}}
+		return mknil(), nil, env
+	})
+}
@@ -0,0 +1,121 @@
+package piku
+
+import "fmt"
+
+// A coroutine (KindCoroutine) runs a function in steps. resume runs it
+// until it calls suspend or returns, and hands back the value given to
+// suspend or the result. The value given to resume is the argument of the
+// function the first time and what suspend returns after that. As with
+// generators, the function runs on a goroutine of its own but only while
+// resume waits for it.
+
+func init() {
+	defEager("core", "coroutine", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f := args[0]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		return newCoroutine(f, env), nil
+	})
+	defEager("core", "resume", arity{1, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		co, v := args[0], mknil()
+		if len(args) == 2 {
+			v = args[1]
+		}
+		if co.kind != KindCoroutine {
+			return nil, typeError("coroutine", co, ln)
+		}
+		return co.co().resume(v, env.interp, ln)
+	})
+	defEager("core", "suspend", arity{0, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := mknil()
+		if len(args) == 1 {
+			v = args[0]
+		}
+		return suspend(v, env.interp, ln)
+	})
+}
+
+type coroutine struct {
+	fn      *Value
+	env     *Env
+	in      chan *Value
+	out     chan genResult
+	calls   []callFrame
+	started bool
+	done    bool
+}
+
+func (co *coroutine) String() string {
+	return "coroutine"
+}
+
+func newCoroutine(fn *Value, env *Env) *Value {
+	co := &coroutine{fn: fn, env: env, in: make(chan *Value), out: make(chan genResult)}
+	return &Value{kind: KindCoroutine, ref: co}
+}
+
+// run calls the function on the coroutine's goroutine, passing v unless it
+// takes no arguments.
+func (co *coroutine) run(v *Value, ln int) {
+	var res *Value
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error in coroutine: %v, line: %d", r, ln)
+		}
+		co.out <- genResult{val: res, err: err, done: true}
+	}()
+	args := []*Value{v}
+	if len(co.fn.fn().Args) == 0 {
+		args = nil
+	}
+	res, err, _ = applyfunc(co.fn, args, co.env, ln)
+}
+
+// resume runs co until it suspends or finishes, with v as its argument or
+// as the result of the suspend it is waiting in.
+func (co *coroutine) resume(v *Value, in *Interpreter, ln int) (*Value, error) {
+	if co.done {
+		return nil, fmt.Errorf("cannot resume a coroutine that has finished, line: %d", ln)
+	}
+	if co.running(in) {
+		return nil, fmt.Errorf("cannot resume a coroutine that is running, line: %d", ln)
+	}
+	defer in.exclude()()
+	in.coroutines = append(in.coroutines, co)
+	caller := in.swapCalls(co.calls)
+	if !co.started {
+		co.started = true
+		go co.run(v, ln)
+	} else {
+		co.in <- v
+	}
+	r := <-co.out
+	co.calls = in.swapCalls(caller)
+	in.coroutines = in.coroutines[:len(in.coroutines)-1]
+	if r.done {
+		co.done = true
+	}
+	return r.val, r.err
+}
+
+func (co *coroutine) running(in *Interpreter) bool {
+	for _, c := range in.coroutines {
+		if c == co {
+			return true
+		}
+	}
+	return false
+}
+
+// suspend hands v to the resume the innermost running coroutine was
+// started by, and returns the value it is next resumed with.
+func suspend(v *Value, in *Interpreter, ln int) (*Value, error) {
+	if len(in.coroutines) == 0 {
+		return nil, fmt.Errorf("suspend outside a coroutine, line: %d", ln)
+	}
+	co := in.coroutines[len(in.coroutines)-1]
+	co.out <- genResult{val: v}
+	return <-co.in, nil
+}
@@ -0,0 +1,119 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A panic in the interpreter is a bug in piku, not in the program. Rather
+// than dumping a Go stack trace on the user, the CLI saves a crash report
+// for them to attach to a bug report.
+
+// reportCrash writes a report for the panic r, raised while running file
+// with the command line args, and returns the error to show the user.
+func reportCrash(r any, stack []byte, in *Interpreter, file string, args []string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "piku %s (%s, %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&sb, "command: piku %s\n", strings.Join(args, " "))
+	fmt.Fprintf(&sb, "panic: %v\n", r)
+	if n := in.current; n != nil {
+		fmt.Fprintf(&sb, "\nwhile evaluating, line %d, col %d:\n%s\n", n.Line, n.Col, nodeSource(n))
+		top := in.toplevel
+		if top == nil {
+			top = n
+		}
+		if repro := minimizeCrash(file, top); repro != "" {
+			fmt.Fprintf(&sb, "\nminimized program:\n%s", repro)
+		}
+	}
+	fmt.Fprintf(&sb, "\n%s", stack)
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("piku-crash-%s.txt", time.Now().Format("20060102-150405")))
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("internal error: %v (writing the crash report failed: %v)", r, err)
+	}
+	return fmt.Errorf("internal error: %v\nthis is a bug in piku; a crash report was saved to %s", r, path)
+}
+
+// minimizeCrash cuts file down to the top level form containing the node
+// that was running when the crash happened and the definitions it depends
+// on, found by following the names they use. Imports are kept since what
+// they define is unknown. It returns "" when the node is not from file.
+func minimizeCrash(file string, running *Node) string {
+	nodes, err := LoadFile(file)
+	if err != nil {
+		return ""
+	}
+	at := -1
+	for i, n := range nodes {
+		if m := nodeAt(n, running.Start, running.End); m != nil && nodeSource(m) == nodeSource(running) {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return ""
+	}
+	keep := map[int]bool{at: true}
+	needed := map[string]bool{}
+	usedNames(nodes[at], needed)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < at; i++ {
+			if keep[i] {
+				continue
+			}
+			if name := boundName(nodes[i]); isForm(nodes[i], "import") || (name != "" && needed[name]) {
+				keep[i], changed = true, true
+				usedNames(nodes[i], needed)
+			}
+		}
+	}
+	var sb strings.Builder
+	for i, n := range nodes[:at+1] {
+		if keep[i] {
+			sb.WriteString(nodeSource(n) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// nodeAt finds the node under n spanning exactly start to end.
+func nodeAt(n *Node, start, end int) *Node {
+	if n.Start > start || n.End < end {
+		return nil
+	}
+	if n.Start == start && n.End == end {
+		return n
+	}
+	for _, c := range n.Children {
+		if m := nodeAt(c, start, end); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+func usedNames(n *Node, names map[string]bool) {
+	if n.Type == "IDENTIFIER" {
+		names[n.Value] = true
+	}
+	for _, c := range n.Children {
+		usedNames(c, names)
+	}
+}
+
+// boundName returns the name a top level set, const or macro defines.
+func boundName(n *Node) string {
+	for _, form := range []string{"set", "const", "macro"} {
+		if isForm(n, form) && len(n.Children) > 1 {
+			return n.Children[1].Value
+		}
+	}
+	return ""
+}
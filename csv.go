@@ -0,0 +1,103 @@
+package piku
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func init() {
+	defEager("io", "csvread", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		path, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("csvread: %v, line: %d", err, ln)
+		}
+		records, err := readCSV(path)
+		if err != nil {
+			return nil, fmt.Errorf("csvread: %v, line: %d", err, ln)
+		}
+		rows := []Value{}
+		for _, r := range records {
+			rows = append(rows, *mkstrlist(r))
+		}
+		return &Value{kind: KindList, listval: &rows}, nil
+	})
+	defEager("io", "csvwrite", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		pathv, rows := args[0], args[1]
+		path, err := strval(pathv)
+		if err != nil {
+			return nil, fmt.Errorf("csvwrite: %v, line: %d", err, ln)
+		}
+		if err := writeCSV(path, rows); err != nil {
+			return nil, fmt.Errorf("csvwrite: %v, line: %d", err, ln)
+		}
+		return mknil(), nil
+	})
+}
+
+// readCSV reads the records of a CSV file. Rows may differ in length.
+func readCSV(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// csvField is the text written for a cell: strings and symbols as they
+// are, numbers as printed and nil as an empty field.
+func csvField(v *Value) (string, error) {
+	switch v.kind {
+	case KindInt:
+		return strconv.Itoa(v.varval), nil
+	case KindBigInt:
+		return v.big().String(), nil
+	case KindFloat:
+		return formatFloat(v.realval), nil
+	case KindSymbol:
+		return v.sym(), nil
+	case KindNil:
+		return "", nil
+	}
+	s, err := strval(v)
+	if err != nil {
+		return "", fmt.Errorf("a cell must be a string, number, symbol or nil, got %s", typename(v))
+	}
+	return s, nil
+}
+
+// writeCSV writes rows, a list of lists of cells, to path.
+func writeCSV(path string, rows *Value) error {
+	if rows = asList(rows); rows.kind != KindList {
+		return fmt.Errorf("expected a list of rows, got %s", typename(rows))
+	}
+	records := make([][]string, len(*rows.listval))
+	for i, row := range *rows.listval {
+		row := asList(&row)
+		if row.kind != KindList && row.kind != KindTuple {
+			return fmt.Errorf("row %d is a %s, not a list", i+1, typename(row))
+		}
+		for _, c := range *row.listval {
+			field, err := csvField(&c)
+			if err != nil {
+				return fmt.Errorf("row %d: %v", i+1, err)
+			}
+			records[i] = append(records[i], field)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
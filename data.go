@@ -0,0 +1,508 @@
+package piku
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+func init() {
+	defEager("core", "validate", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v, schema := args[0], args[1]
+		problems, err := validate(v, schema, "$")
+		if err != nil {
+			return nil, fmt.Errorf("%v, line: %d", err, ln)
+		}
+		lst := []Value{}
+		for _, p := range problems {
+			lst = append(lst, *mkstr(p))
+		}
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	defEager("core", "diff", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a, b := args[0], args[1]
+		lst := []Value{}
+		diffvals(a, b, []Value{}, &lst)
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	regexForm := func(name string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			patv, sv := args[0], args[1]
+			re, s, err := regexArgs(name, patv, sv, ln)
+			if err != nil {
+				return nil, err
+			}
+			if name == "refindall" {
+				return mkstrlist(re.FindAllString(s, -1)), nil
+			}
+			// The whole match and then each group; a group that did not
+			// take part in the match is nil.
+			loc := re.FindStringSubmatchIndex(s)
+			if loc == nil {
+				return mknil(), nil
+			}
+			groups := []Value{}
+			for i := 0; i < len(loc); i += 2 {
+				if loc[i] < 0 {
+					groups = append(groups, *mknil())
+				} else {
+					groups = append(groups, *mkstr(s[loc[i]:loc[i+1]]))
+				}
+			}
+			return &Value{kind: KindList, listval: &groups}, nil
+		}
+	}
+	defEager("core", "rematch", arity{2, 2}, regexForm("rematch"))
+	defEager("core", "refindall", arity{2, 2}, regexForm("refindall"))
+	defEager("core", "rereplace", arity{3, 3}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		patv, rv, sv := args[0], args[1], args[2]
+		re, s, err := regexArgs("rereplace", patv, sv, ln)
+		if err != nil {
+			return nil, err
+		}
+		repl, err := strval(rv)
+		if err != nil {
+			return nil, fmt.Errorf("rereplace: %v, line: %d", err, ln)
+		}
+		return mkstr(re.ReplaceAllString(s, repl)), nil
+	})
+}
+
+// mkstr converts a Go string into a character list, the representation
+// print understands.
+func mkstr(s string) *Value {
+	lst := []Value{}
+	for _, r := range s {
+		lst = append(lst, Value{kind: KindInt, varval: int(r)})
+	}
+	return &Value{kind: KindList, listval: &lst, text: true}
+}
+
+// strval reads a character list back into a Go string.
+func strval(v *Value) (string, error) {
+	v = asList(v)
+	if v == nil || v.kind != KindList {
+		return "", fmt.Errorf("expected string, got %s", typename(v))
+	}
+	var sb strings.Builder
+	for _, c := range *v.listval {
+		if c.kind != KindInt {
+			return "", fmt.Errorf("expected string, got list containing %s", typename(&c))
+		}
+		sb.WriteRune(rune(c.varval))
+	}
+	return sb.String(), nil
+}
+
+// strlist reads a list of character lists into Go strings.
+func strlist(v *Value) ([]string, error) {
+	v = asList(v)
+	if v == nil || v.kind != KindList {
+		return nil, fmt.Errorf("expected list of strings, got %s", typename(v))
+	}
+	out := []string{}
+	for i := range *v.listval {
+		s, err := strval(&(*v.listval)[i])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// mkstrlist builds a list of character lists from Go strings.
+func mkstrlist(ss []string) *Value {
+	lst := []Value{}
+	for _, s := range ss {
+		lst = append(lst, *mkstr(s))
+	}
+	return &Value{kind: KindList, listval: &lst}
+}
+
+// bytesval reads a list of numbers in 0..255 into a byte slice.
+func bytesval(v *Value) ([]byte, error) {
+	v = asList(v)
+	if v == nil || v.kind != KindList {
+		return nil, fmt.Errorf("expected list of bytes, got %s", typename(v))
+	}
+	out := make([]byte, len(*v.listval))
+	for i, c := range *v.listval {
+		if c.kind != KindInt || c.varval < 0 || c.varval > 255 {
+			return nil, fmt.Errorf("element %d is not a byte", i)
+		}
+		out[i] = byte(c.varval)
+	}
+	return out, nil
+}
+
+// mkbytes builds a list of numbers from a byte slice.
+func mkbytes(b []byte) *Value {
+	lst := make([]Value, len(b))
+	for i, c := range b {
+		lst[i] = Value{kind: KindInt, varval: int(c)}
+	}
+	return &Value{kind: KindList, listval: &lst}
+}
+
+// typename describes the variant of a value for messages.
+func typename(v *Value) string {
+	if v == nil {
+		return "nothing"
+	}
+	return v.kind.String()
+}
+
+// typeof names the type of v for scripts. It refines typename by calling
+// a list made as a string a string, while it holds only printable
+// characters.
+func typeof(v *Value) string {
+	if v == nil || v.kind != KindList || !v.text {
+		return typename(v)
+	}
+	for _, c := range *v.listval {
+		if c.kind != KindInt || c.varval > unicode.MaxRune || !(unicode.IsPrint(rune(c.varval)) || unicode.IsSpace(rune(c.varval))) {
+			return "list"
+		}
+	}
+	return "string"
+}
+
+// typeError reports that v was used where a want was expected.
+func typeError(want string, v *Value, ln int) error {
+	return &TypeError{Want: want, Got: typeof(v), Line: ln}
+}
+
+// copyValue returns a copy of v whose lists, tuples, dicts and sets are
+// its own, all the way down, so that edit and set-add on it leave v as it
+// was. A list that holds itself is copied once, holding its copy.
+func copyValue(v *Value) *Value {
+	return copyInto(v, map[*[]Value]*[]Value{})
+}
+
+func copyInto(v *Value, lists map[*[]Value]*[]Value) *Value {
+	switch v.kind {
+	case KindList, KindTuple:
+		if c, ok := lists[v.listval]; ok {
+			return &Value{kind: v.kind, listval: c, text: v.text}
+		}
+		lst := make([]Value, len(*v.listval))
+		lists[v.listval] = &lst
+		for i := range lst {
+			lst[i] = *copyInto(&(*v.listval)[i], lists)
+		}
+		return &Value{kind: v.kind, listval: &lst, text: v.text}
+	case KindPList:
+		return mkplist(plistOf(*copyInto(asList(v), lists).listval))
+	case KindDict, KindSet:
+		d := make(map[string]Value, len(v.dictval))
+		for k, e := range v.dictval {
+			d[k] = *copyInto(&e, lists)
+		}
+		return &Value{kind: v.kind, dictval: d}
+	}
+	return v
+}
+
+// lookup returns the element of a list at a numeric index or of a dict at a
+// string key, reporting false when there is no such element.
+func lookup(v, key *Value) (*Value, bool) {
+	switch v.kind {
+	case KindList:
+		if key.kind != KindInt || key.varval < 0 || key.varval >= len(*v.listval) {
+			return nil, false
+		}
+		e := (*v.listval)[key.varval]
+		return &e, true
+	case KindPList:
+		if key.kind != KindInt || key.varval < 0 || key.varval >= v.plist().len() {
+			return nil, false
+		}
+		return v.plist().get(key.varval), true
+	case KindDict:
+		k, err := strval(key)
+		if err != nil {
+			return nil, false
+		}
+		e, ok := v.dictval[k]
+		if !ok {
+			return nil, false
+		}
+		return &e, true
+	}
+	return nil, false
+}
+
+// listIndex turns the index i into a position in the list or tuple v,
+// counting negative indices from the end. With end set, the position just
+// past the last element is allowed as well, as needed for range bounds.
+func listIndex(v, i *Value, op string, end bool, ln int) (int, error) {
+	if v == nil || (v.kind != KindList && v.kind != KindTuple && v.kind != KindPList) {
+		return 0, typeError("list", v, ln)
+	}
+	if i == nil || i.kind != KindInt {
+		return 0, typeError("number", i, ln)
+	}
+	n, size := i.varval, listLen(v)
+	if n < 0 {
+		n += size
+	}
+	if n < 0 || n > size || (n == size && !end) {
+		return 0, &IndexError{Op: op, Index: i.varval, Len: size, Line: ln}
+	}
+	return n, nil
+}
+
+// validate checks v against a schema and returns a description of every
+// violation. A schema is one of the type symbols number, float, string,
+// list, function, macro, symbol, dict, tuple, handle, nil or any, where
+// string is a list typeof calls a string; [listof S] for lists whose
+// elements all match S; [tuple S1 ... Sn] for lists of exactly n matching
+// elements; [dict K1 S1 ... Kn Sn] for dicts with the keys K1 to Kn, given
+// as strings or symbols, whose values match S1 to Sn, other keys being
+// allowed; or [oneof S1 ... Sn] for values matching at least one
+// alternative.
+func validate(v *Value, schema *Value, path string) ([]string, error) {
+	if schema.kind == KindSymbol {
+		if schema.sym() == "any" || schema.sym() == typename(v) || schema.sym() == typeof(v) {
+			return nil, nil
+		}
+		switch schema.sym() {
+		case "number", "float", "string", "list", "function", "macro", "symbol", "dict", "tuple", "handle", "nil":
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, schema.sym(), typeof(v))}, nil
+		}
+		return nil, fmt.Errorf("unknown schema type: %s", schema.sym())
+	}
+	if schema.kind != KindList || len(*schema.listval) == 0 || (*schema.listval)[0].kind != KindSymbol {
+		return nil, fmt.Errorf("invalid schema: %s", describe(schema))
+	}
+	parts := (*schema.listval)[1:]
+	switch kind := (*schema.listval)[0].sym(); kind {
+	case "listof", "tuple":
+		if kind == "listof" && len(parts) != 1 {
+			return nil, fmt.Errorf("listof schema expects 1 element schema, got %d", len(parts))
+		}
+		if v = asList(v); v.kind != KindList {
+			return []string{fmt.Sprintf("%s: expected list, got %s", path, typename(v))}, nil
+		}
+		if kind == "tuple" && len(*v.listval) != len(parts) {
+			return []string{fmt.Sprintf("%s: expected %d elements, got %d", path, len(parts), len(*v.listval))}, nil
+		}
+		var out []string
+		for i := range *v.listval {
+			elem := &parts[0]
+			if kind == "tuple" {
+				elem = &parts[i]
+			}
+			sub, err := validate(&(*v.listval)[i], elem, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sub...)
+		}
+		return out, nil
+	case "dict":
+		if len(parts)%2 != 0 {
+			return nil, fmt.Errorf("dict schema expects keys each followed by a schema, got %d elements", len(parts))
+		}
+		if v.kind != KindDict {
+			return []string{fmt.Sprintf("%s: expected dict, got %s", path, typeof(v))}, nil
+		}
+		var out []string
+		for i := 0; i < len(parts); i += 2 {
+			key, err := strval(&parts[i])
+			if parts[i].kind == KindSymbol {
+				key, err = parts[i].sym(), nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("dict schema keys must be strings or symbols, got %s", describe(&parts[i]))
+			}
+			e, ok := v.dictval[key]
+			if !ok {
+				out = append(out, fmt.Sprintf("%s.%s: missing", path, key))
+				continue
+			}
+			sub, err := validate(&e, &parts[i+1], path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sub...)
+		}
+		return out, nil
+	case "oneof":
+		var alts []string
+		for i := range parts {
+			sub, err := validate(v, &parts[i], path)
+			if err != nil {
+				return nil, err
+			}
+			if len(sub) == 0 {
+				return nil, nil
+			}
+			alts = append(alts, sub...)
+		}
+		return []string{fmt.Sprintf("%s: no alternative matched (%s)", path, strings.Join(alts, "; "))}, nil
+	}
+	return nil, fmt.Errorf("unknown schema form: %s", (*schema.listval)[0].sym())
+}
+
+// diffvals appends a [path left right] entry to out for every place where a
+// and b differ. Paths are lists of indices; an element present on only one
+// side is reported against the symbol missing.
+func diffvals(a, b *Value, path []Value, out *[]Value) {
+	a, b = asList(a), asList(b)
+	if a.kind == KindList && b.kind == KindList {
+		la, lb := *a.listval, *b.listval
+		for i := 0; i < len(la) || i < len(lb); i++ {
+			sub := append(append([]Value{}, path...), Value{kind: KindInt, varval: i})
+			missing := Value{kind: KindSymbol, ref: "missing"}
+			switch {
+			case i >= len(la):
+				*out = append(*out, *diffentry(sub, &missing, &lb[i]))
+			case i >= len(lb):
+				*out = append(*out, *diffentry(sub, &la[i], &missing))
+			default:
+				diffvals(&la[i], &lb[i], sub, out)
+			}
+		}
+		return
+	}
+	if !equal(a, b) {
+		*out = append(*out, *diffentry(path, a, b))
+	}
+}
+
+func diffentry(path []Value, a, b *Value) *Value {
+	p := append([]Value{}, path...)
+	entry := []Value{{kind: KindList, listval: &p}, *a, *b}
+	return &Value{kind: KindList, listval: &entry}
+}
+
+// isIdent reports whether s could be written as a name in source.
+func isIdent(s string) bool {
+	for i, r := range s {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || (r != '-' && (r < '0' || r > '9'))) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// regexArgs compiles the pattern and reads the subject string given to the
+// regular expression builtin op.
+func regexArgs(op string, pattern, subject *Value, ln int) (*regexp.Regexp, string, error) {
+	p, err := strval(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: pattern: %v, line: %d", op, err, ln)
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v, line: %d", op, err, ln)
+	}
+	s, err := strval(subject)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v, line: %d", op, err, ln)
+	}
+	return re, s, nil
+}
+
+// describe renders v in full as the REPL shows it, strings quoted.
+func describe(v *Value) string {
+	return show(v, 0, 0)
+}
+
+// truthy reports how if treats v: zero, negative numbers and nil are
+// false, everything else is true.
+func truthy(v *Value) bool {
+	return !((v.kind == KindInt && v.varval <= 0) || (v.kind == KindBigInt && v.big().Sign() < 0) || (v.kind == KindFloat && v.realval <= 0) || v.kind == KindNil)
+}
+
+// compare orders two numbers, or two lists element by element so that
+// strings sort alphabetically. ok is false for values with no order.
+func compare(a, b *Value) (c int, ok bool) {
+	if isInteger(a) && isInteger(b) && (a.kind == KindBigInt || b.kind == KindBigInt) {
+		return bigOf(a).Cmp(bigOf(b)), true
+	}
+	if isNumber(a) && isNumber(b) {
+		x, y := floatval(a), floatval(b)
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	a, b = asList(a), asList(b)
+	if a.kind != KindList || b.kind != KindList {
+		return 0, false
+	}
+	x, y := *a.listval, *b.listval
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if c, ok := compare(&x[i], &y[i]); !ok || c != 0 {
+			return c, ok
+		}
+	}
+	return len(x) - len(y), true
+}
+
+// equal reports whether two values are structurally equal. Functions,
+// macros, handles, sequences, generators and coroutines are equal only to
+// themselves.
+func equal(a, b *Value) bool {
+	if a.kind == KindPList || b.kind == KindPList {
+		a, b = asList(a), asList(b)
+	}
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case KindInt:
+		return a.varval == b.varval
+	case KindBigInt:
+		return a.big().Cmp(b.big()) == 0
+	case KindFloat:
+		return a.realval == b.realval
+	case KindNil:
+		return true
+	case KindSymbol:
+		return a.sym() == b.sym()
+	case KindFunc, KindMacro:
+		return a.fn() == b.fn()
+	case KindHandle:
+		return a.handle() == b.handle()
+	case KindSeq:
+		return a.seq() == b.seq()
+	case KindGenerator:
+		return a.gen() == b.gen()
+	case KindCoroutine:
+		return a.co() == b.co()
+	case KindError:
+		x, y := a.scriptErr(), b.scriptErr()
+		return x.msg == y.msg && (x.code == nil) == (y.code == nil) && (x.code == nil || equal(x.code, y.code))
+	case KindDict, KindSet:
+		if len(a.dictval) != len(b.dictval) {
+			return false
+		}
+		for k, av := range a.dictval {
+			bv, ok := b.dictval[k]
+			if !ok || !equal(&av, &bv) {
+				return false
+			}
+		}
+		return true
+	case KindList, KindTuple:
+		if len(*a.listval) != len(*b.listval) {
+			return false
+		}
+		for i := range *a.listval {
+			if !equal(&(*a.listval)[i], &(*b.listval)[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package piku
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	tests := []struct{ value, schema, want string }{
+		{`"hi"`, `string`, `[list]`},
+		{`5`, `string`, `[list "$: expected string, got number"]`},
+		{`[list 1 2]`, `string`, `[list "$: expected string, got list"]`},
+		{`"hi"`, `list`, `[list]`},
+		{`[list 1 "x"]`, `[listof number]`, `[list "$[1]: expected number, got string"]`},
+		{`[list "a" "b"]`, `[listof string]`, `[list]`},
+		{`[dict ["name" "ann"] ["age" 30]]`, `[dict "name" string age number]`, `[list]`},
+		{`[dict ["name" "ann"] ["age" "x"]]`, `[dict name string age number email string]`,
+			`[list "$.age: expected number, got string" "$.email: missing"]`},
+		{`[dict ["p" [dict ["x" 1]]]]`, `[dict p [dict x string]]`, `[list "$.p.x: expected string, got number"]`},
+		{`[list 1]`, `[dict a number]`, `[list "$: expected dict, got list"]`},
+		{`[dict ["a" 1]]`, `[dict a]`, "Error dict schema expects keys each followed by a schema, got 1 elements, line: 1"},
+	}
+	for _, tt := range tests {
+		src := "[echo [validate " + tt.value + " [quote " + tt.schema + "]]]"
+		if got := RunSource(src); got != tt.want+"\n" {
+			t.Errorf("%s:\ngot  %q\nwant %q", src, got, tt.want+"\n")
+		}
+	}
+}
+
+func TestOnlyStringsPrintAsText(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{`[echo "ZUM"]`, "ZUM"},
+		{`[echo [list 90 85 77]]`, "[list 90 85 77]"},
+		{`[echo [typeof [list 90 85 77]]]`, "list"},
+		{`[echo [typeof ""]]`, "string"},
+		{`[echo [list "a" [list 97]]]`, `[list "a" [list 97]]`},
+		{`[echo [concat "pi" "ku"]]`, "piku"},
+		{`[echo [concat "pi" [list 107 117]]]`, "[list 112 105 107 117]"},
+		{`[echo [range "piku" 1 3]]`, "ik"},
+		{`[echo [reverse "ukip"]]`, "piku"},
+		{`[echo [append "pik" 'u']]`, "piku"},
+		{`[echo [copy "piku"]]`, "piku"},
+		{`[echo [typeof 1]]`, "number"},
+	}
+	for _, tt := range tests {
+		if got := RunSource(tt.src); got != tt.want+"\n" {
+			t.Errorf("%s: got %q, want %q", tt.src, got, tt.want+"\n")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package piku
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	defSpecial("io", "importdata", arity{1, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		pathv, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		path, err := strval(pathv)
+		if err != nil {
+			return nil, fmt.Errorf("importdata: %v, line: %d", err, ln), nil
+		}
+		name := dataName(path)
+		if len(node.Children) == 3 {
+			name = node.Children[2].Value
+		} else if !isIdent(name) {
+			return nil, fmt.Errorf("importdata: %s is not a name, give one to bind the data to, line: %d", name, ln), nil
+		}
+		if env.constant(name) {
+			return nil, fmt.Errorf("cannot set constant %s, line: %d", name, ln), nil
+		}
+		if !filepath.IsAbs(path) && env.interp != nil {
+			path = filepath.Join(env.interp.importDir(), path)
+		}
+		v, err := readDataFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("importdata: %v, line: %d", err, ln), nil
+		}
+		env.vals[name] = v
+		return mknil(), nil, env
+	})
+}
+
+// readDataFile reads a JSON or TOML file, told apart by its extension,
+// into a value: objects and tables become dicts, arrays lists, booleans 1
+// and 0 and null nil.
+func readDataFile(path string) (*Value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		x, err := decodeJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		return pikuValue(x), nil
+	case ".toml":
+		t, err := parseTOML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		return pikuValue(t), nil
+	}
+	return nil, fmt.Errorf("%s is not a .json or .toml file", filepath.Base(path))
+}
+
+// decodeJSON decodes a single JSON value, keeping integers exact.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var x any
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return jsonNumbers(x)
+}
+
+// jsonNumbers replaces the numbers in x with ints, big ints or floats.
+func jsonNumbers(x any) (any, error) {
+	switch x := x.(type) {
+	case json.Number:
+		s := string(x)
+		if n, err := strconv.Atoi(s); err == nil {
+			return n, nil
+		}
+		if n, ok := new(big.Int).SetString(s, 10); ok {
+			return n, nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case []any:
+		for i, e := range x {
+			v, err := jsonNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			x[i] = v
+		}
+	case map[string]any:
+		for k, e := range x {
+			v, err := jsonNumbers(e)
+			if err != nil {
+				return nil, err
+			}
+			x[k] = v
+		}
+	}
+	return x, nil
+}
+
+// dataName is the name [importdata path] binds when it is given none: the
+// file name without its extension.
+func dataName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -0,0 +1,23 @@
+package piku
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportData(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "conf.json"), []byte(`{"name": "piku", "sizes": [1, 2]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "[importdata " + quoteString(filepath.Join(dir, "conf.json")) + "]\n[echo [get conf \"sizes\"]]\n"
+	if got := RunSource(src); got != "[list 1 2]\n" {
+		t.Errorf("got %q", got)
+	}
+	got := runCaptured(&Interpreter{Restricted: true}, src)
+	if !strings.Contains(got, "importdata is disabled in restricted mode") {
+		t.Errorf("restricted run printed %q", got)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The post-mortem debugger of piku --debug. It watches the run through
+// the interpreter Hook for the innermost form that failed, and when the
+// program ends with an error it opens a prompt in the scope of that form.
+
+type postMortem struct {
+	// failed is the innermost failing form of the error being unwound,
+	// or nil when no error is.
+	failed *EvalStep
+}
+
+func (d *postMortem) record(s *EvalStep) {
+	switch {
+	case s.Err == nil:
+		// A form finishing normally outside the failed one means the
+		// error was handled, by try or default.
+		if d.failed != nil && s.Depth < d.failed.Depth {
+			d.failed = nil
+		}
+	case d.failed == nil:
+		d.failed = s
+	}
+}
+
+const debugHelp = `Type an expression to evaluate it in the failing scope.
+:where  show the form that failed
+:vars   list the variables of each scope, innermost first
+:quit   leave the debugger`
+
+// run opens the debugger prompt for the error err.
+func (d *postMortem) run(err error) {
+	fmt.Println("Error", err)
+	if d.failed == nil {
+		fmt.Println("the program failed outside any form; there is nothing to inspect")
+		return
+	}
+	env := d.failed.Env
+	in := env.interp
+	// Expressions typed in the debugger are not watched, and run without
+	// the limits that may have stopped the program.
+	in.Hook, in.MaxSteps, in.Ctx = nil, 0, nil
+	d.where()
+	fmt.Println(debugHelp)
+	ed := newLineEditor(historyPath(), completer(env))
+	for ln := 1; ; ln++ {
+		line, err := ed.readLine("debug> ")
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "":
+			continue
+		case ":quit":
+			return
+		case ":help":
+			fmt.Println(debugHelp)
+			continue
+		case ":where":
+			d.where()
+			continue
+		case ":vars":
+			d.vars()
+			continue
+		}
+		nodes, err := parseLine(line)
+		if err != nil {
+			fmt.Println("Error", err)
+			continue
+		}
+		for _, node := range nodes {
+			v, err, _ := eval(node, env, ln)
+			if err != nil {
+				fmt.Println("Error", err)
+				break
+			}
+			fmt.Println(describe(v))
+		}
+	}
+}
+
+func (d *postMortem) where() {
+	n := d.failed.Node
+	fmt.Printf("failed at line %d, col %d: %s\n", n.Line, n.Col, nodeSource(n))
+}
+
+func (d *postMortem) vars() {
+	listVars(d.failed.Env, "failing")
+}
+
+// listVars prints the variables of env and the scopes around it, naming
+// env itself as the innermost scope.
+func listVars(env *Env, innermost string) {
+	depth := 0
+	for e := env; e != nil; e = e.parent {
+		name := "function scope"
+		if e.parent == nil {
+			name = "global scope"
+		}
+		if depth == 0 {
+			name = innermost + " " + name
+		}
+		fmt.Printf("%s:\n", name)
+		names := make([]string, 0, len(e.vals))
+		for k := range e.vals {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Printf("  %-16s %s\n", k, describe(e.vals[k]))
+		}
+		depth++
+	}
+}
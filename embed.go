@@ -0,0 +1,159 @@
+// Package piku is the piku language: the interpreter, its builtins and the
+// tools of the piku command, which calls Main.
+//
+// A Go program can embed piku as a scripting or configuration language.
+// It makes an Interpreter, runs source with Run, then reads the variables
+// the source set with Get and calls the functions it defined with Call.
+// It can add builtins of its own, written in Go, with RegisterBuiltin;
+// they take and return Values.
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Values cross over Get and Call as plain Go values, converted by goValue
+// and pikuValue.
+
+// Run runs source in the global environment of in, the one Get and Call
+// use.
+func (in *Interpreter) Run(source string) error {
+	nodes, diags := parseSource(source)
+	if len(diags) > 0 {
+		return diags
+	}
+	env, err := execast(nodes, in.global())
+	if err != nil {
+		return err
+	}
+	in.globals = env
+	return nil
+}
+
+// Get returns the value of the global variable name.
+func (in *Interpreter) Get(name string) (any, bool) {
+	v, ok := in.global().get(name)
+	if !ok {
+		return nil, false
+	}
+	return goValue(v), true
+}
+
+// Call calls the function bound to name with args and returns its result.
+func (in *Interpreter) Call(name string, args ...any) (any, error) {
+	f, ok := in.global().get(name)
+	if !ok {
+		return nil, &NameError{Name: name}
+	}
+	if f.kind != KindFunc {
+		return nil, fmt.Errorf("%s is not a function but %s", name, typename(f))
+	}
+	if len(args) > len(f.fn().Args) {
+		return nil, fmt.Errorf("%s expects %s, got %d", name, f.fn().arity(), len(args))
+	}
+	vals := make([]*Value, len(args))
+	for i, a := range args {
+		vals[i] = pikuValue(a)
+	}
+	v, err, _ := bindargs(f, name, vals, nil, in.global(), 0)
+	if c, ok := err.(*control); ok {
+		err = errors.New(c.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goValue(v), nil
+}
+
+// global returns the global environment of in, making it if need be.
+func (in *Interpreter) global() *Env {
+	if in.globals == nil {
+		in.globals = newEnv(in)
+	}
+	return in.globals
+}
+
+// goValue converts v to a plain Go value: nil, int, *big.Int, float64,
+// string, []any for lists and tuples, map[string]any for dicts and the
+// value inside a handle.
+func goValue(v *Value) any {
+	switch v.kind {
+	case KindInt:
+		return v.varval
+	case KindBigInt:
+		return new(big.Int).Set(v.big())
+	case KindFloat:
+		return v.realval
+	case KindNil:
+		return nil
+	case KindHandle:
+		return v.handle()
+	case KindPList:
+		return goValue(asList(v))
+	case KindList, KindTuple:
+		if typeof(v) == "string" {
+			s, _ := strval(v)
+			return s
+		}
+		xs := make([]any, len(*v.listval))
+		for i := range *v.listval {
+			xs[i] = goValue(&(*v.listval)[i])
+		}
+		return xs
+	case KindDict:
+		m := make(map[string]any, len(v.dictval))
+		for k, e := range v.dictval {
+			m[k] = goValue(&e)
+		}
+		return m
+	}
+	// Anything else, a function say, is passed through untouched to be
+	// handed back.
+	return v
+}
+
+// pikuValue converts a Go value the other way, with bools as 1 and 0 and
+// any Go value it does not know wrapped in a handle.
+func pikuValue(x any) *Value {
+	switch x := x.(type) {
+	case nil:
+		return mknil()
+	case *Value:
+		return x
+	case bool:
+		if x {
+			return &Value{kind: KindInt, varval: 1}
+		}
+		return &Value{kind: KindInt, varval: 0}
+	case int:
+		return &Value{kind: KindInt, varval: x}
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		n, _ := new(big.Int).SetString(fmt.Sprint(x), 10)
+		return mkint(n)
+	case *big.Int:
+		return mkint(new(big.Int).Set(x))
+	case float32:
+		return mkfloat(float64(x))
+	case float64:
+		return mkfloat(x)
+	case string:
+		return mkstr(x)
+	case []string:
+		return mkstrlist(x)
+	case []any:
+		lst := make([]Value, len(x))
+		for i, e := range x {
+			lst[i] = *pikuValue(e)
+		}
+		return &Value{kind: KindList, listval: &lst}
+	case map[string]any:
+		d := make(map[string]Value, len(x))
+		for k, e := range x {
+			d[k] = *pikuValue(e)
+		}
+		return &Value{kind: KindDict, dictval: d}
+	}
+	return &Value{kind: KindHandle, ref: x}
+}
@@ -0,0 +1,121 @@
+package piku
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Error values (KindError) carry a message, an optional
+// code and the line they were raised on. raise turns one into the error
+// that eval returns, so it unwinds like any failure of the interpreter,
+// and try turns whatever error it catches back into a value.
+
+func init() {
+	defEager("core", "raise", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if v.kind == KindError {
+			return nil, v.scriptErr()
+		}
+		msg, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("raise expects a message or an error, got %s, line: %d", typename(v), ln)
+		}
+		return nil, &scriptError{msg: msg, line: ln}
+	})
+	defEager("core", "error", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		code, mv := args[0], args[1]
+		msg, err := strval(mv)
+		if err != nil {
+			return nil, fmt.Errorf("error: message: %v, line: %d", err, ln)
+		}
+		return mkerror(&scriptError{code: code, msg: msg, line: ln}), nil
+	})
+	defSpecial("core", "try", arity{3, 3}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		name := node.Children[2]
+		if name.Type != "IDENTIFIER" {
+			return nil, fmt.Errorf("try expects a name for the error, line: %d", ln), nil
+		}
+		v, err, nenv := eval(node.Children[1], env, ln)
+		if err == nil {
+			return v, nil, nenv
+		}
+		if !catchable(err) {
+			return nil, err, nil
+		}
+		env.vals[name.Value] = errorValue(err)
+		return eval(node.Children[3], env, ln)
+	})
+	errPartForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v := args[0]
+			e, err := errhandle(v, op, ln)
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "errmsg":
+				return mkstr(e.msg), nil
+			case "errtrace":
+				return mkstrlist(traceLines(e.trace)), nil
+			}
+			if e.code == nil {
+				return mknil(), nil
+			}
+			return e.code, nil
+		}
+	}
+	defEager("core", "errmsg", arity{1, 1}, errPartForm("errmsg"))
+	defEager("core", "errcode", arity{1, 1}, errPartForm("errcode"))
+	defEager("core", "errtrace", arity{1, 1}, errPartForm("errtrace"))
+}
+
+type scriptError struct {
+	code *Value // nil when the error has none
+	msg  string
+	line int
+	// trace is the stack trace of the error, once it has one.
+	trace []callFrame
+}
+
+func (e *scriptError) Error() string {
+	if e.line == 0 {
+		return e.msg
+	}
+	return fmt.Sprintf("%s, line: %d", e.msg, e.line)
+}
+
+func mkerror(e *scriptError) *Value {
+	return &Value{kind: KindError, ref: e}
+}
+
+var lineSuffix = regexp.MustCompile(`, line: (\d+)$`)
+
+// errorValue converts an error caught by try into an error value. An
+// interpreter error has no code; its line is taken from its message.
+func errorValue(err error) *Value {
+	trace := errorTrace(err)
+	if t, ok := err.(*tracedError); ok {
+		err = t.err
+	}
+	if e, ok := err.(*scriptError); ok {
+		if e.trace == nil {
+			e.trace = trace
+		}
+		return mkerror(e)
+	}
+	e := &scriptError{msg: err.Error(), trace: trace}
+	if m := lineSuffix.FindStringSubmatchIndex(e.msg); m != nil {
+		e.line, _ = strconv.Atoi(e.msg[m[2]:m[3]])
+		e.msg = e.msg[:m[0]]
+	}
+	return mkerror(e)
+}
+
+// errhandle extracts the error behind an error value.
+func errhandle(v *Value, op string, ln int) (*scriptError, error) {
+	if v.kind != KindError {
+		return nil, fmt.Errorf("%s expects an error, got %s, line: %d", op, typename(v), ln)
+	}
+	return v.scriptErr(), nil
+}
@@ -0,0 +1,95 @@
+package piku
+
+import "fmt"
+
+// A program embedding piku can tell the common failures apart with
+// errors.As rather than by their messages, which stay as they were:
+//
+//	var name *NameError
+//	if errors.As(err, &name) {
+//		// name.Name is not bound.
+//	}
+//
+// Line is 0 where no line is known, and the message then has none.
+
+// SyntaxError is a mistake in the text of a program found by the
+// tokenizer or the parser. Run returns them gathered in Diagnostics,
+// which errors.As looks through.
+type SyntaxError = Diagnostic
+
+// Unwrap returns the syntax errors for errors.Is and errors.As.
+func (ds Diagnostics) Unwrap() []error {
+	errs := make([]error, len(ds))
+	for i, d := range ds {
+		errs[i] = d
+	}
+	return errs
+}
+
+// withLine adds the line suffix shared by evaluation errors to msg.
+func withLine(msg string, line int) string {
+	if line == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s, line: %d", msg, line)
+}
+
+// NameError reports a name that is not bound.
+type NameError struct {
+	Name string
+	Line int
+}
+
+func (e *NameError) Error() string {
+	return withLine("undefined identifier: "+e.Name, e.Line)
+}
+
+// TypeError reports a value of the wrong type, naming both types as
+// typeof does.
+type TypeError struct {
+	Want, Got string
+	Line      int
+}
+
+func (e *TypeError) Error() string {
+	return withLine(fmt.Sprintf("type error: expected %s, got %s", e.Want, e.Got), e.Line)
+}
+
+// IndexError reports an index past either end of a list or tuple of Len
+// elements, used by the form Op.
+type IndexError struct {
+	Op         string
+	Index, Len int
+	Line       int
+}
+
+func (e *IndexError) Error() string {
+	return withLine(fmt.Sprintf("%s: index %d out of range for length %d", e.Op, e.Index, e.Len), e.Line)
+}
+
+// OverflowError reports integer arithmetic by the form Op whose result
+// does not fit an int, when the interpreter checks arithmetic.
+type OverflowError struct {
+	Op   string
+	Line int
+}
+
+func (e *OverflowError) Error() string {
+	return withLine(e.Op+": integer overflow", e.Line)
+}
+
+// ImportError reports a module that could not be found, fetched or
+// parsed. Err is the reason, which errors.Is and errors.As look at too.
+type ImportError struct {
+	Name string
+	Line int
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	return withLine(fmt.Sprintf("import %s: %v", e.Name, e.Err), e.Line)
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
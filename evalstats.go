@@ -0,0 +1,86 @@
+package piku
+
+import "sync/atomic"
+
+// An interpreter counts what the programs it runs cost, so that a program
+// embedding piku can watch a script and stop one that does too much, by
+// cancelling its Ctx from a Hook, say. Workers started by pmap count
+// against the interpreter they work for.
+
+func init() {
+	defEager("core", "stats", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return statsValue(env.interp), nil
+	})
+}
+
+// Stats is what evaluation has cost an interpreter so far.
+type Stats struct {
+	// Nodes is the number of nodes evaluated, the count MaxSteps limits.
+	Nodes int64
+	// Calls is the number of function calls whose body ran.
+	Calls int64
+	// Values is the number of values made: the results of nodes that are
+	// neither shared, as small integers and nil are, nor the value of a
+	// variable or of the node evaluated just before, handed on unchanged.
+	// It comes close to the number of values allocated.
+	Values int64
+	// MaxScope is the most variables seen bound in one scope.
+	MaxScope int64
+}
+
+// Stats returns the counts so far.
+func (in *Interpreter) Stats() Stats {
+	c := in.counter()
+	return Stats{
+		Nodes:    atomic.LoadInt64(&c.steps),
+		Calls:    atomic.LoadInt64(&c.ncalls),
+		Values:   atomic.LoadInt64(&c.nvalues),
+		MaxScope: atomic.LoadInt64(&c.maxScope),
+	}
+}
+
+// counter returns the interpreter the counts of in are kept on.
+func (in *Interpreter) counter() *Interpreter {
+	if in.parent != nil {
+		return in.parent
+	}
+	return in
+}
+
+// counted counts v, the value node evaluated to in env.
+func (in *Interpreter) counted(node *Node, v *Value, env *Env) {
+	c := in.counter()
+	if node.Type != "IDENTIFIER" && v != in.last && !isShared(v) {
+		atomic.AddInt64(&c.nvalues, 1)
+	}
+	in.last = v
+	if node.Type != "LIST" || env == nil {
+		return
+	}
+	n := int64(len(env.vals))
+	for {
+		m := atomic.LoadInt64(&c.maxScope)
+		if n <= m || atomic.CompareAndSwapInt64(&c.maxScope, m, n) {
+			return
+		}
+	}
+}
+
+// isShared reports whether v is one of the values made once and shared.
+func isShared(v *Value) bool {
+	if v == &nilValue {
+		return true
+	}
+	return v.kind == KindInt && v.varval >= minSmallInt && v.varval < maxSmallInt && v == &smallInts[v.varval-minSmallInt]
+}
+
+// statsValue returns the counts of in as the stats builtin does.
+func statsValue(in *Interpreter) *Value {
+	s := in.Stats()
+	return &Value{kind: KindDict, dictval: map[string]Value{
+		"nodes":     *mknum(int(s.Nodes)),
+		"calls":     *mknum(int(s.Calls)),
+		"values":    *mknum(int(s.Values)),
+		"max-scope": *mknum(int(s.MaxScope)),
+	}}
+}
@@ -0,0 +1,55 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// piku --trace logs the run to standard error as it goes: each form when
+// its evaluation starts, with the values of the variables it names, and
+// its result when it is done, both indented by how deeply the form is
+// nested in the forms and calls around it.
+
+// maxTraceText bounds the length of a form or value in the trace.
+const maxTraceText = 80
+
+type tracer struct {
+	w io.Writer
+}
+
+// clip cuts s down to maxTraceText characters.
+func clip(s string) string {
+	if r := []rune(s); len(r) > maxTraceText {
+		return string(r[:maxTraceText-3]) + "..."
+	}
+	return s
+}
+
+func (t *tracer) enter(s *EvalStep) {
+	line := strings.Repeat("  ", s.Depth) + clip(nodeSource(s.Node))
+	var args []string
+	for _, c := range s.Node.Children[1:] {
+		if c.Type != "IDENTIFIER" {
+			continue
+		}
+		if v, ok := s.Env.get(c.Value); ok {
+			args = append(args, c.Value+"="+clip(describe(v)))
+		}
+	}
+	if len(args) > 0 {
+		line += "    " + strings.Join(args, " ")
+	}
+	fmt.Fprintf(t.w, "%d: %s\n", s.Node.Line, line)
+}
+
+func (t *tracer) leave(s *EvalStep) {
+	indent := strings.Repeat("  ", s.Depth)
+	if s.Err != nil {
+		fmt.Fprintf(t.w, "%d: %s!! %s\n", s.Node.Line, indent, clip(s.Err.Error()))
+		return
+	}
+	fmt.Fprintf(t.w, "%d: %s=> %s\n", s.Node.Line, indent, clip(describe(s.Value)))
+}
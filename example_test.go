@@ -0,0 +1,48 @@
+package piku_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bora-yilmaz/PikuLang"
+)
+
+func ExampleInterpreter_RegisterBuiltin() {
+	in := &piku.Interpreter{}
+	in.RegisterBuiltin("shout", func(args []*piku.Value) (*piku.Value, error) {
+		s, ok := args[0].Text()
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %v", args[0].Kind())
+		}
+		return piku.NewString(strings.ToUpper(s) + "!"), nil
+	})
+	if err := in.Run(`[set greeting [shout "hello"]] [set double [func [n] [mul n 2]]]`); err != nil {
+		fmt.Println(err)
+		return
+	}
+	greeting, _ := in.Get("greeting")
+	doubled, _ := in.Call("double", 21)
+	fmt.Println(greeting, doubled)
+	// Output: HELLO! 42
+}
+
+func ExampleNameError() {
+	in := &piku.Interpreter{}
+	err := in.Run("[set a 1]\n[echo b]")
+	var name *piku.NameError
+	if errors.As(err, &name) {
+		fmt.Printf("%s is not bound, line %d\n", name.Name, name.Line)
+	}
+	// Output: b is not bound, line 2
+}
+
+func ExampleInterpreter_Stats() {
+	in := &piku.Interpreter{}
+	if err := in.Run(`[set f [func [n] [add n 1]]] [call f 1] [call f 2]`); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(in.Stats().Calls)
+	// Output: 2
+}
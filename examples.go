@@ -0,0 +1,91 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// The example gallery is built into the binary, so that piku examples works
+// without a checkout. Each example starts with a [quote "..."] form saying
+// what it shows, and its output is kept beside it in a .expected file, so
+// that the tests run the gallery as they do the golden tests.
+
+//go:embed examples/*.pi
+var exampleFS embed.FS
+
+// exampleNames lists the examples in name order.
+func exampleNames() []string {
+	entries, _ := exampleFS.ReadDir("examples")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".pi"))
+	}
+	return names
+}
+
+func exampleSource(name string) (string, error) {
+	data, err := exampleFS.ReadFile(path.Join("examples", name+".pi"))
+	if err != nil {
+		return "", fmt.Errorf("no example named %s (see piku examples list)", name)
+	}
+	return string(data), nil
+}
+
+// exampleDescription returns the text of the leading quote form of source.
+func exampleDescription(source string) string {
+	nodes, diags := parseSource(source)
+	if len(diags) > 0 || len(nodes) == 0 {
+		return ""
+	}
+	if n := nodes[0]; isForm(n, "quote") && len(n.Children) == 2 && n.Children[1].Type == "STRING" {
+		return n.Children[1].Value
+	}
+	return ""
+}
+
+// examplesCmd implements "piku examples list|show|run".
+func examplesCmd(args []string) error {
+	usage := errors.New("usage: piku examples list | show name | run name")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return usage
+		}
+		for _, name := range exampleNames() {
+			src, err := exampleSource(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-12s %s\n", name, exampleDescription(src))
+		}
+		return nil
+	case "show", "run":
+		if len(args) != 2 {
+			return usage
+		}
+		src, err := exampleSource(args[1])
+		if err != nil {
+			return err
+		}
+		if args[0] == "show" {
+			_, err = os.Stdout.WriteString(src)
+			return err
+		}
+		nodes, diags := parseSource(src)
+		if len(diags) > 0 {
+			return diags
+		}
+		_, err = execast(nodes, newEnv(&Interpreter{}))
+		return err
+	}
+	return usage
+}
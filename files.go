@@ -0,0 +1,324 @@
+package piku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	defEager("io", "tempfile", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		prefix, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("tempfile: %v, line: %d", err, ln)
+		}
+		path, err := tempFile(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("tempfile: %v, line: %d", err, ln)
+		}
+		return mkstr(path), nil
+	})
+	defEager("io", "tempdir", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		dir, err := tempDir()
+		if err != nil {
+			return nil, fmt.Errorf("tempdir: %v, line: %d", err, ln)
+		}
+		return mkstr(dir), nil
+	})
+	defEager("io", "glob", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		pattern, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("glob: %v, line: %d", err, ln)
+		}
+		matches, err := globPaths(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob: %v, line: %d", err, ln)
+		}
+		return mkstrlist(matches), nil
+	})
+	defEager("io", "stat", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		path, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("stat: %v, line: %d", err, ln)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("stat: %v, line: %d", err, ln)
+		}
+		isdir := 0
+		if info.IsDir() {
+			isdir = 1
+		}
+		return &Value{kind: KindDict, dictval: map[string]Value{
+			"name":  *mkstr(info.Name()),
+			"size":  {kind: KindInt, varval: int(info.Size())},
+			"mtime": {kind: KindInt, varval: int(info.ModTime().Unix())},
+			"mode":  {kind: KindInt, varval: int(info.Mode().Perm())},
+			"isdir": {kind: KindInt, varval: isdir},
+		}}, nil
+	})
+	defEager("io", "newer", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		av, bv := args[0], args[1]
+		a, err := strval(av)
+		if err != nil {
+			return nil, fmt.Errorf("newer: %v, line: %d", err, ln)
+		}
+		b, err := strval(bv)
+		if err != nil {
+			return nil, fmt.Errorf("newer: %v, line: %d", err, ln)
+		}
+		n, err := isNewer(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("newer: %v, line: %d", err, ln)
+		}
+		return &Value{kind: KindInt, varval: n}, nil
+	})
+	defEager("io", "watch", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		path, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("watch: %v, line: %d", err, ln)
+		}
+		handler := args[1]
+		if handler.kind != KindFunc {
+			return nil, fmt.Errorf("watch expects a function handler, got %s, line: %d", typename(handler), ln)
+		}
+		err = watchPath(path, env.interp, func(changed string) error {
+			_, err, nenv := applyfunc(handler, []*Value{mkstr(changed)}, env, ln)
+			if err == nil {
+				env = nenv
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+	defEager("io", "expand", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		s, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("expand: %v, line: %d", err, ln)
+		}
+		s, err = expandPath(s)
+		if err != nil {
+			return nil, fmt.Errorf("expand: %v, line: %d", err, ln)
+		}
+		return mkstr(s), nil
+	})
+}
+
+// Temporary files and directories handed out to scripts are removed when
+// the interpreter exits.
+var temps struct {
+	sync.Mutex
+	paths []string
+}
+
+func registerTemp(path string) {
+	temps.Lock()
+	temps.paths = append(temps.paths, path)
+	temps.Unlock()
+}
+
+func cleanupTemps() {
+	temps.Lock()
+	defer temps.Unlock()
+	for i := len(temps.paths) - 1; i >= 0; i-- {
+		os.RemoveAll(temps.paths[i])
+	}
+	temps.paths = nil
+}
+
+func tempFile(prefix string) (string, error) {
+	f, err := os.CreateTemp("", prefix+"*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	registerTemp(f.Name())
+	return f.Name(), nil
+}
+
+func tempDir() (string, error) {
+	dir, err := os.MkdirTemp("", "piku-*")
+	if err != nil {
+		return "", err
+	}
+	registerTemp(dir)
+	return dir, nil
+}
+
+// globPaths returns the sorted paths matching pattern. Besides the syntax of
+// filepath.Match, a "**" path segment matches any number of directories.
+func globPaths(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		matches, err := filepath.Glob(pattern)
+		if matches == nil {
+			matches = []string{}
+		}
+		return matches, err
+	}
+	segs := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(segs) && !strings.ContainsAny(segs[i], "*?[\\") {
+		i++
+	}
+	root := strings.Join(segs[:i], "/")
+	if root == "" {
+		root = "."
+		if strings.HasPrefix(pattern, "/") {
+			root = "/"
+		}
+	}
+	rest := segs[i:]
+	matches := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if matchSegments(rest, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	sort.Strings(matches)
+	return matches, err
+}
+
+func matchSegments(pat, parts []string) bool {
+	if len(pat) == 0 {
+		return len(parts) == 0
+	}
+	if pat[0] == "**" {
+		for k := 0; k <= len(parts); k++ {
+			if matchSegments(pat[1:], parts[k:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, err := filepath.Match(pat[0], parts[0])
+	return err == nil && ok && matchSegments(pat[1:], parts[1:])
+}
+
+// isNewer reports 1 when a was modified after b or b does not exist, the
+// usual rule for deciding whether a target must be rebuilt.
+func isNewer(a, b string) (int, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return 0, err
+	}
+	bi, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if ai.ModTime().After(bi.ModTime()) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+const watchInterval = 250 * time.Millisecond
+
+type fileState struct {
+	mtime time.Time
+	size  int64
+}
+
+// snapshot records the state of path, or of every file below it when it is
+// a directory.
+func snapshot(path string) map[string]fileState {
+	files := map[string]fileState{}
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files[p] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return files
+}
+
+// watchPath polls path and calls onChange with every file that was created,
+// modified or removed. It runs until onChange fails or the interpreter's
+// context is done.
+func watchPath(path string, in *Interpreter, onChange func(string) error) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("watch: %v", err)
+	}
+	ctx := context.Background()
+	if in != nil && in.Ctx != nil {
+		ctx = in.Ctx
+	}
+	prev := snapshot(path)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.New("watch: time limit exceeded")
+			}
+			return errors.New("watch: cancelled")
+		case <-ticker.C:
+		}
+		cur := snapshot(path)
+		var changed []string
+		for p, st := range cur {
+			if old, ok := prev[p]; !ok || old != st {
+				changed = append(changed, p)
+			}
+		}
+		for p := range prev {
+			if _, ok := cur[p]; !ok {
+				changed = append(changed, p)
+			}
+		}
+		prev = cur
+		sort.Strings(changed)
+		for _, p := range changed {
+			if err := onChange(p); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// expandPath replaces $VAR and ${VAR} with environment variables and a
+// leading ~ with the home directory.
+func expandPath(s string) (string, error) {
+	if s == "~" || strings.HasPrefix(s, "~/") || strings.HasPrefix(s, `~\`) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		s = home + s[1:]
+	}
+	return os.ExpandEnv(s), nil
+}
@@ -0,0 +1,120 @@
+package piku
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	formatForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			format, err := strval(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			s, err := sprintf(format, args[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			if op == "format" {
+				return mkstr(s), nil
+			}
+			if _, err := io.WriteString(env.interp.stdout(), s); err != nil {
+				return nil, err
+			}
+			return mknil(), nil
+		}
+	}
+	defEager("core", "format", arity{1, -1}, formatForm("format"))
+	defEager("core", "printf", arity{1, -1}, formatForm("printf"))
+}
+
+// sprintf formats args by the verbs of format, as Go's fmt does, after
+// checking that each argument suits its verb:
+//
+//	%d %b %o %x %X  integers (%x and %X also take strings)
+//	%f %e %g %E %G  numbers
+//	%s %q           strings and symbols
+//	%c              a character code
+//	%v              any value, printed as echo prints it
+//	%t              any value, as true or false by how if treats it
+//
+// Flags, width and precision are passed through, so %5.2f and %-10s work.
+// %% is a literal percent sign.
+func sprintf(format string, args []*Value) (string, error) {
+	var sb strings.Builder
+	next := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j == len(format) {
+			return "", fmt.Errorf("format %q ends in the middle of a verb", format)
+		}
+		spec, verb := format[i:j+1], format[j]
+		i = j
+		if verb == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+		if next == len(args) {
+			return "", fmt.Errorf("format %q needs more arguments than the %d given", format, len(args))
+		}
+		arg, err := formatArg(verb, args[next])
+		if err != nil {
+			return "", fmt.Errorf("argument %d for %s: %v", next+1, spec, err)
+		}
+		next++
+		fmt.Fprintf(&sb, spec, arg)
+	}
+	if next < len(args) {
+		return "", fmt.Errorf("format %q uses %d of %d arguments", format, next, len(args))
+	}
+	return sb.String(), nil
+}
+
+// formatArg converts v to the Go value fmt formats for verb.
+func formatArg(verb byte, v *Value) (any, error) {
+	switch verb {
+	case 'd', 'b', 'o', 'x', 'X', 'c':
+		switch {
+		case v.kind == KindInt:
+			return v.varval, nil
+		case v.kind == KindBigInt && verb != 'c':
+			return v.big(), nil
+		case (verb == 'x' || verb == 'X') && typeof(v) == "string":
+			s, _ := strval(v)
+			return s, nil
+		}
+		return nil, fmt.Errorf("expected integer, got %s", typeof(v))
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if !isNumber(v) {
+			return nil, fmt.Errorf("expected number, got %s", typeof(v))
+		}
+		return floatval(v), nil
+	case 's', 'q':
+		if v.kind == KindSymbol {
+			return v.sym(), nil
+		}
+		s, err := strval(v)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case 'v':
+		if typeof(v) == "string" {
+			s, _ := strval(v)
+			return s, nil
+		}
+		return describe(v), nil
+	case 't':
+		return truthy(v), nil
+	}
+	return nil, fmt.Errorf("unknown verb %%%c", verb)
+}
@@ -0,0 +1,150 @@
+package piku
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The builtins of piku are kept in a table, each registered under a
+// namespace with the numbers of arguments it takes. eval looks the head of
+// a form up in the table, checks that the builtin may run and is given a
+// number of arguments it takes, and runs it. Most builtins are eager: run
+// evaluates their arguments in order and calls them with the values. Only
+// a builtin that is syntax rather than a function is special, handed the
+// node to evaluate what it needs of it itself: set and func, which take
+// names, if, while and try, which evaluate an argument only when they must,
+// and the like.
+//
+// Each builtin is registered by an init function in the file of its
+// feature, the core language in coreforms.go, with an entry in builtinDocs
+// and builtinTypes besides.
+//
+// The namespaces are core, io for files, processes and the rest of the
+// host system, and net for sockets. A restricted interpreter disables io
+// and net, and Interpreter.Disabled can disable any namespace or builtin.
+
+// form is a builtin of piku's own.
+type form struct {
+	// ns is the namespace of the builtin.
+	ns    string
+	arity arity
+	// special is set for a special form and eager for any other.
+	special func(node *Node, env *Env, ln int) (*Value, error, *Env)
+	eager   eagerFn
+}
+
+// eagerFn is the function of an eager form, given the values of the
+// arguments.
+type eagerFn func(args []*Value, env *Env, ln int) (*Value, error)
+
+// forms maps the name of each builtin to its form.
+var forms = map[string]*form{}
+
+// restrictedNamespaces are those of the builtins that touch the host
+// system, which fail when the interpreter is restricted.
+var restrictedNamespaces = map[string]bool{"io": true, "net": true}
+
+// defSpecial registers the special form name in namespace ns.
+func defSpecial(ns, name string, ar arity, fn func(node *Node, env *Env, ln int) (*Value, error, *Env)) {
+	define(name, &form{ns: ns, arity: ar, special: fn})
+}
+
+// defEager registers the eager form name in namespace ns.
+func defEager(ns, name string, ar arity, fn eagerFn) {
+	define(name, &form{ns: ns, arity: ar, eager: fn})
+}
+
+func define(name string, f *form) {
+	if _, ok := forms[name]; ok {
+		panic("builtin " + name + " registered twice")
+	}
+	forms[name] = f
+}
+
+// run evaluates node, a form naming f.
+func (f *form) run(node *Node, env *Env, ln int) (*Value, error, *Env) {
+	if f.special != nil {
+		return f.special(node, env, ln)
+	}
+	args, err, env := evalArgs(node.Children[1:], env, ln)
+	if err != nil {
+		return nil, err, nil
+	}
+	v, err := f.eager(args, env, ln)
+	if err != nil {
+		return nil, err, nil
+	}
+	return v, nil, env
+}
+
+// evalArgs evaluates the argument nodes of a form in order.
+func evalArgs(nodes []*Node, env *Env, ln int) ([]*Value, error, *Env) {
+	args := make([]*Value, 0, len(nodes))
+	for _, a := range nodes {
+		v, err, nenv := eval(a, env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		env = nenv
+		args = append(args, v)
+	}
+	return args, nil, env
+}
+
+// evalOther evaluates node, a form whose head names no builtin of piku's:
+// one added by the host program, or a macro.
+func evalOther(node *Node, env *Env, ln int) (*Value, error, *Env) {
+	if fn, ok := env.interp.native(node.Children[0].Value); ok {
+		return callNative(fn, node, env, ln)
+	}
+	if m, ok := env.get(node.Children[0].Value); ok && m.kind == KindMacro {
+		if ar := m.fn().arity(); !ar.allows(len(node.Children) - 1) {
+			return nil, fmt.Errorf("%s expects %s, got %d, line: %d", node.Children[0].Value, ar, len(node.Children)-1, ln), nil
+		}
+		return expandmacro(m, env, ln, node.Children[1:])
+	}
+	return nil, fmt.Errorf("unknown command: %s, line: %d", node.Children[0].Value, ln), nil
+}
+
+func isBuiltin(name string) bool {
+	_, ok := forms[name]
+	return ok
+}
+
+// builtinArity returns the numbers of arguments the builtin name takes.
+func builtinArity(name string) (arity, bool) {
+	f, ok := forms[name]
+	if !ok {
+		return arity{}, false
+	}
+	return f.arity, true
+}
+
+// builtinNames returns the names of the builtins in namespace ns, or of
+// all of them for "", in order.
+func builtinNames(ns string) []string {
+	var names []string
+	for name, f := range forms {
+		if ns == "" || f.ns == ns {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// namespaces returns the namespaces of the builtins, core first.
+func namespaces() []string {
+	seen := map[string]bool{}
+	for _, f := range forms {
+		seen[f.ns] = true
+	}
+	nss := []string{"core"}
+	for ns := range seen {
+		if ns != "core" {
+			nss = append(nss, ns)
+		}
+	}
+	sort.Strings(nss[1:])
+	return nss
+}
@@ -0,0 +1,26 @@
+package piku
+
+import "testing"
+
+// TestBuiltinTables checks that every builtin in the registry is documented
+// and typed, and that neither table names something that is not a builtin.
+func TestBuiltinTables(t *testing.T) {
+	for _, name := range builtinNames("") {
+		if _, ok := builtinDocs[name]; !ok {
+			t.Errorf("%s has no entry in builtinDocs", name)
+		}
+		if _, ok := builtinTypes[name]; !ok {
+			t.Errorf("%s has no entry in builtinTypes", name)
+		}
+	}
+	for name := range builtinDocs {
+		if _, ok := forms[name]; !ok {
+			t.Errorf("builtinDocs documents %s, which is not a builtin", name)
+		}
+	}
+	for name := range builtinTypes {
+		if _, ok := forms[name]; !ok {
+			t.Errorf("builtinTypes types %s, which is not a builtin", name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package piku
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A generator (KindGenerator) is what calling a function made with genfunc
+// returns. Its body runs on a goroutine of its own, but only while next is
+// waiting for it: next hands over control and blocks until the body
+// yields a value or finishes, and yield blocks until the next call to
+// next. So the body and the code pulling from it never run at once.
+
+func init() {
+	defEager("core", "yield", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if err := yield(v, env, ln); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+	defEager("core", "next", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		g := args[0]
+		if g.kind != KindGenerator {
+			return nil, typeError("generator", g, ln)
+		}
+		v, ok, err := g.gen().next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return mknil(), nil
+		}
+		return v, nil
+	})
+}
+
+type generator struct {
+	body   *Node
+	frame  *Env
+	ln     int
+	resume chan struct{}
+	out    chan genResult
+	// calls is the call stack of the body while it is not running.
+	calls []callFrame
+	// started is set once the body is running, and done once it has
+	// finished or failed.
+	started, done bool
+}
+
+// genResult is what the body hands back to next: a yielded value, or the
+// end of the body with the error it stopped with, if any.
+type genResult struct {
+	val  *Value
+	err  error
+	done bool
+}
+
+func (g *generator) String() string {
+	return "generator"
+}
+
+// newGenerator returns the generator that runs body in frame, the scope
+// holding the arguments of the call.
+func newGenerator(body *Node, frame *Env, ln int) *Value {
+	g := &generator{body: body, frame: frame, ln: ln, resume: make(chan struct{}), out: make(chan genResult)}
+	frame.gen = g
+	return &Value{kind: KindGenerator, ref: g}
+}
+
+// run evaluates the body on the generator's goroutine.
+func (g *generator) run() {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error in generator: %v, line: %d", r, g.ln)
+		}
+		g.out <- genResult{err: err, done: true}
+	}()
+	_, err, _ = eval(g.body, g.frame, g.ln)
+	if c, ok := err.(*control); ok {
+		// return ends the generator; break and continue do not reach
+		// loops outside it.
+		err = nil
+		if c.kind != "return" {
+			err = errors.New(c.Error())
+		}
+	}
+}
+
+// next resumes the body and returns the next value it yields. ok is false
+// once the body has finished.
+func (g *generator) next() (v *Value, ok bool, err error) {
+	if g.done {
+		return nil, false, nil
+	}
+	in := g.frame.interp
+	defer in.exclude()()
+	// The body has a call stack of its own.
+	caller := in.swapCalls(g.calls)
+	if !g.started {
+		g.started = true
+		go g.run()
+	} else {
+		g.resume <- struct{}{}
+	}
+	r := <-g.out
+	g.calls = in.swapCalls(caller)
+	if r.done {
+		g.done = true
+		return nil, false, r.err
+	}
+	return r.val, true, nil
+}
+
+// yield hands v to the next call waiting on the generator whose body env
+// is in, and waits to be resumed.
+func yield(v *Value, env *Env, ln int) error {
+	for e := env; e != nil; e = e.parent {
+		if e.gen != nil {
+			if !e.gen.started || e.gen.done {
+				break
+			}
+			e.gen.out <- genResult{val: v}
+			<-e.gen.resume
+			return nil
+		}
+	}
+	return fmt.Errorf("yield outside a generator, line: %d", ln)
+}
+
+// genSeq is the sequence of the values g yields from now on.
+func genSeq(g *generator) *lazySeq {
+	return &lazySeq{thunk: func() (*lazyCell, error) {
+		v, ok, err := g.next()
+		if !ok {
+			return nil, err
+		}
+		return &lazyCell{v, genSeq(g)}, nil
+	}}
+}
@@ -0,0 +1,197 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// piku get fetches a library into piku_modules, from a URL of a single .pi
+// file or from a git repository, and records it in piku.lock as a line
+//
+//	name source version
+//
+// where version is the commit for a repository and the SHA-256 of the
+// file for a URL. piku get with no arguments fetches everything in the
+// lockfile at the recorded versions, so a project can share its libraries
+// by committing piku.lock and ignoring piku_modules.
+
+const lockFile = "piku.lock"
+
+type lockEntry struct {
+	name, source, version string
+}
+
+// readLock returns the entries of the lockfile, or none if there is none.
+func readLock() ([]lockEntry, error) {
+	data, err := os.ReadFile(lockFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []lockEntry
+	for i, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected name, source and version", lockFile, i+1)
+		}
+		entries = append(entries, lockEntry{f[0], f[1], f[2]})
+	}
+	return entries, nil
+}
+
+func writeLock(entries []lockEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s %s %s\n", e.name, e.source, e.version)
+	}
+	return os.WriteFile(lockFile, []byte(b.String()), 0644)
+}
+
+func isFileURL(source string) bool {
+	return isURL(source) && strings.HasSuffix(source, ".pi")
+}
+
+// libraryName is the name a source is fetched under by default: the last
+// element of its path without the extension.
+func libraryName(source string) string {
+	name := path.Base(strings.TrimSuffix(source, "/"))
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".pi"), ".git")
+}
+
+// install fetches source into piku_modules/name and returns its version.
+// For a repository, version selects the commit to check out; for a URL, a
+// non-empty version is the hash the file must have.
+func install(name, source, version string) (string, error) {
+	if err := os.MkdirAll(modulesDir, 0755); err != nil {
+		return "", err
+	}
+	// Fetch into a new directory and only then replace the old copy, so
+	// a failed fetch leaves what was there.
+	tmp, err := os.MkdirTemp(modulesDir, "."+name+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if isFileURL(source) {
+		data, err := fetch(source)
+		if err != nil {
+			return "", err
+		}
+		got := sourceSum(data)
+		if version != "" && got != version {
+			return "", fmt.Errorf("%s: the file has changed since it was locked (%s, locked %s)", source, got, version)
+		}
+		version = got
+		if err := os.WriteFile(filepath.Join(tmp, name+".pi"), data, 0644); err != nil {
+			return "", err
+		}
+	} else {
+		git := func(dir string, args ...string) (string, error) {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				return "", fmt.Errorf("git %s: %v\n%s", args[0], err, out)
+			}
+			return strings.TrimSpace(string(out)), nil
+		}
+		if _, err := git("", "clone", "--quiet", source, tmp); err != nil {
+			return "", err
+		}
+		if version != "" {
+			if _, err := git(tmp, "checkout", "--quiet", version); err != nil {
+				return "", err
+			}
+		}
+		if version, err = git(tmp, "rev-parse", "HEAD"); err != nil {
+			return "", err
+		}
+		// The library is a copy, not a checkout to work in.
+		if err := os.RemoveAll(filepath.Join(tmp, ".git")); err != nil {
+			return "", err
+		}
+	}
+	dest := filepath.Join(modulesDir, name)
+	if err := os.RemoveAll(dest); err != nil {
+		return "", err
+	}
+	return version, os.Rename(tmp, dest)
+}
+
+// getCmd implements "piku get [source] [--name name] [--ref ref]".
+func getCmd(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	name := fs.String("name", "", "name to import the library by (default from the source)")
+	ref := fs.String("ref", "", "branch, tag or commit of a repository to fetch")
+	var source string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		source, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if source == "" && fs.NArg() > 0 {
+		source = fs.Arg(0)
+	}
+	if fs.NArg() > 1 || (source == "" && (*name != "" || *ref != "")) {
+		return errors.New("usage: piku get [source] [--name name] [--ref ref]")
+	}
+	entries, err := readLock()
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		if len(entries) == 0 {
+			return fmt.Errorf("no %s to fetch from; give a URL or repository", lockFile)
+		}
+		for _, e := range entries {
+			if !projectName.MatchString(e.name) {
+				return fmt.Errorf("%s: %q is not a valid library name", lockFile, e.name)
+			}
+			if _, err := install(e.name, e.source, e.version); err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", e.name, e.version)
+		}
+		return nil
+	}
+	if *name == "" {
+		*name = libraryName(source)
+	}
+	if !projectName.MatchString(*name) {
+		return fmt.Errorf("library name %q must be a valid identifier so it can be imported; choose one with --name", *name)
+	}
+	if *ref != "" && isFileURL(source) {
+		return errors.New("--ref only applies to a repository")
+	}
+	version, err := install(*name, source, *ref)
+	if err != nil {
+		return err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.name != *name {
+			kept = append(kept, e)
+		}
+	}
+	fmt.Printf("%s %s\n", *name, version)
+	return writeLock(append(kept, lockEntry{*name, source, version}))
+}
@@ -0,0 +1,227 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// piku grade runs a student's program against a spec written in piku. The
+// spec binds two names:
+//
+//	required  a list of function names the program must define
+//	tests     a list of dicts, one per test, with the keys
+//	            func    the name of the function to call
+//	            args    a list of arguments (default none)
+//	            expect  the value the call must return
+//	            output  the text the call must print
+//	            points  what the test is worth (default 1)
+//
+// A test needs expect, output or both. The program and every test run
+// restricted, with a step and a time limit, and the result is a JSON
+// report on stdout. A program that fails part way still has the functions
+// it defined before the failure tested.
+
+type gradeTest struct {
+	fn     string
+	args   []*Value
+	expect *Value
+	output *string
+	points int
+}
+
+type gradeReport struct {
+	Score     int               `json:"score"`
+	MaxScore  int               `json:"max_score"`
+	LoadError string            `json:"load_error,omitempty"`
+	Missing   []string          `json:"missing,omitempty"`
+	Tests     []gradeTestResult `json:"tests"`
+}
+
+type gradeTestResult struct {
+	Func     string `json:"func"`
+	Args     string `json:"args"`
+	Passed   bool   `json:"passed"`
+	Points   int    `json:"points"`
+	Expected string `json:"expected,omitempty"`
+	Got      string `json:"got,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// loadSpec runs the spec file and reads its required list and tests.
+func loadSpec(path string) ([]string, []gradeTest, error) {
+	env := newEnv(&Interpreter{Restricted: true})
+	env.interp.Stdout = io.Discard
+	_, err := runfile(path, env)
+	if err != nil {
+		return nil, nil, fmt.Errorf("spec: %v", err)
+	}
+	var required []string
+	if v, ok := env.get("required"); ok {
+		if required, err = strlist(v); err != nil {
+			return nil, nil, fmt.Errorf("spec: required: %v", err)
+		}
+	}
+	v, ok := env.get("tests")
+	if !ok || v.kind != KindList {
+		return nil, nil, errors.New("spec: tests must be bound to a list of dicts")
+	}
+	var tests []gradeTest
+	for i, d := range *v.listval {
+		if d.kind != KindDict {
+			return nil, nil, fmt.Errorf("spec: test %d is a %s, not a dict", i+1, typename(&d))
+		}
+		t := gradeTest{points: 1}
+		fn, ok := d.dictval["func"]
+		if !ok {
+			return nil, nil, fmt.Errorf("spec: test %d has no func", i+1)
+		}
+		if t.fn, err = strval(&fn); err != nil {
+			return nil, nil, fmt.Errorf("spec: test %d: func: %v", i+1, err)
+		}
+		if args, ok := d.dictval["args"]; ok {
+			if args.kind != KindList {
+				return nil, nil, fmt.Errorf("spec: test %d: args must be a list", i+1)
+			}
+			for j := range *args.listval {
+				t.args = append(t.args, &(*args.listval)[j])
+			}
+		}
+		if e, ok := d.dictval["expect"]; ok {
+			t.expect = &e
+		}
+		if o, ok := d.dictval["output"]; ok {
+			s, err := strval(&o)
+			if err != nil {
+				return nil, nil, fmt.Errorf("spec: test %d: output: %v", i+1, err)
+			}
+			t.output = &s
+		}
+		if t.expect == nil && t.output == nil {
+			return nil, nil, fmt.Errorf("spec: test %d needs expect or output", i+1)
+		}
+		if p, ok := d.dictval["points"]; ok {
+			if p.kind != KindInt || p.varval < 0 {
+				return nil, nil, fmt.Errorf("spec: test %d: points must be a number of at least 0", i+1)
+			}
+			t.points = p.varval
+		}
+		tests = append(tests, t)
+	}
+	return required, tests, nil
+}
+
+// limited runs f under the limits of in, capturing what it prints and
+// turning a panic into an error.
+func limited(in *Interpreter, timeout time.Duration, f func() error) (out string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	in.Ctx, in.steps = ctx, 0
+	var buf bytes.Buffer
+	saved := in.Stdout
+	in.Stdout = &buf
+	defer func() {
+		in.Stdout = saved
+		if r := recover(); r != nil {
+			err = fmt.Errorf("internal error: %v", r)
+		}
+		out = buf.String()
+	}()
+	err = f()
+	return
+}
+
+func runTest(t gradeTest, env *Env, in *Interpreter, timeout time.Duration) gradeTestResult {
+	args := make([]string, len(t.args))
+	for i, a := range t.args {
+		args[i] = describe(a)
+	}
+	res := gradeTestResult{Func: t.fn, Args: "[" + strings.Join(args, " ") + "]"}
+	if t.expect != nil {
+		res.Expected = describe(t.expect)
+	}
+	f, ok := env.get(t.fn)
+	if !ok || f.kind != KindFunc {
+		res.Error = t.fn + " is not defined as a function"
+		return res
+	}
+	var got *Value
+	out, err := limited(in, timeout, func() error {
+		var err error
+		got, err, _ = applyfunc(f, t.args, env, 0)
+		return err
+	})
+	res.Output = out
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Got = describe(got)
+	res.Passed = (t.expect == nil || equal(got, t.expect)) && (t.output == nil || out == *t.output)
+	if res.Passed {
+		res.Points = t.points
+	}
+	return res
+}
+
+// gradeCmd implements "piku grade assignment.pi --spec spec.pi".
+func gradeCmd(args []string) error {
+	fs := flag.NewFlagSet("grade", flag.ContinueOnError)
+	spec := fs.String("spec", "", "spec file with the required functions and tests")
+	timeout := fs.Duration("timeout", 2*time.Second, "time limit for loading the program and for each test")
+	maxSteps := fs.Int("max-steps", 1000000, "step limit for loading the program and for each test")
+	var src string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		src, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if src == "" && fs.NArg() > 0 {
+		src = fs.Arg(0)
+	}
+	if src == "" || *spec == "" {
+		return errors.New("usage: piku grade assignment.pi --spec spec.pi")
+	}
+	required, tests, err := loadSpec(*spec)
+	if err != nil {
+		return err
+	}
+	report := &gradeReport{Tests: []gradeTestResult{}}
+	for _, t := range tests {
+		report.MaxScore += t.points
+	}
+	in := &Interpreter{Restricted: true, MaxSteps: *maxSteps}
+	env := newEnv(in)
+	if _, err := limited(in, *timeout, func() error {
+		_, err := runfile(src, env)
+		return err
+	}); err != nil {
+		report.LoadError = err.Error()
+	}
+	for _, name := range required {
+		if f, ok := env.get(name); !ok || f.kind != KindFunc {
+			report.Missing = append(report.Missing, name)
+		}
+	}
+	// Tests still run after a load error, for partial credit on whatever
+	// was defined before it.
+	for _, t := range tests {
+		res := runTest(t, env, in, *timeout)
+		report.Score += res.Points
+		report.Tests = append(report.Tests, res)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,106 @@
+package piku
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf8"
+)
+
+func init() {
+	hashForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v := args[0]
+			data, err := strval(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			return mkstr(digest(op, data)), nil
+		}
+	}
+	defEager("core", "sha256", arity{1, 1}, hashForm("sha256"))
+	defEager("core", "sha1", arity{1, 1}, hashForm("sha1"))
+	defEager("core", "md5", arity{1, 1}, hashForm("md5"))
+	defEager("core", "hmac", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		k, v := args[0], args[1]
+		key, err := strval(k)
+		if err != nil {
+			return nil, fmt.Errorf("hmac: key: %v, line: %d", err, ln)
+		}
+		data, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("hmac: %v, line: %d", err, ln)
+		}
+		return mkstr(hmacSHA256(key, data)), nil
+	})
+	encodingForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v := args[0]
+			s, err := strval(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			switch op {
+			case "b64encode":
+				return mkstr(base64.StdEncoding.EncodeToString([]byte(s))), nil
+			case "hexencode":
+				return mkstr(hex.EncodeToString([]byte(s))), nil
+			}
+			s, err = decodeText(op, s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			return mkstr(s), nil
+		}
+	}
+	defEager("core", "b64encode", arity{1, 1}, encodingForm("b64encode"))
+	defEager("core", "hexencode", arity{1, 1}, encodingForm("hexencode"))
+	defEager("core", "b64decode", arity{1, 1}, encodingForm("b64decode"))
+	defEager("core", "hexdecode", arity{1, 1}, encodingForm("hexdecode"))
+}
+
+// hashes are the digests the sha256, sha1 and md5 builtins compute.
+var hashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// digest returns the hex digest of data under the hash named op.
+func digest(op string, data string) string {
+	h := hashes[op]()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hmacSHA256 returns the hex HMAC-SHA256 of data under key.
+func hmacSHA256(key, data string) string {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte(data))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// decodeText decodes s with the encoding named op and returns the result
+// as text.
+func decodeText(op, s string) (string, error) {
+	var data []byte
+	var err error
+	if op == "b64decode" {
+		data, err = base64.StdEncoding.DecodeString(s)
+	} else {
+		data, err = hex.DecodeString(s)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", errors.New("decoded data is not UTF-8 text")
+	}
+	return string(data), nil
+}
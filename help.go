@@ -0,0 +1,297 @@
+package piku
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// help prints the documentation of a builtin or of a function, which may
+// give its own as a string between its parameters and its body:
+//
+//	[set greet [func [who] "Greets who by name." [format "Hello, %v" who]]]
+
+// builtinDoc describes a builtin: the arguments it is written with and
+// what it does.
+type builtinDoc struct {
+	args string
+	text string
+}
+
+var builtinDocs = map[string]builtinDoc{
+	"abs":                {"x", "Returns the absolute value of x."},
+	"add":                {"a b", "Returns a plus b."},
+	"append":             {"lst x", "Returns lst with x added at the end, leaving lst as it was. A persistent list shares its elements with the new one; any other is copied."},
+	"apply":              {"f lst", "Calls the function f with the elements of lst as its arguments."},
+	"assert":             {"cond msg?", "Fails with msg unless cond is true."},
+	"asserteq":           {"got want msg?", "Fails with msg unless got equals want."},
+	"atomic":             {"n?", "Returns an atomic counter starting at n, or 0."},
+	"atomicadd":          {"counter n", "Adds n to an atomic counter and returns the new value."},
+	"b64decode":          {"s", "Decodes the base64 string s."},
+	"b64encode":          {"s", "Encodes s as base64."},
+	"band":               {"a b", "Returns the bitwise and of a and b."},
+	"bench":              {"n expr name?", "Evaluates expr n times and returns a dict of the runs, the min, avg and max time in milliseconds and the allocations per run."},
+	"bnot":               {"a", "Returns the bitwise complement of a."},
+	"bor":                {"a b", "Returns the bitwise or of a and b."},
+	"break":              {"", "Leaves the innermost loop."},
+	"bxor":               {"a b", "Returns the bitwise exclusive or of a and b."},
+	"cache-get":          {"cache key", "Returns the value stored under key in a ttlcache, or nil once it has expired."},
+	"cache-put":          {"cache key value", "Stores value under key in a ttlcache."},
+	"call":               {"f arg...", "Calls the function f with the arguments, which may be passed by name as [param value]."},
+	"ceil":               {"x", "Rounds x up to an integer."},
+	"chan":               {"size?", "Returns a channel buffering size values, or none."},
+	"choose":             {"prompt options", "Asks the user to pick one of the options and returns it."},
+	"clipget":            {"", "Returns the text on the clipboard."},
+	"clipset":            {"s", "Puts s on the clipboard."},
+	"compose":            {"f g...", "Returns a function that calls the last function with its arguments and each one before on the result, so [call [compose f g] x] is [call f [call g x]]."},
+	"concat":             {"lst...", "Returns the lists joined into one."},
+	"const":              {"name value", "Binds name to value for good; it cannot be set again."},
+	"contains":           {"lst x", "Returns 1 if lst has an element equal to x, else 0."},
+	"continue":           {"", "Starts the next round of the innermost loop."},
+	"coroutine":          {"f", "Returns a coroutine that runs f when first resumed."},
+	"copy":               {"x", "Returns a copy of x with lists, tuples, dicts and sets of its own, which edit and set-add change without changing x."},
+	"csvread":            {"path", "Reads a CSV file into a list of rows of strings."},
+	"csvwrite":           {"path rows", "Writes a list of rows to a CSV file."},
+	"default":            {"expr fallback", "Returns expr, or fallback if expr fails or is nil."},
+	"dict":               {"[key value]...", "Returns a dict of the entries."},
+	"diff":               {"a b", "Returns a [path left right] entry for every place where a and b differ."},
+	"div":                {"a b", "Returns a divided by b."},
+	"divmod":             {"a b", "Returns the quotient and remainder of a divided by b as a tuple."},
+	"echo":               {"x", "Prints x and a newline."},
+	"echostr":            {"x", "Prints x and a newline, showing a list of character codes as text even under --char-lists."},
+	"edit":               {"name i value", "Sets element i of the list in name to value. A persistent list is left as it was and name bound to a new version."},
+	"elapsed":            {"expr", "Evaluates expr and returns its value and the milliseconds it took as a tuple."},
+	"errcode":            {"err", "Returns the code of an error value."},
+	"errmsg":             {"err", "Returns the message of an error value."},
+	"error":              {"code msg", "Returns an error value, for raise."},
+	"errtrace":           {"err", "Returns the calls in progress when err was raised, innermost first."},
+	"eval":               {"code", "Evaluates quoted code in the current scope."},
+	"exec":               {"cmd args [timeout s]? [env vars]?", "Runs a program and returns a dict of its status, stdout and stderr."},
+	"exit":               {"status", "Ends the program with status, from 0 to 255."},
+	"expand":             {"s", "Replaces $VAR and ${VAR} in s with environment variables and a leading ~ with the home directory."},
+	"find":               {"f lst", "Returns the first element of lst for which f is true, or nil."},
+	"flatten":            {"lst", "Joins the lists in lst into one, one level deep."},
+	"floor":              {"x", "Rounds x down to an integer."},
+	"foreach":            {"name lst body", "Evaluates body with name bound to each element of lst in turn."},
+	"format":             {"fmt arg...", "Returns fmt with each %v replaced by the next argument."},
+	"format-locale":      {"x locale", "Formats the number x the way locale writes numbers."},
+	"format-locale-date": {"t locale", "Formats the time t the way locale writes dates."},
+	"func":               {"[param...] doc? body", "Returns a function. A param is a name, [name default], [name type] or [name type default]."},
+	"genfunc":            {"[param...] doc? body", "Returns a function whose calls return a generator running body."},
+	"get":                {"d key", "Returns the value of key in the dict d, or nil."},
+	"glob":               {"pattern", "Returns the paths matching a shell pattern."},
+	"gunzip":             {"data", "Decompresses gzipped bytes."},
+	"gzip":               {"data", "Compresses bytes with gzip."},
+	"help":               {"name?", "Prints the documentation of a builtin or function, or with no name lists the builtins."},
+	"hexdecode":          {"s", "Decodes the hexadecimal string s."},
+	"hexencode":          {"s", "Encodes s as hexadecimal."},
+	"hmac":               {"key s", "Returns the HMAC-SHA256 of s under key, in hexadecimal."},
+	"if":                 {"cond then else", "Evaluates then if cond is true, else else."},
+	"import":             {"name hash?", "Runs a module file, or a URL checked against hash, in the current scope. A URL without a hash is revalidated on every run, its cached copy used when the server cannot be reached."},
+	"importdata":         {"path name?", "Reads a .json or .toml file into dicts and lists and binds it to name, or to the file name without its extension."},
+	"index":              {"lst i", "Returns element i of lst; negative indices count from the end."},
+	"isnil":              {"x", "Returns 1 if x is nil, else 0."},
+	"lazymap":            {"f seq", "Returns a lazy sequence of f applied to each element of seq."},
+	"lazyrange":          {"start end?", "Returns a lazy sequence of the integers from start up to end, or without end."},
+	"list":               {"x...", "Returns a list of the arguments."},
+	"loadplugin":         {"path", "Loads a Go plugin and adds the builtins it registers."},
+	"lock":               {"m", "Locks a mutex, waiting until it is free."},
+	"log-debug":          {"msg", "Writes msg to standard error as a timestamped DEBUG line, if --log-level is debug."},
+	"log-error":          {"msg", "Writes msg to standard error as a timestamped ERROR line."},
+	"log-info":           {"msg", "Writes msg to standard error as a timestamped INFO line, unless --log-level is above info."},
+	"log-warn":           {"msg", "Writes msg to standard error as a timestamped WARN line, unless --log-level is error."},
+	"macro":              {"name [param...] template", "Defines a macro, whose template builds the code to run from the unevaluated arguments."},
+	"max":                {"x...", "Returns the largest of the arguments."},
+	"md5":                {"s", "Returns the MD5 digest of s in hexadecimal."},
+	"memoize":            {"f", "Returns a copy of f that caches its results."},
+	"millis":             {"", "Returns the milliseconds since the Unix epoch."},
+	"min":                {"x...", "Returns the smallest of the arguments."},
+	"mod":                {"a b", "Returns the remainder of a divided by b."},
+	"mul":                {"a b", "Returns a times b."},
+	"mutex":              {"", "Returns a new mutex."},
+	"neg":                {"x", "Returns minus x."},
+	"newer":              {"a b", "Returns 1 if the file a was modified after b or b does not exist, else 0."},
+	"newline":            {"", "Prints a newline."},
+	"next":               {"gen", "Returns the next value of a generator."},
+	"now":                {"", "Returns the current time."},
+	"partial":            {"f arg...", "Returns a function that calls f with the arguments given here followed by its own."},
+	"pipeline":           {"[cmd arg...]...", "Runs the commands with the output of each piped to the next and returns the last one's output."},
+	"plist":              {"x...", "Returns a persistent list of the arguments, which append and edit make new versions of without copying it."},
+	"pmap":               {"f lst", "Returns f applied to each element of lst, calling it on several goroutines at once."},
+	"pow":                {"a b", "Returns a to the power b."},
+	"print":              {"x", "Prints the string x, or any other value as echo shows it, without a newline."},
+	"printchar":          {"c", "Prints the character with code c."},
+	"printf":             {"fmt arg...", "Prints fmt with each %v replaced by the next argument."},
+	"printtable":         {"rows headers", "Prints rows as a table under the headers."},
+	"prockill":           {"proc", "Kills a process started with spawnproc."},
+	"procstdout":         {"proc f", "Calls f with each line a process writes to its stdout."},
+	"procwait":           {"proc", "Waits for a process to end and returns its exit status."},
+	"progress":           {"total", "Returns a progress bar counting up to total."},
+	"progress-tick":      {"bar", "Moves a progress bar one step on."},
+	"quote":              {"x", "Returns x as data, unevaluated."},
+	"raise":              {"err", "Raises an error value for try to catch."},
+	"range":              {"lst from to", "Returns the elements of lst from index from up to to; a to of 0 means the end."},
+	"ratelimit":          {"n", "Returns a limiter allowing n calls a second."},
+	"ratelimit-wait":     {"limiter", "Waits until the limiter allows another call."},
+	"recv":               {"ch", "Receives a value from a channel, waiting for one if need be."},
+	"refindall":          {"pattern s", "Returns every match of the regular expression in s."},
+	"rematch":            {"pattern s", "Returns the first match of the regular expression in s and its groups, or nil."},
+	"rereplace":          {"pattern s repl", "Replaces every match of the regular expression in s with repl."},
+	"resume":             {"co x?", "Runs a coroutine until it suspends, passing it x, and returns what it suspended with."},
+	"retry":              {"n delay f", "Calls f until it succeeds, at most n times, waiting delay milliseconds between tries."},
+	"return":             {"x", "Returns x from the function being run."},
+	"reverse":            {"lst", "Returns lst in reverse order."},
+	"round":              {"x mode", "Rounds x to an integer by mode: half-up, half-even, floor or ceil."},
+	"savestate":          {"path", "Writes the global variables to path. Fails, naming the variable, for a value that cannot be saved: a closure over local variables, a function made by compose or partial, or a handle."},
+	"semver-cmp":         {"a b", "Compares two semantic versions, returning -1, 0 or 1."},
+	"semver-parse":       {"v", "Returns the parts of a semantic version as a dict, or nil."},
+	"semver-satisfies":   {"v constraint", "Returns 1 if the version v meets the constraint, else 0."},
+	"send":               {"ch x", "Sends x on a channel, waiting for room if need be."},
+	"set":                {"name value", "Binds name to value in the current scope."},
+	"set-add":            {"s x", "Adds x to the set s."},
+	"set-has":            {"s x", "Returns 1 if the set s holds x, else 0."},
+	"set-intersect":      {"a b", "Returns the elements in both sets."},
+	"set-new":            {"x...", "Returns a set of the arguments."},
+	"set-union":          {"a b", "Returns the elements in either set."},
+	"setmany":            {"[name...] lst", "Binds each name to the element of lst in the same place."},
+	"sha1":               {"s", "Returns the SHA-1 digest of s in hexadecimal."},
+	"sha256":             {"s", "Returns the SHA-256 digest of s in hexadecimal."},
+	"shl":                {"a n", "Shifts a left by n bits."},
+	"shr":                {"a n", "Shifts a right by n bits."},
+	"sleep":              {"ms", "Waits for ms milliseconds."},
+	"sort":               {"lst", "Returns lst in ascending order."},
+	"sortby":             {"f lst", "Returns lst sorted by f, which is true when its first argument goes first."},
+	"spawn":              {"f arg...", "Calls f with the arguments on a new task."},
+	"spawnproc":          {"cmd args", "Starts a program and returns a handle to it."},
+	"sqrt":               {"x", "Returns the square root of x."},
+	"stat":               {"path", "Returns a dict describing a file."},
+	"stats":              {"", "Returns a dict of what the run has cost so far: the nodes evaluated, function calls, values made and the most variables in one scope."},
+	"sub":                {"a b", "Returns a minus b."},
+	"suspend":            {"x?", "Suspends the running coroutine, handing x to resume."},
+	"take":               {"n seq", "Returns the first n elements of a list, sequence or generator."},
+	"tcpaccept":          {"listener", "Waits for a connection on a listener and returns it."},
+	"tcpclose":           {"conn", "Closes a connection or listener."},
+	"tcpconnect":         {"host port", "Connects to a TCP port."},
+	"tcplisten":          {"port", "Listens on a TCP port."},
+	"tcprecv":            {"conn n", "Reads at most n bytes from a connection."},
+	"tcpsend":            {"conn s", "Writes s to a connection."},
+	"tempdir":            {"", "Creates a temporary directory and returns its path."},
+	"tempfile":           {"pattern", "Creates a temporary file named after pattern and returns its path."},
+	"timediff":           {"a b", "Returns the seconds from time b to time a."},
+	"timeformat":         {"t layout", "Formats the time t by a Go time layout."},
+	"timeparse":          {"s layout", "Parses s as a time by a Go time layout."},
+	"trap":               {"signal f", "Calls f, with the signal name if it takes an argument, when the program gets SIGINT or SIGTERM, instead of failing with an interrupted error."},
+	"try":                {"expr name handler", "Evaluates expr, or handler with name bound to the error if expr fails."},
+	"try-getpath":        {"d path fallback", "Follows the keys and indices in path into d, returning fallback if one is missing."},
+	"ttlcache":           {"seconds", "Returns a cache whose entries expire after seconds."},
+	"tuple":              {"x...", "Returns a tuple of the arguments."},
+	"typeof":             {"x", "Returns the name of the type of x."},
+	"unlock":             {"m", "Unlocks a mutex."},
+	"validate":           {"x schema", "Returns a list of the places where x does not match schema: a type such as number or string, [listof s], [tuple s...], [dict key s...] or [oneof s...]."},
+	"wait":               {"wg", "Waits until a waitgroup's counter is back to zero."},
+	"waitgroup":          {"", "Returns a new waitgroup."},
+	"watch":              {"path f", "Calls f with the path of each file that changes under path."},
+	"wgadd":              {"wg n", "Adds n to a waitgroup's counter."},
+	"wgdone":             {"wg", "Takes one from a waitgroup's counter."},
+	"while":              {"cond body", "Evaluates body for as long as cond is true."},
+	"yield":              {"x", "Hands x to the caller of next from a generator."},
+	"zip":                {"lst...", "Returns a list of tuples of the elements in the same place of each list."},
+	"zipcreate":          {"path files", "Writes the files into a zip archive at path."},
+	"zipextract":         {"path dir", "Extracts a zip archive into dir."},
+	"ziplist":            {"path", "Returns the names of the files in a zip archive."},
+}
+
+// paramSource renders parameter i of f as it is written.
+func paramSource(f *Function, i int) string {
+	var def *Node
+	if i < len(f.Defaults) {
+		def = f.Defaults[i]
+	}
+	typ := ""
+	if i < len(f.Types) {
+		typ = f.Types[i]
+	}
+	if def == nil && typ == "" {
+		return f.Args[i]
+	}
+	parts := []string{f.Args[i]}
+	if typ != "" {
+		parts = append(parts, typ)
+	}
+	if def != nil {
+		parts = append(parts, nodeSource(def))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// usage renders a call: the words of the call, then the arguments.
+func usage(words []string, args ...string) string {
+	for _, a := range args {
+		if a != "" {
+			words = append(words, a)
+		}
+	}
+	return "[" + strings.Join(words, " ") + "]"
+}
+
+// helpText returns the documentation of name, which may be a function or
+// macro bound in env or a builtin.
+func helpText(name string, env *Env) (string, bool) {
+	if v, ok := env.get(name); ok && (v.kind == KindFunc || v.kind == KindMacro) {
+		words := []string{"call", name}
+		if v.kind == KindMacro {
+			words = []string{name}
+		}
+		for i := range v.fn().Args {
+			words = append(words, paramSource(v.fn(), i))
+		}
+		doc := v.fn().Doc
+		if doc == "" {
+			doc = "No documentation."
+		}
+		return usage(words) + "\n" + doc, true
+	}
+	if _, ok := env.interp.native(name); ok {
+		return usage([]string{name}, "arg...") + "\nA builtin added by the host program.", true
+	}
+	d, ok := builtinDocs[name]
+	if !ok {
+		return "", false
+	}
+	text := usage([]string{name}, d.args)
+	if sig, ok := builtinTypes[name]; ok && sig.result != "any" && sig.result != "nil" {
+		text += " -> " + sig.result
+	}
+	return text + "\n" + d.text, true
+}
+
+// replHelp answers :help in the REPL, with the documentation of a name or,
+// given none, the names of the builtins.
+func replHelp(arg string, env *Env) {
+	if arg != "" {
+		if text, ok := helpText(arg, env); ok {
+			fmt.Fprintln(env.interp.stdout(), text)
+		} else {
+			fmt.Printf("no builtin or function named %s\n", arg)
+		}
+		return
+	}
+	fmt.Println(":help NAME shows the documentation of a builtin or function.")
+	listBuiltins(env.interp.stdout())
+}
+
+// listBuiltins writes the names of the builtins to w, by namespace.
+func listBuiltins(w io.Writer) {
+	for _, ns := range namespaces() {
+		fmt.Fprintf(w, "The %s builtins:\n", ns)
+		line := ""
+		for _, name := range builtinNames(ns) {
+			if line != "" && len(line)+len(name) > 76 {
+				fmt.Fprintln(w, " "+line)
+				line = ""
+			}
+			line += " " + name
+		}
+		fmt.Fprintln(w, " "+line)
+	}
+}
@@ -0,0 +1,146 @@
+package piku
+
+import "fmt"
+
+// [expr 1 + 2 * x] writes arithmetic with infix operators. The parser
+// lowers it to the forms it stands for, here [add 1 [mul 2 x]], so that
+// it costs nothing at run time. Operands are literals, names and forms in
+// brackets; parentheses group, as in [expr (1 + 2) * x]. Since a name may
+// contain '-', a minus between names needs spaces around it: a-b is a
+// name, a - b a subtraction.
+
+// infixOp is a binary operator: the form it becomes and how tightly it
+// binds, higher first. Operators of the same precedence group to the
+// left unless right is set.
+type infixOp struct {
+	form  string
+	prec  int
+	right bool
+}
+
+var infixOps = map[string]infixOp{
+	"|":  {"bor", 1, false},
+	"^":  {"bxor", 2, false},
+	"&":  {"band", 3, false},
+	"<<": {"shl", 4, false},
+	">>": {"shr", 4, false},
+	"+":  {"add", 5, false},
+	"-":  {"sub", 5, false},
+	"*":  {"mul", 6, false},
+	"/":  {"div", 6, false},
+	"%":  {"mod", 6, false},
+	"**": {"pow", 8, true},
+}
+
+// prefixOps are the unary operators, which bind tighter than any binary
+// one but **, so that -2 ** 2 is -4.
+var prefixOps = map[string]string{"-": "neg", "~": "bnot"}
+
+const prefixPrec = 7
+
+// operators lists the operator tokens, longest first so that ** is not
+// read as two *.
+var operators = []string{"**", "<<", ">>", "|", "^", "&", "+", "-", "*", "/", "%", "~"}
+
+// scanOperator returns the length of the operator at the start of s, or
+// 0 if there is none.
+func scanOperator(s string) int {
+	for _, op := range operators {
+		if len(s) >= len(op) && s[:len(op)] == op {
+			return len(op)
+		}
+	}
+	return 0
+}
+
+// exprParser reads the operands and operators of an expr form.
+type exprParser struct {
+	nodes []*Node
+	pos   int
+}
+
+// lowerExpr returns the form that an expr form, or a group in one, stands
+// for. nodes are its operands and operators.
+func lowerExpr(form *Node, nodes []*Node) (*Node, error) {
+	if len(nodes) == 0 {
+		return nil, &Diagnostic{Line: form.Line, Col: form.Col, Msg: "expr expects an expression"}
+	}
+	return (&exprParser{nodes: nodes}).parse()
+}
+
+// parse reads a whole expression, which must use up every node.
+func (p *exprParser) parse() (*Node, error) {
+	n, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.nodes) {
+		next := p.nodes[p.pos]
+		return nil, &Diagnostic{Line: next.Line, Col: next.Col, Msg: fmt.Sprintf("expr expects an operator before %s", nodeSource(next))}
+	}
+	return n, nil
+}
+
+// binary reads operands joined by operators binding at least as tightly
+// as prec.
+func (p *exprParser) binary(prec int) (*Node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.nodes) {
+		opNode := p.nodes[p.pos]
+		op, ok := infixOps[opNode.Value]
+		if opNode.Type != "OPERATOR" || !ok || op.prec < prec {
+			break
+		}
+		p.pos++
+		next := op.prec + 1
+		if op.right {
+			next = op.prec
+		}
+		right, err := p.binary(next)
+		if err != nil {
+			return nil, err
+		}
+		left = operation(opNode, op.form, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (*Node, error) {
+	if p.pos == len(p.nodes) {
+		last := p.nodes[p.pos-1]
+		return nil, &Diagnostic{Line: last.Line, Col: last.Col, Msg: fmt.Sprintf("expr expects an operand after %s", last.Value)}
+	}
+	n := p.nodes[p.pos]
+	p.pos++
+	if n.Type != "OPERATOR" {
+		if n.Type == "LIST" && n.paren {
+			return lowerExpr(n, n.Children)
+		}
+		return n, nil
+	}
+	form, ok := prefixOps[n.Value]
+	if !ok {
+		return nil, &Diagnostic{Line: n.Line, Col: n.Col, Msg: fmt.Sprintf("expr expects an operand, got %s", n.Value)}
+	}
+	operand, err := p.binary(prefixPrec)
+	if err != nil {
+		return nil, err
+	}
+	return operation(n, form, operand), nil
+}
+
+// operation builds the form for an operator applied to its operands, with
+// the name of the form placed at the operator.
+func operation(op *Node, form string, args ...*Node) *Node {
+	head := &Node{Type: "IDENTIFIER", Value: form, Start: op.Start, End: op.End,
+		Line: op.Line, Col: op.Col, EndLine: op.EndLine, EndCol: op.EndCol}
+	first, last := args[0], args[len(args)-1]
+	if op.Start < first.Start {
+		first = op
+	}
+	return &Node{Type: "LIST", Children: append([]*Node{head}, args...), Start: first.Start, End: last.End,
+		Line: first.Line, Col: first.Col, EndLine: last.EndLine, EndCol: last.EndCol}
+}
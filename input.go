@@ -0,0 +1,60 @@
+package piku
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	defEager("core", "choose", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		pr, opts := args[0], args[1]
+		prompt, err := strval(pr)
+		if err != nil {
+			return nil, fmt.Errorf("choose: %v, line: %d", err, ln)
+		}
+		opts = asList(opts)
+		if opts.kind != KindList || len(*opts.listval) == 0 {
+			return nil, fmt.Errorf("choose expects a non-empty list of options, line: %d", ln)
+		}
+		i, err := choose(prompt, *opts.listval, env, ln)
+		if err != nil {
+			return nil, fmt.Errorf("choose: %v, line: %d", err, ln)
+		}
+		opt := (*opts.listval)[i]
+		return &opt, nil
+	})
+}
+
+// choose prints prompt followed by a numbered menu of opts and reads
+// numbers from stdin until one names an option, returning its index.
+// Options that are strings are shown as text, anything else as by echo.
+func choose(prompt string, opts []Value, env *Env, ln int) (int, error) {
+	out := env.interp.stdout()
+	fmt.Fprintln(out, prompt)
+	for i := range opts {
+		fmt.Fprintf(out, "  %d) ", i+1)
+		if s, err := strval(&opts[i]); err == nil {
+			fmt.Fprint(out, s)
+		} else if err, _ := pv(&opts[i], env, ln); err != nil {
+			return 0, err
+		}
+		fmt.Fprintln(out)
+	}
+	for {
+		fmt.Fprintf(out, "Enter a number from 1 to %d: ", len(opts))
+		line, err := env.interp.stdin().ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return 0, fmt.Errorf("no selection made")
+			}
+			return 0, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(opts) {
+			return n - 1, nil
+		}
+		fmt.Fprintln(out, "Invalid choice.")
+	}
+}
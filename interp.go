@@ -0,0 +1,209 @@
+package piku
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Interpreter holds the settings and counters shared by every Env of one
+// program run. A zero Interpreter imposes no limits.
+type Interpreter struct {
+	// MaxSteps aborts evaluation after this many nodes have been evaluated.
+	MaxSteps int
+	// MaxListLen is the largest number of elements a list may hold.
+	MaxListLen int
+	// Ctx stops evaluation once it is cancelled or its deadline passes.
+	Ctx context.Context
+	// Restricted disables every form that touches the host system: those
+	// in the io and net namespaces.
+	Restricted bool
+	// Disabled names builtins, or namespaces of them, that programs may
+	// not use.
+	Disabled []string
+	// Optimize folds constant forms in each file before running it.
+	Optimize bool
+	// Immutable makes list build persistent lists, which append and edit
+	// never change in place.
+	Immutable bool
+	// CheckedArithmetic makes integer arithmetic whose result does not
+	// fit an int fail with an OverflowError, where it would otherwise go
+	// on with a big integer.
+	CheckedArithmetic bool
+	// PrintDepth and PrintWidth bound how many containers deep and how
+	// many elements of each echo and the REPL show; 0 means no limit.
+	PrintDepth, PrintWidth int
+	// CharLists makes echo and the REPL show strings as the lists of
+	// character codes they are, [list 72 105] for "Hi"; echostr still
+	// shows them as text.
+	CharLists bool
+	// LogLevel is the least severe level the log builtins write: debug,
+	// info, warn or error. "" means info.
+	LogLevel string
+	// Stdout, Stderr and Stdin are the streams the program prints to,
+	// logs to and reads from, and those of the processes it starts. nil
+	// means os.Stdout, os.Stderr and os.Stdin.
+	Stdout, Stderr io.Writer
+	Stdin          io.Reader
+	// Hook, when set, is called after each form is evaluated.
+	Hook func(*EvalStep)
+	// Enter, when set, is called before each form is evaluated, with no
+	// Value or Err in the step.
+	Enter func(*EvalStep)
+
+	steps int64
+	// ncalls, nvalues and maxScope are counted for Stats along with
+	// steps, and last is the value of the node evaluated last.
+	ncalls, nvalues, maxScope int64
+	last                      *Value
+	// current is the node being evaluated and toplevel the top level form
+	// of the main program it is part of, for crash reports.
+	current, toplevel *Node
+	depth             int
+	// asserts, when set, records assertions instead of failing on the
+	// first that does not hold.
+	asserts *assertTally
+	// dir is the directory of the file being run, where its imports are
+	// looked for first.
+	dir string
+	// file is the source file of the code being run, named as stack
+	// traces show it: for a compiled program, the source it was built from.
+	file string
+	// coroutines are the coroutines being resumed, innermost last.
+	coroutines []*coroutine
+	// tasks is set once spawn has started a task.
+	tasks *taskState
+	// calls are the function calls in progress in the running task,
+	// outermost first.
+	calls []callFrame
+	// prof is set when the run is being profiled.
+	prof *profiler
+	// benches, when set, records the timings of bench forms.
+	benches *benchLog
+	// builtins are the forms added with RegisterBuiltin.
+	builtins map[string]Builtin
+	// globals is the environment Run, Get and Call work in.
+	globals *Env
+	// parent is the interpreter a pmap worker works for, which counts its
+	// steps.
+	parent *Interpreter
+	// sigs is set once the program may receive signals or has trapped one.
+	sigs *signalState
+	// stdinBuf buffers Stdin for the builtins that read lines from it.
+	stdinOnce sync.Once
+	stdinBuf  *bufio.Reader
+}
+
+// EvalStep describes one evaluated form to the Hook of an Interpreter.
+type EvalStep struct {
+	Node  *Node
+	Env   *Env
+	Value *Value
+	Err   error
+	// Depth is the number of forms being evaluated around this one.
+	Depth int
+}
+
+// newEnv returns an empty global environment evaluated under in.
+func newEnv(in *Interpreter) *Env {
+	return &Env{vals: make(map[string]*Value), interp: in}
+}
+
+// context returns the context evaluation runs under, or nil.
+func (in *Interpreter) context() context.Context {
+	if in == nil {
+		return nil
+	}
+	return in.Ctx
+}
+
+// sleep pauses for d, letting other tasks run, and returns early with an
+// error when the context of the interpreter is done, or when a signal
+// arrives, for the evaluator to handle.
+func (in *Interpreter) sleep(d time.Duration, ln int) (err error) {
+	var done <-chan struct{}
+	ctx := in.context()
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	wake := in.woken()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	in.unlocked(func() {
+		select {
+		case <-t.C:
+		case <-wake:
+		case <-done:
+			err = stopped(ctx.Err(), ln)
+		}
+	})
+	return err
+}
+
+// stopped returns the error evaluation stops with once its context is
+// done with err. A line of 0 is left out, for a run found stopped only
+// once it has finished.
+func stopped(err error, ln int) error {
+	msg := "evaluation cancelled"
+	if errors.Is(err, context.DeadlineExceeded) {
+		msg = "time limit exceeded"
+	}
+	if ln == 0 {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s, line: %d", msg, ln)
+}
+
+// checksArithmetic reports whether integer overflow is an error.
+func (in *Interpreter) checksArithmetic() bool {
+	return in != nil && in.CheckedArithmetic
+}
+
+// step accounts for one evaluation and reports whether a limit was hit.
+func (in *Interpreter) step(ln int) error {
+	n := atomic.AddInt64(&in.counter().steps, 1)
+	if in.MaxSteps > 0 && n > int64(in.MaxSteps) {
+		return fmt.Errorf("step limit exceeded: more than %d evaluation steps, line: %d", in.MaxSteps, ln)
+	}
+	if in.Ctx != nil {
+		select {
+		case <-in.Ctx.Done():
+			return stopped(in.Ctx.Err(), ln)
+		default:
+		}
+	}
+	if n%1024 == 0 {
+		in.switchTasks()
+	}
+	return nil
+}
+
+// checkValue enforces the size limits on a freshly computed value.
+func (in *Interpreter) checkValue(v *Value, ln int) error {
+	if in.MaxListLen > 0 && v != nil && (v.kind == KindList || v.kind == KindPList) && listLen(v) > in.MaxListLen {
+		return fmt.Errorf("list limit exceeded: %d elements, maximum is %d, line: %d", listLen(v), in.MaxListLen, ln)
+	}
+	return nil
+}
+
+// allow reports an error if the builtin name, of namespace ns, may not
+// run under in.
+func (in *Interpreter) allow(name, ns string, ln int) error {
+	if in == nil {
+		return nil
+	}
+	if in.Restricted && restrictedNamespaces[ns] {
+		return fmt.Errorf("%s is disabled in restricted mode, line: %d", name, ln)
+	}
+	for _, d := range in.Disabled {
+		if d == name || d == ns {
+			return fmt.Errorf("%s is disabled, line: %d", name, ln)
+		}
+	}
+	return nil
+}
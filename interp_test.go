@@ -0,0 +1,60 @@
+package piku
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runUntil runs src on in, whose context ends after d, and returns the
+// error it stops with.
+func runUntil(t *testing.T, in *Interpreter, d time.Duration, src string) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	in.Ctx = ctx
+	nodes, diags := parseSource(src)
+	if len(diags) > 0 {
+		t.Fatal(diags)
+	}
+	_, err := runcode("main.pi", nodes, newEnv(in))
+	return err
+}
+
+func TestTimeoutStopsLoop(t *testing.T) {
+	err := runUntil(t, &Interpreter{}, 20*time.Millisecond, `
+[set i 0]
+[while 1 [set i [add i 1]]]
+`)
+	if err == nil || !strings.Contains(err.Error(), "time limit exceeded") {
+		t.Errorf("got %v, want a time limit error", err)
+	}
+}
+
+func TestTimeoutFailsFinishedRun(t *testing.T) {
+	in := &Interpreter{}
+	in.RegisterBuiltin("block", func(args []*Value) (*Value, error) {
+		time.Sleep(50 * time.Millisecond)
+		return nil, nil
+	})
+	err := runUntil(t, in, 10*time.Millisecond, `[block]`)
+	if err == nil || err.Error() != "time limit exceeded" {
+		t.Errorf("got %v, want a time limit error", err)
+	}
+}
+
+func TestElapsedTimesItsArgument(t *testing.T) {
+	in := &Interpreter{}
+	var ms float64
+	in.RegisterBuiltin("took", func(args []*Value) (*Value, error) {
+		ms, _ = args[0].Float()
+		return nil, nil
+	})
+	if err := in.Run(`[took [index [elapsed [sleep 30]] 1]]`); err != nil {
+		t.Fatal(err)
+	}
+	if ms < 30 {
+		t.Errorf("elapsed took %v ms over a 30 ms sleep", ms)
+	}
+}
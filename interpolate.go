@@ -0,0 +1,224 @@
+package piku
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// A string literal may hold expressions in braces, as in
+// "sum is {[add a b]}". The parser compiles such a literal into a format
+// form, [format "sum is %v" [add a b]], so that the expressions are
+// evaluated in the current scope each time the literal is. \{ and \}
+// stand for the braces themselves.
+
+var charPattern = regexp.MustCompile(`^'(?:[^'\\]|\\u\{[0-9a-fA-F]+\}|\\.)'`)
+
+// escapeLen returns the length of the escape sequence at the start of s,
+// which begins with a backslash.
+func escapeLen(s string) int {
+	if strings.HasPrefix(s, `\u{`) {
+		if end := strings.IndexByte(s, '}'); end >= 0 {
+			return end + 1
+		}
+	}
+	if len(s) < 2 {
+		return len(s)
+	}
+	_, size := utf8.DecodeRuneInString(s[1:])
+	return 1 + size
+}
+
+// scanString returns the length of the string literal at the start of s,
+// or 0 if it is not closed. Quotes inside braces belong to strings in the
+// expressions there, not to s.
+func scanString(s string) int {
+	depth := 0
+	for i := 1; i < len(s); {
+		switch c := s[i]; {
+		case c == '\\':
+			i += escapeLen(s[i:])
+			continue
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == '"' && depth == 0:
+			return i + 1
+		case c == '"':
+			n := scanString(s[i:])
+			if n == 0 {
+				return 0
+			}
+			i += n
+			continue
+		case c == '\'' && depth > 0:
+			if m := charPattern.FindString(s[i:]); m != "" {
+				i += len(m)
+				continue
+			}
+		}
+		i++
+	}
+	return 0
+}
+
+// scanPlainString returns the length of the string literal at the start
+// of s taken to end at the first quote that is not escaped, braces or not,
+// or 0 if there is none. It is where a string whose braces scanString
+// found unclosed ends, for the brace to be reported rather than the quote.
+func scanPlainString(s string) int {
+	for i := 1; i < len(s); {
+		switch s[i] {
+		case '\\':
+			i += escapeLen(s[i:])
+			continue
+		case '"':
+			return i + 1
+		}
+		i++
+	}
+	return 0
+}
+
+// exprEnd returns the index of the brace closing the expression that
+// starts at s[0], or -1 if it is not closed.
+func exprEnd(s string) int {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '"':
+			n := scanString(s[i:])
+			if n == 0 {
+				return -1
+			}
+			i += n
+			continue
+		case '\'':
+			if m := charPattern.FindString(s[i:]); m != "" {
+				i += len(m)
+				continue
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+		i++
+	}
+	return -1
+}
+
+// position returns where the text after s ends up, for s starting at
+// line and col.
+func position(s string, line, col int) (int, int) {
+	for _, r := range s {
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// shiftNode moves the positions of n and its children, parsed on their
+// own, to where their source starts in the file.
+func shiftNode(n *Node, offset, line, col int) {
+	if n.Line == 1 {
+		n.Col += col - 1
+	}
+	if n.EndLine == 1 {
+		n.EndCol += col - 1
+	}
+	n.Line += line - 1
+	n.EndLine += line - 1
+	n.Start += offset
+	n.End += offset
+	for _, c := range n.Children {
+		shiftNode(c, offset, line, col)
+	}
+}
+
+// interpolation builds the node for a string token: a STRING node, or a
+// format form if the literal holds expressions. Errors are diagnostics
+// placed in the file.
+func interpolation(token Token) (*Node, error) {
+	lit := token.Value[1 : len(token.Value)-1]
+	fail := func(i int, msg string) error {
+		line, col := position(token.Value[:i+1], token.Line, token.Col)
+		return &Diagnostic{Line: line, Col: col, Msg: msg}
+	}
+	var format strings.Builder
+	var exprs []*Node
+	start := 0
+	text := func(end int) error {
+		s, err := unescape(lit[start:end])
+		if err != nil {
+			return fail(start, err.Error())
+		}
+		format.WriteString(strings.ReplaceAll(s, "%", "%%"))
+		return nil
+	}
+	for i := 0; i < len(lit); {
+		switch lit[i] {
+		case '\\':
+			i += escapeLen(lit[i:])
+			continue
+		case '}':
+			return nil, fail(i, `unmatched } in string, write \} for a brace`)
+		case '{':
+			if err := text(i); err != nil {
+				return nil, err
+			}
+			end := exprEnd(lit[i+1:])
+			if end < 0 {
+				return nil, fail(i, `unclosed { in interpolation, write \{ for a brace`)
+			}
+			src := lit[i+1 : i+1+end]
+			if strings.TrimSpace(src) == "" {
+				return nil, fail(i, "empty {} in string")
+			}
+			line, col := position(token.Value[:i+2], token.Line, token.Col)
+			nodes, err := parseLine(src)
+			if err == nil && len(nodes) != 1 {
+				err = &Diagnostic{Line: 1, Col: 1, Msg: "expected one expression in {}"}
+			}
+			if err != nil {
+				if d, ok := err.(*Diagnostic); ok {
+					if d.Line == 1 {
+						d.Col += col - 1
+					}
+					d.Line += line - 1
+					return nil, d
+				}
+				return nil, fail(i, err.Error())
+			}
+			shiftNode(nodes[0], token.Offset+i+2, line, col)
+			exprs = append(exprs, nodes[0])
+			format.WriteString("%v")
+			i += end + 2
+			start = i
+			continue
+		}
+		i++
+	}
+	s, err := unescape(lit[start:])
+	if err != nil {
+		return nil, fail(start, err.Error())
+	}
+	node := &Node{Type: "STRING", Value: s, Start: token.Offset, End: token.Offset + len(token.Value),
+		Line: token.Line, Col: token.Col, EndLine: token.Line, EndCol: token.Col + utf8.RuneCountInString(token.Value)}
+	if exprs == nil {
+		return node, nil
+	}
+	format.WriteString(strings.ReplaceAll(s, "%", "%%"))
+	node.Value = format.String()
+	head := &Node{Type: "IDENTIFIER", Value: "format", Start: node.Start, End: node.Start,
+		Line: node.Line, Col: node.Col, EndLine: node.Line, EndCol: node.Col}
+	return &Node{Type: "LIST", Children: append([]*Node{head, node}, exprs...), Start: node.Start, End: node.End,
+		Line: node.Line, Col: node.Col, EndLine: node.EndLine, EndCol: node.EndCol}, nil
+}
@@ -0,0 +1,36 @@
+package piku
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolation(t *testing.T) {
+	got := RunSource(`[set x 2] [set a 3] [echo "x is {x} and sum is {[add x a]}, \{not\}"]`)
+	if want := "x is 2 and sum is 5, {not}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+		msg       string
+	}{
+		{`[echo "a {x"]`, 1, 10, "unclosed { in interpolation"},
+		{"[echo \"first\n  and {[add 1 2]\"]", 2, 7, "unclosed { in interpolation"},
+		{`[echo "a } b"]`, 1, 10, "unmatched } in string"},
+	}
+	for _, tt := range tests {
+		_, diags := parseSource(tt.src)
+		if len(diags) == 0 {
+			t.Errorf("%q: no error", tt.src)
+			continue
+		}
+		d := diags[0]
+		if d.Line != tt.line || d.Col != tt.col || !strings.HasPrefix(d.Msg, tt.msg) {
+			t.Errorf("%q: got %q at %d:%d, want %q at %d:%d", tt.src, d.Msg, d.Line, d.Col, tt.msg, tt.line, tt.col)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package piku
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Sequences (KindSeq) are lazy. Each is a thunk that, when first forced,
+// computes the first element and the sequence of the rest, or finds that
+// there are no elements, and keeps the result so that forcing it again
+// does no more work. Only the elements something asks for are computed,
+// so a sequence may be infinite.
+
+func init() {
+	defEager("core", "lazyrange", arity{1, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		for _, n := range args {
+			if !isInteger(n) {
+				return nil, typeError("number", n, ln)
+			}
+		}
+		var end *Value
+		if len(args) == 2 {
+			end = args[1]
+		}
+		return mkseq(rangeSeq(args[0], end)), nil
+	})
+	defEager("core", "lazymap", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f, v := args[0], args[1]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		s, err := seqOf(v, ln)
+		if err != nil {
+			return nil, err
+		}
+		return mkseq(mapSeq(f, s, env, ln)), nil
+	})
+	defEager("core", "take", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		n, v := args[0], args[1]
+		if n.kind != KindInt || n.varval < 0 {
+			return nil, fmt.Errorf("take expects a count of at least 0, got %s, line: %d", describe(n), ln)
+		}
+		s, err := seqOf(v, ln)
+		if err != nil {
+			return nil, err
+		}
+		l, err := takeSeq(s, n.varval, env, ln)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	})
+}
+
+type lazySeq struct {
+	thunk  func() (*lazyCell, error)
+	cell   *lazyCell
+	forced bool
+}
+
+// lazyCell is a forced sequence: its first element and the rest. The
+// empty sequence forces to a nil cell.
+type lazyCell struct {
+	head *Value
+	tail *lazySeq
+}
+
+func mkseq(s *lazySeq) *Value {
+	return &Value{kind: KindSeq, ref: s}
+}
+
+func (s *lazySeq) String() string {
+	return "sequence"
+}
+
+// force evaluates the thunk of s the first time it is called. A thunk that
+// fails is not kept as forced, so forcing again retries it.
+func (s *lazySeq) force() (*lazyCell, error) {
+	if !s.forced {
+		c, err := s.thunk()
+		if err != nil {
+			return nil, err
+		}
+		s.cell, s.forced, s.thunk = c, true, nil
+	}
+	return s.cell, nil
+}
+
+// rangeSeq is the sequence of the integers from start up to but not
+// including end, or counting up for ever when end is nil.
+func rangeSeq(start, end *Value) *lazySeq {
+	return &lazySeq{thunk: func() (*lazyCell, error) {
+		if end != nil {
+			if c, _ := compare(start, end); c >= 0 {
+				return nil, nil
+			}
+		}
+		return &lazyCell{start, rangeSeq(intArith("add", start, mkint(big.NewInt(1))), end)}, nil
+	}}
+}
+
+// listSeq is the sequence of the elements of l from i on.
+func listSeq(l []Value, i int) *lazySeq {
+	return &lazySeq{thunk: func() (*lazyCell, error) {
+		if i >= len(l) {
+			return nil, nil
+		}
+		return &lazyCell{&l[i], listSeq(l, i+1)}, nil
+	}}
+}
+
+// mapSeq is the sequence of the results of calling f on each element of s.
+func mapSeq(f *Value, s *lazySeq, env *Env, ln int) *lazySeq {
+	return &lazySeq{thunk: func() (*lazyCell, error) {
+		c, err := s.force()
+		if err != nil || c == nil {
+			return nil, err
+		}
+		v, err, _ := applyfunc(f, []*Value{c.head}, env, ln)
+		if err != nil {
+			return nil, err
+		}
+		return &lazyCell{v, mapSeq(f, c.tail, env, ln)}, nil
+	}}
+}
+
+// seqOf returns the sequence v is, the sequence of its elements when v
+// is a list or the sequence of the values it yields when v is a generator.
+func seqOf(v *Value, ln int) (*lazySeq, error) {
+	switch v.kind {
+	case KindSeq:
+		return v.seq(), nil
+	case KindList:
+		return listSeq(*v.listval, 0), nil
+	case KindPList:
+		return listSeq(v.plist().items(), 0), nil
+	case KindGenerator:
+		return genSeq(v.gen()), nil
+	}
+	return nil, typeError("sequence or list", v, ln)
+}
+
+// takeSeq returns a list of the first n elements of s, or of all of them
+// if there are fewer.
+func takeSeq(s *lazySeq, n int, env *Env, ln int) (*Value, error) {
+	in := env.interp
+	out := []Value{}
+	for len(out) < n {
+		if in != nil {
+			if err := in.step(ln); err != nil {
+				return nil, err
+			}
+		}
+		c, err := s.force()
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+		out = append(out, *c.head)
+		s = c.tail
+	}
+	v := &Value{kind: KindList, listval: &out}
+	if in != nil {
+		return v, in.checkValue(v, ln)
+	}
+	return v, nil
+}
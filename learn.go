@@ -0,0 +1,273 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// piku learn walks through a series of lessons. Each one explains an idea
+// and sets a task; whatever is typed is evaluated as at the REPL, in one
+// environment shared by all the lessons, and the lesson is done once its
+// check passes. The number of the next lesson is saved, so the tutorial
+// carries on where it was left. The lesson programs in lessons.go are
+// the next step, worked on in a file rather than at the prompt.
+
+type lesson struct {
+	title string
+	text  string
+	hint  string
+	check func(t *tutor) bool
+}
+
+// tutor is the state of a tutorial session.
+type tutor struct {
+	in  *Interpreter
+	env *Env
+}
+
+// run evaluates f under a step and time limit, so that a runaway function
+// cannot hang the tutorial, and returns what it printed.
+func (t *tutor) run(f func() error) (string, error) {
+	return limited(t.in, 2*time.Second, f)
+}
+
+// varIs reports whether name is bound to a value equal to want.
+func (t *tutor) varIs(name string, want *Value) bool {
+	v, ok := t.env.get(name)
+	return ok && equal(v, want)
+}
+
+// callIs reports whether calling the function bound to name with each
+// argument returns the matching result.
+func (t *tutor) callIs(name string, args, want []*Value) bool {
+	f, ok := t.env.get(name)
+	if !ok || f.kind != KindFunc {
+		return false
+	}
+	for i, a := range args {
+		var got *Value
+		_, err := t.run(func() error {
+			var err error
+			got, err, _ = applyfunc(f, []*Value{a}, t.env, 0)
+			return err
+		})
+		if err != nil || !equal(got, want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func mknums(ns ...int) []*Value {
+	out := make([]*Value, len(ns))
+	for i, n := range ns {
+		out[i] = mknum(n)
+	}
+	return out
+}
+
+var lessons = []lesson{
+	{
+		title: "Variables",
+		text: `Everything in piku is written in square brackets: the name of a form
+followed by its arguments. [set name value] binds a variable.
+
+Task: bind x to 42.`,
+		hint:  "[set x 42]",
+		check: func(t *tutor) bool { return t.varIs("x", mknum(42)) },
+	},
+	{
+		title: "Arithmetic",
+		text: `Arithmetic is written the same way: [add 1 2], [sub 5 3], [mul 4 5]
+and [div 9 3]. Forms nest, so [add 1 [mul 2 3]] is 7. Type a variable's
+name on its own to see its value.
+
+Task: bind total to x plus 8, using add.`,
+		hint:  "[set total [add x 8]]",
+		check: func(t *tutor) bool { return t.varIs("total", mknum(50)) },
+	},
+	{
+		title: "Lists",
+		text: `[list 1 2 3] makes a list. [index l i] returns the element at
+position i, counting from 0, and [reverse l] returns l backwards.
+
+Task: bind nums to a list of the numbers 1, 2 and 3.`,
+		hint: "[set nums [list 1 2 3]]",
+		check: func(t *tutor) bool {
+			lst := []Value{*mknum(1), *mknum(2), *mknum(3)}
+			return t.varIs("nums", &Value{kind: KindList, listval: &lst})
+		},
+	},
+	{
+		title: "Indexing",
+		text:  `Task: bind last to the last element of nums, using index.`,
+		hint:  "[set last [index nums 2]]",
+		check: func(t *tutor) bool { return t.varIs("last", mknum(3)) },
+	},
+	{
+		title: "Functions",
+		text: `[func [args] body] makes a function, and [call f args] calls it:
+
+    [set inc [func [n] [add n 1]]]
+    [call inc 41]
+
+Task: define double, a function that returns its argument times two.`,
+		hint: "[set double [func [n] [mul n 2]]]",
+		check: func(t *tutor) bool {
+			return t.callIs("double", mknums(0, 1, 21), mknums(0, 2, 42))
+		},
+	},
+	{
+		title: "Conditions",
+		text: `[if cond then else] evaluates then when cond is true and else
+otherwise. Zero, nil and the empty list are false; other values are
+true, so [if [sub n 1] ...] tests whether n is not 1.
+
+Task: define isone, which returns 1 when its argument is 1 and 0
+otherwise.`,
+		hint: "[set isone [func [n] [if [sub n 1] 0 1]]]",
+		check: func(t *tutor) bool {
+			return t.callIs("isone", mknums(1, 2, 5), mknums(1, 0, 0))
+		},
+	},
+	{
+		title: "Recursion",
+		text: `A function can call itself. The factorial of n is n times the
+factorial of n minus 1, and the factorial of 1 is 1.
+
+Task: define fact, which returns the factorial of its argument.`,
+		hint: "[set fact [func [n] [if [sub n 1] [mul n [call fact [sub n 1]]] 1]]]",
+		check: func(t *tutor) bool {
+			return t.callIs("fact", mknums(1, 2, 5, 6), mknums(1, 2, 120, 720))
+		},
+	},
+}
+
+// learnPath returns the file the tutorial keeps its progress in.
+func learnPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".piku_learn")
+}
+
+func loadProgress(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || n < 0 || n > len(lessons) {
+		return 0
+	}
+	return n
+}
+
+func saveProgress(path string, n int) {
+	if path != "" {
+		os.WriteFile(path, []byte(strconv.Itoa(n)+"\n"), 0644)
+	}
+}
+
+const learnHelp = `Type piku code to try the task. :hint shows an answer, :skip moves to the
+next lesson, :reset starts again from the first lesson and :quit leaves.`
+
+// learnCmd implements "piku learn", and hands the lesson programs'
+// subcommands on to lessonCmd.
+func learnCmd(args []string) error {
+	if len(args) > 0 {
+		return lessonCmd(args)
+	}
+	path := learnPath()
+	n := loadProgress(path)
+	if n == len(lessons) {
+		fmt.Println("You have finished every lesson. Type :reset to start again.")
+	}
+	fmt.Println(learnHelp)
+	// The tasks are small, so a low step limit stops runaway recursion
+	// long before it could exhaust the stack.
+	in := &Interpreter{MaxSteps: 10000}
+	t := &tutor{in: in, env: newEnv(in)}
+	ed := newLineEditor(historyPath(), completer(t.env))
+	show := func() {
+		if n < len(lessons) {
+			l := lessons[n]
+			fmt.Printf("\nLesson %d of %d: %s\n\n%s\n\n", n+1, len(lessons), l.title, l.text)
+		}
+	}
+	show()
+	for ln := 1; ; ln++ {
+		line, err := ed.readLine("learn> ")
+		if err != nil {
+			return nil
+		}
+		switch strings.TrimSpace(line) {
+		case "":
+			continue
+		case ":quit":
+			return nil
+		case ":help":
+			fmt.Println(learnHelp)
+			continue
+		case ":hint":
+			if n < len(lessons) {
+				fmt.Println(lessons[n].hint)
+			}
+			continue
+		case ":reset":
+			n = 0
+			saveProgress(path, n)
+			show()
+			continue
+		case ":skip":
+			if n < len(lessons) {
+				n++
+				saveProgress(path, n)
+			}
+			show()
+			continue
+		}
+		nodes, err := parseLine(line)
+		if err != nil {
+			fmt.Println("Error", err)
+			continue
+		}
+		for _, node := range nodes {
+			var v *Value
+			out, err := t.run(func() error {
+				var err error
+				var nenv *Env
+				v, err, nenv = eval(node, t.env, ln)
+				if err == nil {
+					t.env = nenv
+				}
+				return err
+			})
+			fmt.Print(out)
+			if err != nil {
+				fmt.Println("Error", err)
+				break
+			}
+			if !isnil(v) {
+				fmt.Fprintln(t.env.interp.stdout(), t.env.interp.render(v))
+			}
+		}
+		if n < len(lessons) && lessons[n].check(t) {
+			n++
+			saveProgress(path, n)
+			if n == len(lessons) {
+				fmt.Println("\nWell done! That was the last lesson.")
+				continue
+			}
+			fmt.Println("\nWell done!")
+			show()
+		}
+	}
+}
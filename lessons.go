@@ -0,0 +1,171 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Besides the tutorial at the prompt, piku learn has lesson programs built
+// into the binary. piku learn start writes one out to be edited, and piku
+// learn check runs the edited copy, comparing what it prints with what
+// the lesson expects and counting its assertions as piku test does. Each
+// lesson is lessons/NN-name.pi, with NN giving the order, and the output
+// it should print once solved in lessons/NN-name.out.
+
+//go:embed lessons/*.pi lessons/*.out
+var lessonFS embed.FS
+
+type lessonProgram struct {
+	name string
+	// file is the path of the program in lessonFS, without .pi.
+	file string
+}
+
+// lessonPrograms lists the lesson programs in order.
+func lessonPrograms() []lessonProgram {
+	entries, _ := lessonFS.ReadDir("lessons")
+	var ls []lessonProgram
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".pi")
+		if !ok {
+			continue
+		}
+		_, name, _ := strings.Cut(base, "-")
+		ls = append(ls, lessonProgram{name: name, file: path.Join("lessons", base)})
+	}
+	return ls
+}
+
+func findLesson(name string) (lessonProgram, error) {
+	for _, l := range lessonPrograms() {
+		if l.name == name {
+			return l, nil
+		}
+	}
+	return lessonProgram{}, fmt.Errorf("no lesson named %s (see piku learn list)", name)
+}
+
+func (l lessonProgram) source() string {
+	data, _ := lessonFS.ReadFile(l.file + ".pi")
+	return string(data)
+}
+
+func (l lessonProgram) expected() string {
+	data, _ := lessonFS.ReadFile(l.file + ".out")
+	return string(data)
+}
+
+// check runs the copy of l in file and reports whether it printed what l
+// expects with every assertion passing, printing what went wrong if not.
+func (l lessonProgram) check(file string) bool {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("FAIL  %s\n      %v\n", l.name, err)
+		return false
+	}
+	nodes, diags := parseSource(string(src))
+	if len(diags) > 0 {
+		fmt.Printf("FAIL  %s\n      %v\n", l.name, diags)
+		return false
+	}
+	in := &Interpreter{MaxSteps: 1000000, asserts: &assertTally{}}
+	env := newEnv(in)
+	out, err := limited(in, 5*time.Second, func() error {
+		_, err := execast(nodes, env)
+		return err
+	})
+	t := in.asserts
+	want := l.expected()
+	if err == nil && t.failed == 0 && out == want {
+		fmt.Printf("ok    %s\n", l.name)
+		return true
+	}
+	fmt.Printf("FAIL  %s\n", l.name)
+	if out != want {
+		fmt.Printf("      expected output:\n%s      actual output:\n%s", indentOutput(want), indentOutput(out))
+	}
+	for _, f := range t.failures {
+		fmt.Printf("      %s\n", f)
+	}
+	if err != nil {
+		fmt.Printf("      stopped: %v\n", err)
+	}
+	return false
+}
+
+// indentOutput indents each line of out to sit under a lesson's result.
+func indentOutput(out string) string {
+	if out == "" {
+		return "        (nothing)\n"
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(out, "\n"), "\n") {
+		b.WriteString("        " + strings.TrimSuffix(line, "\n") + "\n")
+	}
+	return b.String()
+}
+
+// lessonCmd implements "piku learn list|start|check".
+func lessonCmd(args []string) error {
+	usage := errors.New("usage: piku learn [list | start name | check [name]]")
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		for _, l := range lessonPrograms() {
+			fmt.Printf("%-12s %s\n", l.name, exampleDescription(l.source()))
+		}
+		return nil
+	case len(args) == 2 && args[0] == "start":
+		l, err := findLesson(args[1])
+		if err != nil {
+			return err
+		}
+		file := l.name + ".pi"
+		if _, err := os.Stat(file); err == nil {
+			return fmt.Errorf("%s exists already; check it with piku learn check %s", file, l.name)
+		}
+		if err := os.WriteFile(file, []byte(l.source()), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s. Once solved it prints:\n%s", file, indentOutput(l.expected()))
+		fmt.Printf("Edit it, then run piku learn check %s.\n", l.name)
+		return nil
+	case len(args) == 2 && args[0] == "check":
+		l, err := findLesson(args[1])
+		if err != nil {
+			return err
+		}
+		if !l.check(l.name + ".pi") {
+			return errTestsFailed
+		}
+		return nil
+	case len(args) == 1 && args[0] == "check":
+		// Every lesson started in the working directory.
+		checked, passed := 0, 0
+		for _, l := range lessonPrograms() {
+			file := l.name + ".pi"
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			checked++
+			if l.check(file) {
+				passed++
+			}
+		}
+		if checked == 0 {
+			return errors.New("no lessons started here; start one with piku learn start name")
+		}
+		fmt.Printf("%d of %d lessons passed\n", passed, checked)
+		if passed < checked {
+			return errTestsFailed
+		}
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,342 @@
+package piku
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const maxHistory = 1000
+
+// lineEditor reads lines from the terminal with emacs-style editing keys,
+// history navigation and tab completion. When stdin is not a terminal it
+// falls back to plain buffered line reading.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	histfile string
+	complete func(prefix string) []string
+	// cancel makes Ctrl-C return errCancelled instead of clearing the line.
+	cancel bool
+}
+
+// errCancelled is returned by readLine for Ctrl-C when the editor is set
+// to cancel.
+var errCancelled = errors.New("cancelled")
+
+func newLineEditor(histfile string, complete func(prefix string) []string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, histfile: histfile, complete: complete}
+	if data, err := os.ReadFile(histfile); err == nil {
+		for _, l := range strings.Split(string(data), "\n") {
+			if l != "" {
+				e.history = append(e.history, l)
+			}
+		}
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+	}
+	return e
+}
+
+// historyPath returns the default location of the REPL history file.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".piku_history")
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.histfile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.histfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// readLine prints the prompt and returns the next line without its newline.
+// It returns io.EOF when input ends (or Ctrl-D is pressed on an empty line).
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	buf := []rune{}
+	pos := 0
+	hist := len(e.history)
+	saved := ""
+	lastTab := false
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+		redraw()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := false
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(buf)
+			e.addHistory(line)
+			return line, nil
+		case 1: // Ctrl-A
+			pos = 0
+			redraw()
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+				redraw()
+			}
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			if e.cancel {
+				return "", errCancelled
+			}
+			buf, pos = buf[:0], 0
+			fmt.Fprint(e.out, prompt)
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+				redraw()
+			}
+		case 5: // Ctrl-E
+			pos = len(buf)
+			redraw()
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+				redraw()
+			}
+		case 8, 127: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+				redraw()
+			}
+		case 9: // Tab
+			tab = true
+			buf, pos = e.completeAt(buf, pos, lastTab, prompt)
+			redraw()
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+			redraw()
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			redraw()
+		case 14, 16: // Ctrl-N, Ctrl-P
+			hist, saved = e.moveHistory(hist, saved, string(buf), r == 16, setLine)
+		case 21: // Ctrl-U
+			buf = append([]rune{}, buf[pos:]...)
+			pos = 0
+			redraw()
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+			redraw()
+		case 27: // escape sequences
+			seq := e.readEscape()
+			switch seq {
+			case "[A", "OA":
+				hist, saved = e.moveHistory(hist, saved, string(buf), true, setLine)
+			case "[B", "OB":
+				hist, saved = e.moveHistory(hist, saved, string(buf), false, setLine)
+			case "[C", "OC":
+				if pos < len(buf) {
+					pos++
+					redraw()
+				}
+			case "[D", "OD":
+				if pos > 0 {
+					pos--
+					redraw()
+				}
+			case "[H", "OH", "[1~":
+				pos = 0
+				redraw()
+			case "[F", "OF", "[4~":
+				pos = len(buf)
+				redraw()
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+					redraw()
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+				redraw()
+			}
+		}
+		lastTab = tab
+	}
+}
+
+func (e *lineEditor) readEscape() string {
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return ""
+	}
+	seq := string(b)
+	if b != '[' && b != 'O' {
+		return seq
+	}
+	for {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return seq
+		}
+		seq += string(c)
+		if c >= 0x40 && c <= 0x7e {
+			return seq
+		}
+	}
+}
+
+func (e *lineEditor) moveHistory(hist int, saved, cur string, up bool, setLine func(string)) (int, string) {
+	if up {
+		if hist == 0 {
+			return hist, saved
+		}
+		if hist == len(e.history) {
+			saved = cur
+		}
+		hist--
+		setLine(e.history[hist])
+		return hist, saved
+	}
+	if hist >= len(e.history) {
+		return hist, saved
+	}
+	hist++
+	if hist == len(e.history) {
+		setLine(saved)
+	} else {
+		setLine(e.history[hist])
+	}
+	return hist, saved
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// completeAt completes the word before the cursor. A unique match is
+// inserted; otherwise the common prefix is inserted and a second Tab lists
+// the candidates.
+func (e *lineEditor) completeAt(buf []rune, pos int, listAll bool, prompt string) ([]rune, int) {
+	if e.complete == nil {
+		return buf, pos
+	}
+	start := pos
+	for start > 0 && isWordRune(buf[start-1]) {
+		start--
+	}
+	prefix := string(buf[start:pos])
+	matches := e.complete(prefix)
+	if len(matches) == 0 {
+		return buf, pos
+	}
+	ins := matches[0]
+	if len(matches) > 1 {
+		ins = commonPrefix(matches)
+		if listAll {
+			fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+		}
+	} else {
+		ins += " "
+	}
+	rest := []rune(ins)[len([]rune(prefix)):]
+	buf = append(buf[:pos], append(rest, buf[pos:]...)...)
+	return buf, pos + len(rest)
+}
+
+func commonPrefix(words []string) string {
+	p := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
+
+// completer returns a completion function over the builtin form names and
+// the identifiers currently bound in env.
+func completer(env *Env) func(prefix string) []string {
+	return func(prefix string) []string {
+		seen := map[string]bool{}
+		var out []string
+		add := func(name string) {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+		for _, b := range builtinNames("") {
+			add(b)
+		}
+		if in := env.interp; in != nil {
+			for name := range in.builtins {
+				add(name)
+			}
+		}
+		for name := range env.vals {
+			add(name)
+		}
+		sort.Strings(out)
+		return out
+	}
+}
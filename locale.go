@@ -0,0 +1,123 @@
+package piku
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	formatLocaleForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v, tagv := args[0], args[1]
+			if !isNumber(v) {
+				return nil, fmt.Errorf("%s expects a number, got %s, line: %d", op, typename(v), ln)
+			}
+			tag, err := strval(tagv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			loc, err := findLocale(tag)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			if op == "format-locale-date" {
+				return mkstr(loc.formatDate(unixTime(v))), nil
+			}
+			if v.kind == KindFloat {
+				return mkstr(loc.formatFloat(v.realval)), nil
+			}
+			return mkstr(loc.groupDigits(v.varval)), nil
+		}
+	}
+	defEager("core", "format-locale", arity{2, 2}, formatLocaleForm("format-locale"))
+	defEager("core", "format-locale-date", arity{2, 2}, formatLocaleForm("format-locale-date"))
+}
+
+// localeFormat describes how a locale writes numbers and dates.
+type localeFormat struct {
+	group, decimal string
+	date           string // time.Format layout
+}
+
+var locales = map[string]localeFormat{
+	"en-US": {",", ".", "01/02/2006"},
+	"en-GB": {",", ".", "02/01/2006"},
+	"de-DE": {".", ",", "02.01.2006"},
+	"tr-TR": {".", ",", "02.01.2006"},
+	"fr-FR": {" ", ",", "02/01/2006"},
+	"es-ES": {".", ",", "02/01/2006"},
+	"it-IT": {".", ",", "02/01/2006"},
+	"nl-NL": {".", ",", "02-01-2006"},
+	"pt-BR": {".", ",", "02/01/2006"},
+	"ru-RU": {" ", ",", "02.01.2006"},
+	"pl-PL": {" ", ",", "02.01.2006"},
+	"sv-SE": {" ", ",", "2006-01-02"},
+	"de-CH": {"’", ".", "02.01.2006"},
+	"ja-JP": {",", ".", "2006/01/02"},
+	"zh-CN": {",", ".", "2006/01/02"},
+	"ko-KR": {",", ".", "2006. 01. 02."},
+}
+
+// findLocale looks a locale up by its tag, falling back to the first
+// locale with the same language.
+func findLocale(tag string) (localeFormat, error) {
+	tag = strings.ReplaceAll(tag, "_", "-")
+	for name, l := range locales {
+		if strings.EqualFold(name, tag) {
+			return l, nil
+		}
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	best := ""
+	for name := range locales {
+		if l, _, _ := strings.Cut(name, "-"); strings.EqualFold(l, lang) && (best == "" || name < best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return localeFormat{}, fmt.Errorf("unknown locale: %q", tag)
+	}
+	return locales[best], nil
+}
+
+// groupDigits writes n with the locale's thousands separator.
+func (l localeFormat) groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var sb strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			sb.WriteString(l.group)
+		}
+		sb.WriteRune(c)
+	}
+	return sign + sb.String()
+}
+
+// formatFloat writes f with the locale's separators.
+func (l localeFormat) formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	n, err := strconv.Atoi(whole)
+	if err != nil {
+		return s
+	}
+	out := l.groupDigits(n)
+	if n == 0 && strings.HasPrefix(whole, "-") {
+		out = "-" + out
+	}
+	if hasFrac {
+		out += l.decimal + frac
+	}
+	return out
+}
+
+// formatDate writes t as a date in the local time zone.
+func (l localeFormat) formatDate(t time.Time) string {
+	return t.Format(l.date)
+}
@@ -0,0 +1,68 @@
+package piku
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The log builtins write timestamped lines to the interpreter's standard
+// error, so that a program's diagnostics stay out of the output it pipes
+// to another:
+//
+//	2026-10-15 14:03:07.512 WARN  retrying in 2s
+//
+// Lines below the level set with --log-level, info unless it is given,
+// are left out.
+
+func init() {
+	for name, level := range logForms {
+		level := level
+		defEager("core", name, arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+			if err := env.interp.log(level, args[0]); err != nil {
+				return nil, err
+			}
+			return mknil(), nil
+		})
+	}
+}
+
+// logLevels ranks the levels from the least severe up.
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// logForms maps each log builtin to its level.
+var logForms = map[string]string{
+	"log-debug": "debug", "log-info": "info", "log-warn": "warn", "log-error": "error",
+}
+
+// logMu keeps lines logged by tasks at once from interleaving.
+var logMu sync.Mutex
+
+// checkLogLevel returns an error unless level names a log level.
+func checkLogLevel(level string) error {
+	if _, ok := logLevels[level]; !ok {
+		return fmt.Errorf("unknown log level %q: use debug, info, warn or error", level)
+	}
+	return nil
+}
+
+// log writes v as a line at level, unless the interpreter leaves out that
+// level. Strings are written as text and other values as echo prints them.
+func (in *Interpreter) log(level string, v *Value) error {
+	least := "info"
+	if in != nil && in.LogLevel != "" {
+		least = in.LogLevel
+	}
+	if logLevels[level] < logLevels[least] {
+		return nil
+	}
+	text := in.render(v)
+	if typeof(v) == "string" {
+		text, _ = strval(v)
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	_, err := fmt.Fprintf(in.stderr(), "%s %-5s %s\n", time.Now().Format("2006-01-02 15:04:05.000"), strings.ToUpper(level), text)
+	return err
+}
@@ -0,0 +1,357 @@
+package piku
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A minimal Language Server Protocol server speaking JSON-RPC over stdio.
+// Documents are fully resynchronised on every change.
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label string `json:"label"`
+	Kind  int    `json:"kind"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspServer struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]string
+}
+
+func lspServe(in io.Reader, out io.Writer) error {
+	s := &lspServer{in: bufio.NewReader(in), out: out, docs: map[string]string{}}
+	for {
+		msg, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		reply := &lspMessage{JSONRPC: "2.0", ID: msg.ID, Result: result}
+		if rerr != nil {
+			reply.Result = nil
+			reply.Error = rerr
+		} else if result == nil {
+			reply.Result = json.RawMessage("null")
+		}
+		if err := s.write(reply); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lspServer) read() (*lspMessage, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %v", err)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &lspMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *lspServer) write(msg *lspMessage) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *lspServer) notify(method string, params any) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&lspMessage{Method: method, Params: raw})
+}
+
+func (s *lspServer) handle(msg *lspMessage) (any, *lspError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "piku"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lspError{Code: -32602, Message: err.Error()}
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lspError{Code: -32602, Message: err.Error()}
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lspError{Code: -32602, Message: err.Error()}
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": p.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		return nil, nil
+	case "textDocument/definition":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lspError{Code: -32602, Message: err.Error()}
+		}
+		loc := s.definition(p.TextDocument.URI, p.Position)
+		if loc == nil {
+			return nil, nil
+		}
+		return loc, nil
+	case "textDocument/completion":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return nil, &lspError{Code: -32602, Message: err.Error()}
+		}
+		return s.completion(p.TextDocument.URI), nil
+	}
+	if msg.ID != nil && !strings.HasPrefix(msg.Method, "$/") {
+		return nil, &lspError{Code: -32601, Message: "method not found: " + msg.Method}
+	}
+	return nil, nil
+}
+
+func (s *lspServer) update(uri, text string) {
+	s.docs[uri] = text
+	diags := []lspDiagnostic{}
+	_, errs := parseSource(text)
+	for _, d := range errs {
+		start := lspPosition{Line: d.Line - 1, Character: d.Col - 1}
+		end := lspPosition{Line: d.Line - 1, Character: d.Col}
+		diags = append(diags, lspDiagnostic{Range: lspRange{start, end}, Severity: 1, Source: "piku", Message: d.Msg})
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diags})
+}
+
+// parse returns the tokens and forms of the document at uri. It recovers
+// from errors as diagnostics do, so that a document being edited, which
+// is seldom without one, still has the forms that parse.
+func (s *lspServer) parse(uri string) ([]Token, []*Node) {
+	tokens, _ := tokenizeRecover(s.docs[uri])
+	nodes, _ := parseRecover(tokens)
+	return tokens, nodes
+}
+
+// definition finds the identifier under the cursor and returns where it is
+// bound: a parameter of an enclosing func, or a set/macro at any level.
+func (s *lspServer) definition(uri string, pos lspPosition) *lspLocation {
+	tokens, nodes := s.parse(uri)
+	line, col := pos.Line+1, pos.Character+1
+	var name string
+	for _, t := range tokens {
+		if t.Type == "IDENTIFIER" && t.Line == line && col >= t.Col && col <= t.Col+len(t.Value) {
+			name = t.Value
+			break
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	var def *Node
+	for _, n := range nodes {
+		if d := findParam(n, name, line, col); d != nil {
+			def = d
+			break
+		}
+	}
+	if def == nil {
+		defs := map[string]*Node{}
+		for _, n := range nodes {
+			collectDefs(n, defs)
+		}
+		def = defs[name]
+	}
+	if def == nil {
+		return nil
+	}
+	start := lspPosition{Line: def.Line - 1, Character: def.Col - 1}
+	end := lspPosition{Line: def.Line - 1, Character: def.Col - 1 + len(def.Value)}
+	return &lspLocation{URI: uri, Range: lspRange{start, end}}
+}
+
+// collectDefs records the first set, const, foreach, try or macro binding
+// of every name under n.
+func collectDefs(n *Node, defs map[string]*Node) {
+	if n.Type != "LIST" {
+		return
+	}
+	if len(n.Children) > 1 && (n.Children[0].Value == "set" || n.Children[0].Value == "const" || n.Children[0].Value == "foreach" || n.Children[0].Value == "macro") {
+		if target := n.Children[1]; target.Type == "IDENTIFIER" {
+			if _, ok := defs[target.Value]; !ok {
+				defs[target.Value] = target
+			}
+		}
+	}
+	if len(n.Children) > 2 && n.Children[0].Value == "try" {
+		if target := n.Children[2]; target.Type == "IDENTIFIER" {
+			if _, ok := defs[target.Value]; !ok {
+				defs[target.Value] = target
+			}
+		}
+	}
+	for _, c := range n.Children {
+		collectDefs(c, defs)
+	}
+}
+
+// findParam returns the innermost func or macro parameter named name whose
+// body contains the position line:col.
+func findParam(n *Node, name string, line, col int) *Node {
+	if n.Type != "LIST" {
+		return nil
+	}
+	for _, c := range n.Children {
+		if d := findParam(c, name, line, col); d != nil {
+			return d
+		}
+	}
+	params, body := funcParts(n)
+	if params == nil || !nodeContains(body, line, col) {
+		return nil
+	}
+	for _, p := range params.Children {
+		if p, _, _, ok := paramParts(p); ok && p.Value == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func funcParts(n *Node) (*Node, *Node) {
+	if (len(n.Children) == 3 || len(n.Children) == 4) && (n.Children[0].Value == "func" || n.Children[0].Value == "genfunc") {
+		return n.Children[1], n.Children[len(n.Children)-1]
+	}
+	if len(n.Children) == 4 && n.Children[0].Value == "macro" {
+		return n.Children[2], n.Children[3]
+	}
+	return nil, nil
+}
+
+// nodeContains reports whether line:col falls inside the span of n.
+func nodeContains(n *Node, line, col int) bool {
+	if line < n.Line || (line == n.Line && col < n.Col) {
+		return false
+	}
+	return line < n.EndLine || (line == n.EndLine && col <= n.EndCol)
+}
+
+func (s *lspServer) completion(uri string) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	for _, b := range builtinNames("") {
+		items = append(items, lspCompletionItem{Label: b, Kind: 3})
+	}
+	_, nodes := s.parse(uri)
+	defs := map[string]*Node{}
+	for _, n := range nodes {
+		collectDefs(n, defs)
+	}
+	for name := range defs {
+		items = append(items, lspCompletionItem{Label: name, Kind: 6})
+	}
+	return items
+}
+
+func runLSP() {
+	if err := lspServe(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "lsp:", err)
+		os.Exit(1)
+	}
+}
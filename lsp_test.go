@@ -0,0 +1,38 @@
+package piku
+
+import "testing"
+
+// brokenDoc has an unclosed form between the definitions and a use.
+const brokenDoc = `[set total 0]
+[set f [func [n] [add n total]]]
+[echo [add 1
+[echo total]
+`
+
+func TestLSPDefinitionInBrokenDocument(t *testing.T) {
+	s := &lspServer{docs: map[string]string{"file:///a.pi": brokenDoc}}
+	loc := s.definition("file:///a.pi", lspPosition{Line: 3, Character: 7})
+	if loc == nil {
+		t.Fatal("no definition found")
+	}
+	if start := loc.Range.Start; start.Line != 0 || start.Character != 5 {
+		t.Errorf("definition at %d:%d, want 0:5", start.Line, start.Character)
+	}
+	loc = s.definition("file:///a.pi", lspPosition{Line: 1, Character: 22})
+	if loc == nil || loc.Range.Start.Line != 1 || loc.Range.Start.Character != 14 {
+		t.Errorf("got %+v, want the parameter n at 1:14", loc)
+	}
+}
+
+func TestLSPCompletionInBrokenDocument(t *testing.T) {
+	s := &lspServer{docs: map[string]string{"file:///a.pi": brokenDoc}}
+	found := map[string]bool{}
+	for _, it := range s.completion("file:///a.pi") {
+		found[it.Label] = true
+	}
+	for _, name := range []string{"total", "f", "echo"} {
+		if !found[name] {
+			t.Errorf("completion lacks %s", name)
+		}
+	}
+}
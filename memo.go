@@ -0,0 +1,69 @@
+package piku
+
+import "sync"
+
+// A memoized function (see memoize) caches its results in the memo of its
+// Function, keyed by the arguments of each call encoded as for set
+// elements. Calls with an argument that has no such key, like a function,
+// are not cached, and nor are calls that fail.
+
+func init() {
+	defEager("core", "memoize", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f := args[0]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		return memoized(f), nil
+	})
+}
+
+// memoTable is locked while it is used, as pmap workers may call the
+// function at the same time.
+type memoTable struct {
+	sync.Mutex
+	vals map[string]*Value
+}
+
+// memoized returns a copy of the function value f that caches its results.
+func memoized(f *Value) *Value {
+	m := *f.fn()
+	m.memo = &memoTable{vals: map[string]*Value{}}
+	return &Value{kind: KindFunc, ref: &m}
+}
+
+// callKey encodes the arguments of a call as a memo key.
+func callKey(args []*Value, named map[string]*Value) (string, bool) {
+	list := make([]Value, len(args))
+	for i, a := range args {
+		list[i] = *a
+	}
+	dict := map[string]Value{}
+	for k, v := range named {
+		dict[k] = *v
+	}
+	return setKey(&Value{kind: KindTuple, listval: &[]Value{{kind: KindList, listval: &list}, {kind: KindDict, dictval: dict}}})
+}
+
+// memocall calls the memoized function f, returning the cached result when
+// there is one.
+func memocall(f *Value, name string, args []*Value, named map[string]*Value, env *Env, ln int) (*Value, error, *Env) {
+	key, ok := callKey(args, named)
+	memo := f.fn().memo
+	if ok {
+		memo.Lock()
+		v, hit := memo.vals[key]
+		memo.Unlock()
+		if hit {
+			return v, nil, env
+		}
+	}
+	plain := *f.fn()
+	plain.memo = nil
+	v, err, nenv := bindargs(&Value{kind: KindFunc, ref: &plain}, name, args, named, env, ln)
+	if err == nil && ok {
+		memo.Lock()
+		memo.vals[key] = v
+		memo.Unlock()
+	}
+	return v, err, nenv
+}
@@ -0,0 +1,200 @@
+package piku
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	defSpecial("io", "import", arity{1, 2}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		name, sum := node.Children[1].Value, ""
+		if len(node.Children) == 3 {
+			if !isURL(name) {
+				return nil, fmt.Errorf("import takes a hash only with a URL, line: %d", ln), nil
+			}
+			sum = node.Children[2].Value
+		}
+		file, err := importFile(name, sum, env.interp.importDir())
+		if err != nil {
+			return nil, &ImportError{Name: name, Line: ln, Err: err}, nil
+		}
+		code, err := LoadFile(file)
+		if err != nil {
+			return nil, &ImportError{Name: name, Line: ln, Err: err}, nil
+		}
+		env, err = runcode(file, code, env)
+		if err != nil {
+			return nil, err, nil
+		}
+		return mknil(), nil, env
+	})
+}
+
+// modulesDir is where piku get puts the libraries it fetches. A library
+// named lib lives in piku_modules/lib, with its entry point in lib.pi.
+const modulesDir = "piku_modules"
+
+// importSearch holds the directories given with --path, searched for
+// imports after the directory of the importing file.
+var importSearch []string
+
+// importDirs returns the directories an import in a file in dir is looked
+// for in: dir itself, then those given with --path and then those in the
+// PIKU_PATH environment variable.
+func importDirs(dir string) []string {
+	dirs := append([]string{dir}, importSearch...)
+	for _, d := range filepath.SplitList(os.Getenv("PIKU_PATH")) {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// importPath returns the file [import name] in a file in dir runs. In
+// each of the search directories in turn it looks for name.pi and then
+// for a library fetched by piku get. When nothing is found it returns
+// name.pi in dir, so the error names the file that was expected.
+func importPath(name, dir string) string {
+	file := name + ".pi"
+	for _, d := range importDirs(dir) {
+		candidates := []string{
+			filepath.Join(d, file),
+			filepath.Join(d, modulesDir, file),
+			filepath.Join(d, modulesDir, name, filepath.Base(name)+".pi"),
+		}
+		for _, f := range candidates {
+			if _, err := os.Stat(f); err == nil {
+				return f
+			}
+		}
+	}
+	return filepath.Join(dir, file)
+}
+
+// importDir returns the directory imports are looked for in first: that
+// of the file being run, or the working directory at the REPL.
+func (in *Interpreter) importDir() string {
+	if in.dir == "" {
+		return "."
+	}
+	return in.dir
+}
+
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// importFile returns the file to run for [import name] in a file in dir
+// or, when name is a URL, [import "url" sum]. sum is empty or "sha256:"
+// and the hex digest the source must have.
+func importFile(name, sum, dir string) (string, error) {
+	if !isURL(name) {
+		return importPath(name, dir), nil
+	}
+	return fetchImport(name, sum)
+}
+
+var importClient = &http.Client{Timeout: time.Minute}
+
+// importValidators are the ETag and Last-Modified headers a URL import
+// was served with, kept beside the cached copy to revalidate it.
+type importValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// fetchImport downloads the source at url into the import cache and
+// returns the cached file. A cached copy that matches sum is used without
+// fetching again, since the hash pins its content. Without a hash the
+// copy is revalidated on every import with a conditional GET, and used
+// as it is when the server answers that it has not changed or cannot be
+// reached.
+func fetchImport(url, sum string) (string, error) {
+	if sum != "" && !strings.HasPrefix(sum, "sha256:") {
+		return "", errors.New("the hash must be written sha256:hex")
+	}
+	key := sha256.Sum256([]byte(url))
+	var cached string
+	var have bool
+	var prev importValidators
+	if dir, err := os.UserCacheDir(); err == nil {
+		cached = filepath.Join(dir, "piku", "imports", hex.EncodeToString(key[:])+".pi")
+		if data, err := os.ReadFile(cached); err == nil {
+			if sum != "" && sourceSum(data) == sum {
+				return cached, nil
+			}
+			if sum == "" {
+				have = true
+				if meta, err := os.ReadFile(cached + ".json"); err == nil {
+					json.Unmarshal(meta, &prev)
+				}
+			}
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if have && prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if have && prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+	resp, err := importClient.Do(req)
+	if err != nil {
+		if have {
+			return cached, nil
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+	if have && resp.StatusCode == http.StatusNotModified {
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if got := sourceSum(data); sum != "" && got != sum {
+		return "", fmt.Errorf("the source has hash %s, not %s", got, sum)
+	}
+	if cached == "" {
+		// Without a cache directory the source goes to a file of its own.
+		f, err := os.CreateTemp("", "piku-import-*.pi")
+		if err != nil {
+			return "", err
+		}
+		cached = f.Name()
+		f.Close()
+		registerTemp(cached)
+	} else if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return "", err
+	} else if sum != "" {
+		os.Remove(cached + ".json")
+	} else {
+		meta, _ := json.Marshal(importValidators{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")})
+		if err := os.WriteFile(cached+".json", meta, 0644); err != nil {
+			return "", err
+		}
+	}
+	return cached, os.WriteFile(cached, data, 0644)
+}
+
+func sourceSum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
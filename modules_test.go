@@ -0,0 +1,51 @@
+package piku
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestURLImportIsRevalidated(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	body, etag := `[set v 1]`, `"1"`
+	var notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	url := srv.URL + "/lib.pi"
+	read := func() string {
+		t.Helper()
+		file, err := fetchImport(url, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read(); got != body {
+		t.Fatalf("first import got %q", got)
+	}
+	if got := read(); got != body || notModified != 1 {
+		t.Errorf("unchanged import got %q after %d 304 responses", got, notModified)
+	}
+	body, etag = `[set v 2]`, `"2"`
+	if got := read(); got != body {
+		t.Errorf("changed import got %q, want %q", got, body)
+	}
+	srv.Close()
+	if got := read(); got != body {
+		t.Errorf("offline import got %q, want the cached %q", got, body)
+	}
+}
@@ -0,0 +1,62 @@
+package piku
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// A program embedding piku can add forms of its own, written in Go, with
+// RegisterBuiltin. eval tries them for any form that is not one of piku's,
+// before looking for a macro of that name.
+
+// Builtin is a form written in Go. It is called with the values of the
+// arguments of the form, read with the methods of Value, and returns one
+// made with the New functions; a nil result stands for nil.
+type Builtin func(args []*Value) (*Value, error)
+
+var builtinName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9-]*$`)
+
+// RegisterBuiltin makes fn the form name for the programs in runs. It
+// fails for a name that is not an identifier or is taken by a form of
+// piku's own.
+func (in *Interpreter) RegisterBuiltin(name string, fn Builtin) error {
+	if !builtinName.MatchString(name) {
+		return fmt.Errorf("builtin name %q is not an identifier", name)
+	}
+	if isBuiltin(name) {
+		return fmt.Errorf("%s is already a builtin", name)
+	}
+	if in.builtins == nil {
+		in.builtins = map[string]Builtin{}
+	}
+	in.builtins[name] = fn
+	return nil
+}
+
+// native returns the builtin registered as name.
+func (in *Interpreter) native(name string) (Builtin, bool) {
+	if in == nil {
+		return nil, false
+	}
+	fn, ok := in.builtins[name]
+	return fn, ok
+}
+
+// callNative evaluates the arguments of node and calls fn with them.
+func callNative(fn Builtin, node *Node, env *Env, ln int) (*Value, error, *Env) {
+	args, err, env := evalArgs(node.Children[1:], env, ln)
+	if err != nil {
+		return nil, err, nil
+	}
+	v, err := fn(args)
+	if err != nil {
+		if _, ok := err.(*scriptError); ok {
+			return nil, err, nil
+		}
+		return nil, fmt.Errorf("%s: %v, line: %d", node.Children[0].Value, err, ln), nil
+	}
+	if v == nil {
+		v = mknil()
+	}
+	return v, nil, env
+}
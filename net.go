@@ -0,0 +1,178 @@
+package piku
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"unicode/utf8"
+)
+
+func init() {
+	tcpOpenForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			host := ""
+			if op == "tcpconnect" {
+				h, err := strval(args[0])
+				if err != nil {
+					return nil, fmt.Errorf("tcpconnect: host: %v, line: %d", err, ln)
+				}
+				host, args = h, args[1:]
+			}
+			port := args[0]
+			if port.kind != KindInt || port.varval < 0 || port.varval > 65535 {
+				return nil, fmt.Errorf("%s expects a port number, got %s, line: %d", op, describe(port), ln)
+			}
+			if op == "tcplisten" {
+				l, err := net.Listen("tcp", tcpAddr("", port.varval))
+				if err != nil {
+					return nil, fmt.Errorf("tcplisten: %v, line: %d", err, ln)
+				}
+				return &Value{kind: KindHandle, ref: &tcpListener{l: l}}, nil
+			}
+			conn, err := net.Dial("tcp", tcpAddr(host, port.varval))
+			if err != nil {
+				return nil, fmt.Errorf("tcpconnect: %v, line: %d", err, ln)
+			}
+			return &Value{kind: KindHandle, ref: &tcpConn{conn: conn}}, nil
+		}
+	}
+	defEager("net", "tcpconnect", arity{2, 2}, tcpOpenForm("tcpconnect"))
+	defEager("net", "tcplisten", arity{1, 1}, tcpOpenForm("tcplisten"))
+	defEager("net", "tcpaccept", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		l, ok := h.handle().(*tcpListener)
+		if !ok || h.kind != KindHandle {
+			return nil, fmt.Errorf("tcpaccept expects a tcp listener handle, got %s, line: %d", typename(h), ln)
+		}
+		conn, err := l.l.Accept()
+		if err != nil {
+			return nil, fmt.Errorf("tcpaccept: %v, line: %d", err, ln)
+		}
+		return &Value{kind: KindHandle, ref: &tcpConn{conn: conn}}, nil
+	})
+	defEager("net", "tcpsend", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		c, err := tcpconnhandle(h, "tcpsend", ln)
+		if err != nil {
+			return nil, err
+		}
+		v := args[1]
+		data, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("tcpsend: %v, line: %d", err, ln)
+		}
+		if err := c.send(data); err != nil {
+			return nil, fmt.Errorf("tcpsend: %v, line: %d", err, ln)
+		}
+		return mknil(), nil
+	})
+	defEager("net", "tcprecv", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		c, err := tcpconnhandle(h, "tcprecv", ln)
+		if err != nil {
+			return nil, err
+		}
+		n := args[1]
+		if n.kind != KindInt || n.varval < 1 {
+			return nil, fmt.Errorf("tcprecv expects a positive byte count, got %s, line: %d", describe(n), ln)
+		}
+		s, err := c.recv(n.varval)
+		if err == io.EOF {
+			return mknil(), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tcprecv: %v, line: %d", err, ln)
+		}
+		return mkstr(s), nil
+	})
+	defEager("net", "tcpclose", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		if err := tcpclose(h, ln); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+}
+
+// tcpConn is the handle value behind tcpconnect and tcpaccept. Data goes
+// over the connection as UTF-8 text; a character split across two reads is
+// held back until the rest of it arrives.
+type tcpConn struct {
+	conn    net.Conn
+	pending []byte
+}
+
+func (c *tcpConn) String() string {
+	return "tcp " + c.conn.RemoteAddr().String()
+}
+
+// tcpListener is the handle value behind tcplisten.
+type tcpListener struct {
+	l net.Listener
+}
+
+func (l *tcpListener) String() string {
+	return "tcp listener " + l.l.Addr().String()
+}
+
+func tcpAddr(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// recv reads up to n bytes and returns them as text. It returns io.EOF
+// once the other end has closed the connection and nothing is left.
+func (c *tcpConn) recv(n int) (string, error) {
+	buf := make([]byte, n)
+	k := copy(buf, c.pending)
+	c.pending = c.pending[k:]
+	if k == 0 {
+		var err error
+		k, err = c.conn.Read(buf)
+		if k == 0 {
+			return "", err
+		}
+	}
+	data := buf[:k]
+	// Hold back the start of a character cut off at the end.
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if r := data[len(data)-i]; utf8.RuneStart(r) {
+			if !utf8.FullRune(data[len(data)-i:]) && i < len(data) {
+				c.pending = append(append([]byte{}, data[len(data)-i:]...), c.pending...)
+				data = data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return string(data), nil
+}
+
+func (c *tcpConn) send(s string) error {
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// tcpconnhandle extracts the connection behind a handle value.
+func tcpconnhandle(v *Value, op string, ln int) (*tcpConn, error) {
+	if c, ok := v.handle().(*tcpConn); ok && v.kind == KindHandle {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%s expects a tcp connection handle, got %s, line: %d", op, typename(v), ln)
+}
+
+// tcpclose closes the connection or listener behind a handle value.
+func tcpclose(v *Value, ln int) error {
+	var err error
+	switch h := v.handle().(type) {
+	case *tcpConn:
+		err = h.conn.Close()
+	case *tcpListener:
+		err = h.l.Close()
+	default:
+		return fmt.Errorf("tcpclose expects a tcp handle, got %s, line: %d", typename(v), ln)
+	}
+	if err != nil {
+		return fmt.Errorf("tcpclose: %v, line: %d", err, ln)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+)
+
+// A notebook is a Markdown document whose code blocks fenced as piku (or
+// pi) run in order in one shared environment. The document is written
+// back out with the output of each block after it.
+
+type notebookCell struct {
+	text   string // Markdown, or the source of a code block
+	code   bool
+	output string
+}
+
+// parseNotebook splits a document into Markdown cells and piku code cells.
+func parseNotebook(r io.Reader) ([]*notebookCell, error) {
+	var cells []*notebookCell
+	var cur strings.Builder
+	// fence is the fence of the open code block, if any; other marks
+	// whether it is a block of some other language, kept as Markdown.
+	inCode, other, fence := false, false, ""
+	flush := func(code bool) {
+		if cur.Len() > 0 || code {
+			cells = append(cells, &notebookCell{text: cur.String(), code: code})
+		}
+		cur.Reset()
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inCode && !other && strings.HasPrefix(trimmed, "```"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+			if lang := strings.TrimSpace(trimmed[len(fence):]); lang == "piku" || lang == "pi" {
+				flush(false)
+				inCode = true
+				continue
+			}
+			other = true
+		case other && trimmed == fence:
+			other = false
+		case inCode && trimmed == fence:
+			flush(true)
+			inCode = false
+			continue
+		}
+		cur.WriteString(line + "\n")
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if inCode {
+		return nil, errors.New("unterminated piku code block")
+	}
+	flush(false)
+	return cells, nil
+}
+
+// runCell runs the code of c in env and records what it printed. An error
+// is recorded as output too, and later cells still run.
+func runCell(c *notebookCell, env *Env) *Env {
+	var buf bytes.Buffer
+	saved := env.interp.Stdout
+	env.interp.Stdout = &buf
+	defer func() {
+		env.interp.Stdout = saved
+		if r := recover(); r != nil {
+			fmt.Fprintln(&buf, "Error internal error:", r)
+		}
+		c.output = buf.String()
+	}()
+	nodes, diags := parseSource(c.text)
+	if len(diags) > 0 {
+		fmt.Fprintln(&buf, "Error", diags)
+		return env
+	}
+	nenv, err := execast(nodes, env)
+	if err != nil {
+		fmt.Fprintln(&buf, "Error", err)
+		return env
+	}
+	return nenv
+}
+
+func writeMarkdown(w io.Writer, cells []*notebookCell) {
+	for _, c := range cells {
+		if !c.code {
+			io.WriteString(w, c.text)
+			continue
+		}
+		fmt.Fprintf(w, "```piku\n%s```\n", c.text)
+		if c.output != "" {
+			fmt.Fprintf(w, "\n```text\n%s", c.output)
+			if !strings.HasSuffix(c.output, "\n") {
+				io.WriteString(w, "\n")
+			}
+			io.WriteString(w, "```\n")
+		}
+	}
+}
+
+// writeHTML renders the notebook as a standalone page.
+func writeHTML(w io.Writer, cells []*notebookCell, title string) {
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	io.WriteString(w, "<style>pre{background:#f4f4f4;padding:.5em}pre.output{background:#fff;border-left:3px solid #ccc}</style>\n</head>\n<body>\n")
+	for _, c := range cells {
+		if !c.code {
+			markdownHTML(w, c.text)
+			continue
+		}
+		fmt.Fprintf(w, "<pre><code>%s</code></pre>\n", html.EscapeString(c.text))
+		if c.output != "" {
+			fmt.Fprintf(w, "<pre class=\"output\">%s</pre>\n", html.EscapeString(c.output))
+		}
+	}
+	io.WriteString(w, "</body>\n</html>\n")
+}
+
+// markdownHTML renders the headings, paragraphs and fenced blocks of a
+// piece of Markdown. Inline markup is left as it is.
+func markdownHTML(w io.Writer, text string) {
+	var para []string
+	endPara := func() {
+		if len(para) > 0 {
+			fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(strings.Join(para, "\n")))
+			para = nil
+		}
+	}
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if trimmed == fence {
+				io.WriteString(w, "</code></pre>\n")
+				fence = ""
+			} else {
+				io.WriteString(w, html.EscapeString(line)+"\n")
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			endPara()
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+			io.WriteString(w, "<pre><code>")
+		case trimmed == "":
+			endPara()
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 || !strings.HasPrefix(trimmed[level:], " ") {
+				para = append(para, trimmed)
+				break
+			}
+			endPara()
+			fmt.Fprintf(w, "<h%d>%s</h%d>\n", level, html.EscapeString(strings.TrimSpace(trimmed[level:])), level)
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	if fence != "" {
+		io.WriteString(w, "</code></pre>\n")
+	}
+	endPara()
+}
+
+// notebookCmd implements "piku notebook file.pimd [-o out] [--html]".
+func notebookCmd(args []string) error {
+	fs := flag.NewFlagSet("notebook", flag.ContinueOnError)
+	out := fs.String("o", "", "output file (default: standard output)")
+	asHTML := fs.Bool("html", false, "render HTML instead of Markdown")
+	var src string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		src, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if src == "" && fs.NArg() > 0 {
+		src = fs.Arg(0)
+	}
+	if src == "" {
+		return errors.New("usage: piku notebook file.pimd [-o out] [--html]")
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	cells, err := parseNotebook(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	env := newEnv(&Interpreter{})
+	for _, c := range cells {
+		if c.code {
+			env = runCell(c, env)
+		}
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	bw := bufio.NewWriter(w)
+	if *asHTML {
+		writeHTML(bw, cells, src)
+	} else {
+		writeMarkdown(bw, cells)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,222 @@
+package piku
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Numbers are integers (KindInt, or KindBigInt when too large for an int)
+// unless written with a decimal point, in which case they are floats
+// (KindFloat). Arithmetic on two integers stays integral; as soon as one
+// side is a float the result is a float.
+
+func init() {
+	defEager("core", "round", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v, modev := args[0], args[1]
+		if !isNumber(v) {
+			return nil, fmt.Errorf("round expects a number, got %s, line: %d", typename(v), ln)
+		}
+		mode := modev.sym()
+		if modev.kind != KindSymbol {
+			var err error
+			if mode, err = strval(modev); err != nil {
+				return nil, fmt.Errorf("round: mode: %v, line: %d", err, ln)
+			}
+		}
+		r, err := roundNumber(v, mode)
+		if err != nil {
+			return nil, fmt.Errorf("round: %v, line: %d", err, ln)
+		}
+		return r, nil
+	})
+	defEager("core", "pow", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a, b := args[0], args[1]
+		v, err := power(a, b, ln)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+	mathForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			return mathOp(op, args[0], ln)
+		}
+	}
+	defEager("core", "sqrt", arity{1, 1}, mathForm("sqrt"))
+	defEager("core", "abs", arity{1, 1}, mathForm("abs"))
+	defEager("core", "floor", arity{1, 1}, mathForm("floor"))
+	defEager("core", "ceil", arity{1, 1}, mathForm("ceil"))
+	minMaxForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			best := args[0]
+			for _, v := range args[1:] {
+				c, ok := compare(v, best)
+				if !ok {
+					return nil, fmt.Errorf("%s cannot compare %s with %s, line: %d", op, typeof(v), typeof(best), ln)
+				}
+				if (c < 0) == (op == "min") && c != 0 {
+					best = v
+				}
+			}
+			return best, nil
+		}
+	}
+	defEager("core", "min", arity{1, -1}, minMaxForm("min"))
+	defEager("core", "max", arity{1, -1}, minMaxForm("max"))
+	bitForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			a, b := args[0], args[0]
+			if len(args) == 2 {
+				b = args[1]
+			}
+			return bitOp(op, a, b, ln)
+		}
+	}
+	defEager("core", "band", arity{2, 2}, bitForm("band"))
+	defEager("core", "bor", arity{2, 2}, bitForm("bor"))
+	defEager("core", "bxor", arity{2, 2}, bitForm("bxor"))
+	defEager("core", "shl", arity{2, 2}, bitForm("shl"))
+	defEager("core", "shr", arity{2, 2}, bitForm("shr"))
+	defEager("core", "bnot", arity{1, 1}, bitForm("bnot"))
+}
+
+func mkfloat(f float64) *Value {
+	return &Value{kind: KindFloat, realval: f}
+}
+
+// isNumber reports whether v is an integer or a float.
+func isNumber(v *Value) bool {
+	return v != nil && (v.kind == KindInt || v.kind == KindBigInt || v.kind == KindFloat)
+}
+
+// floatval returns the value of a number as a float64.
+func floatval(v *Value) float64 {
+	switch v.kind {
+	case KindFloat:
+		return v.realval
+	case KindBigInt:
+		return bigFloat(v.big())
+	}
+	return float64(v.varval)
+}
+
+// formatFloat writes f so that it always reads back as a float.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".IN") {
+		s += ".0"
+	}
+	return s
+}
+
+// arith applies the binary operator op (add, sub, mul, div or mod) to two
+// numbers.
+func arith(op string, a, b *Value, ln int) (*Value, error) {
+	if !isNumber(a) {
+		return nil, typeError("number", a, ln)
+	}
+	if !isNumber(b) {
+		return nil, typeError("number", b, ln)
+	}
+	if isInteger(a) && isInteger(b) {
+		if (op == "div" || op == "mod") && isZero(b) {
+			return nil, fmt.Errorf("division by zero, line: %d", ln)
+		}
+		return intArith(op, a, b), nil
+	}
+	x, y := floatval(a), floatval(b)
+	switch op {
+	case "add":
+		return mkfloat(x + y), nil
+	case "sub":
+		return mkfloat(x - y), nil
+	case "mul":
+		return mkfloat(x * y), nil
+	}
+	if y == 0 {
+		return nil, fmt.Errorf("division by zero, line: %d", ln)
+	}
+	if op == "div" {
+		return mkfloat(x / y), nil
+	}
+	return mkfloat(math.Mod(x, y)), nil
+}
+
+// roundModes are the ways round may resolve a number to an integer.
+// half-up sends ties away from zero, half-even to the nearest even integer.
+var roundModes = map[string]func(float64) float64{
+	"half-up":   math.Round,
+	"half-even": math.RoundToEven,
+	"floor":     math.Floor,
+	"ceil":      math.Ceil,
+}
+
+// roundNumber rounds v to an integer using the named mode.
+func roundNumber(v *Value, mode string) (*Value, error) {
+	f, ok := roundModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown rounding mode %q: expected half-up, half-even, floor or ceil", mode)
+	}
+	if isInteger(v) {
+		return v, nil
+	}
+	r := f(v.realval)
+	if math.IsNaN(r) || r >= math.MaxInt64 || r < math.MinInt64 {
+		return nil, fmt.Errorf("cannot round %s to an integer", formatFloat(v.realval))
+	}
+	return &Value{kind: KindInt, varval: int(r)}, nil
+}
+
+// maxPowBits bounds the size of an exact integer power, so that a typo in
+// an exponent cannot exhaust memory.
+const maxPowBits = 1 << 24
+
+// power raises a to b, exactly when both are integers and b is not
+// negative and as a float otherwise.
+func power(a, b *Value, ln int) (*Value, error) {
+	if !isNumber(a) {
+		return nil, typeError("number", a, ln)
+	}
+	if !isNumber(b) {
+		return nil, typeError("number", b, ln)
+	}
+	if isInteger(a) && isInteger(b) && bigOf(b).Sign() >= 0 {
+		x, y := bigOf(a), bigOf(b)
+		if x.BitLen() > 1 && (!y.IsInt64() || int64(x.BitLen())*y.Int64() > maxPowBits) {
+			return nil, fmt.Errorf("pow: result would have more than %d bits, line: %d", maxPowBits, ln)
+		}
+		return mkint(new(big.Int).Exp(x, y, nil)), nil
+	}
+	return mkfloat(math.Pow(floatval(a), floatval(b))), nil
+}
+
+// mathOp applies the one-argument function op (sqrt, abs, floor or ceil)
+// to v. abs keeps integers integral; floor and ceil return integers.
+func mathOp(op string, v *Value, ln int) (*Value, error) {
+	if !isNumber(v) {
+		return nil, typeError("number", v, ln)
+	}
+	switch op {
+	case "sqrt":
+		if floatval(v) < 0 {
+			return nil, fmt.Errorf("sqrt of a negative number, line: %d", ln)
+		}
+		return mkfloat(math.Sqrt(floatval(v))), nil
+	case "abs":
+		if v.kind == KindFloat {
+			return mkfloat(math.Abs(v.realval)), nil
+		}
+		if bigOf(v).Sign() < 0 {
+			return negInt(v), nil
+		}
+		return v, nil
+	}
+	r, err := roundNumber(v, op)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+	}
+	return r, nil
+}
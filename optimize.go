@@ -0,0 +1,150 @@
+package piku
+
+// piku --optimize rewrites the program before running it. A call of a
+// pure builtin whose arguments are all constants, such as [add 2 3] or
+// [list 1 2 3], is evaluated once and replaced by a CONST node holding the
+// result, and an if whose condition is constant is replaced by the branch
+// it takes. The arguments of a macro are left as they are written, since
+// the macro is handed them as code. Forms that fail are left for the run
+// to report, and so are results too large to be worth keeping in the
+// program. A folded list is copied each time it is used, which is still
+// much cheaper than building it from its elements.
+
+// pureForms are the builtins whose result depends only on their
+// arguments, which are safe to evaluate ahead of the run.
+var pureForms = map[string]bool{
+	"add": true, "sub": true, "mul": true, "div": true, "mod": true,
+	"neg": true, "divmod": true, "pow": true, "sqrt": true, "abs": true,
+	"floor": true, "ceil": true, "round": true, "min": true, "max": true,
+	"band": true, "bor": true, "bxor": true, "bnot": true, "shl": true,
+	"shr": true, "list": true, "tuple": true, "concat": true,
+	"reverse": true, "index": true, "contains": true, "flatten": true,
+	"range": true, "format": true,
+}
+
+// maxFoldSteps and maxFoldLen bound the work and the size of the result
+// of one folded form.
+const (
+	maxFoldSteps = 10000
+	maxFoldLen   = 10000
+)
+
+// constCopy returns a copy of the lists in a folded value, which edit
+// could otherwise change for every later use of the form.
+func constCopy(v *Value) *Value {
+	if v.kind != KindList && v.kind != KindTuple {
+		return v
+	}
+	lst := make([]Value, len(*v.listval))
+	for i := range *v.listval {
+		lst[i] = *constCopy(&(*v.listval)[i])
+	}
+	return &Value{kind: v.kind, listval: &lst, text: v.text}
+}
+
+// optimize rewrites nodes in place and returns them. Forms are folded
+// under the options of run, the interpreter the program is to run on, so
+// that a list form makes a persistent list under --immutable and integer
+// overflow fails under --checked-arithmetic, leaving the form to fail
+// again in the run.
+func optimize(nodes []*Node, run *Interpreter) []*Node {
+	for i, n := range nodes {
+		nodes[i] = optimizeNode(n, run)
+	}
+	return nodes
+}
+
+// constValue returns the value of n if it is a literal or a folded form.
+func constValue(n *Node) (*Value, bool) {
+	switch n.Type {
+	case "CONST":
+		return n.value, true
+	case "INTEGER", "FLOAT", "STRING", "CHAR":
+		v, err, _ := evalNode(n, newEnv(nil), n.Line)
+		return v, err == nil
+	}
+	return nil, false
+}
+
+func optimizeNode(n *Node, run *Interpreter) *Node {
+	if n.Type != "LIST" || len(n.Children) == 0 {
+		return n
+	}
+	head, args := n.Children[0], n.Children[1:]
+	if head.Type != "IDENTIFIER" {
+		optimize(n.Children, run)
+		return n
+	}
+	// Only the parts of these forms that are evaluated are rewritten.
+	switch head.Value {
+	case "quote", "import":
+		return n
+	case "func", "genfunc", "macro":
+		if head.Value == "macro" && len(args) > 0 {
+			args = args[1:]
+		}
+		if len(args) < 2 || len(args) > 3 || args[0].Type != "LIST" {
+			return n
+		}
+		for _, p := range args[0].Children {
+			if _, _, def, ok := paramParts(p); ok && def != nil {
+				p.Children[len(p.Children)-1] = optimizeNode(def, run)
+			}
+		}
+		// A func may have a documentation string before its body.
+		args[len(args)-1] = optimizeNode(args[len(args)-1], run)
+		return n
+	case "setmany":
+		if len(args) == 2 {
+			args[1] = optimizeNode(args[1], run)
+		}
+		return n
+	case "dict", "exec":
+		// dict entries and exec options are written [name value]; the
+		// command and arguments of exec come first.
+		for i, a := range args {
+			if head.Value == "exec" && i < 2 {
+				args[i] = optimizeNode(a, run)
+			} else if a.Type == "LIST" {
+				optimize(a.Children[1:], run)
+			}
+		}
+		return n
+	case "pipeline":
+		// Every word of a stage is evaluated, but the stage is not a form.
+		for _, a := range args {
+			if a.Type == "LIST" {
+				optimize(a.Children, run)
+			}
+		}
+		return n
+	}
+	if _, ok := run.native(head.Value); !isBuiltin(head.Value) && !ok {
+		// A macro, whose arguments are code it is handed unevaluated.
+		return n
+	}
+	optimize(args, run)
+	if head.Value == "if" && len(args) == 3 {
+		if c, ok := constValue(args[0]); ok {
+			if truthy(c) {
+				return args[1]
+			}
+			return args[2]
+		}
+	}
+	if !pureForms[head.Value] {
+		return n
+	}
+	for _, a := range args {
+		if _, ok := constValue(a); !ok {
+			return n
+		}
+	}
+	v, err, _ := eval(n, newEnv(&Interpreter{MaxSteps: maxFoldSteps, MaxListLen: maxFoldLen,
+		Immutable: run.Immutable, CheckedArithmetic: run.CheckedArithmetic}), n.Line)
+	if err != nil || (v.kind == KindList && len(*v.listval) > maxFoldLen) {
+		return n
+	}
+	return &Node{Type: "CONST", Value: describe(v), value: v, Start: n.Start, End: n.End,
+		Line: n.Line, Col: n.Col, EndLine: n.EndLine, EndCol: n.EndCol}
+}
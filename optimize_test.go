@@ -0,0 +1,43 @@
+package piku
+
+import (
+	"bytes"
+	"testing"
+)
+
+// runOptimized runs src as piku --optimize does and returns what it
+// printed, followed by the error if it failed.
+func runOptimized(t *testing.T, src string) string {
+	t.Helper()
+	nodes, diags := parseSource(src)
+	if len(diags) > 0 {
+		t.Fatal(diags)
+	}
+	var buf bytes.Buffer
+	in := &Interpreter{Optimize: true, Stdout: &buf}
+	if _, err := execast(optimize(nodes, in), newEnv(in)); err != nil {
+		buf.WriteString("Error " + err.Error() + "\n")
+	}
+	return buf.String()
+}
+
+func TestOptimizeFolds(t *testing.T) {
+	nodes, _ := parseSource("[echo [add 2 [mul 3 4]]]")
+	n := optimize(nodes, &Interpreter{})[0]
+	if arg := n.Children[1]; arg.Type != "CONST" || arg.value.varval != 14 {
+		t.Errorf("[add 2 [mul 3 4]] folded to %s %q", arg.Type, arg.Value)
+	}
+}
+
+func TestOptimizeLeavesMacroArguments(t *testing.T) {
+	src := `
+[macro unless [c then else] [list [quote if] c else then]]
+[echo [unless [sub 1 1] [add 1 2] [list 4 5]]]
+[macro twice [x] [list [quote list] x x]]
+[echo [twice [add 1 1]]]
+`
+	want := RunSource(src)
+	if got := runOptimized(t, src); got != want {
+		t.Errorf("under --optimize got %q, without %q", got, want)
+	}
+}
@@ -0,0 +1,1126 @@
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token structure
+type Token struct {
+	Type   string
+	Value  string
+	Offset int
+	Line   int
+	Col    int
+}
+
+// Node structure representing an element or list. Start and End are byte
+// offsets into the source; Line/Col and EndLine/EndCol are 1-based and the
+// end position is exclusive.
+type Node struct {
+	Type     string
+	Value    string
+	Children []*Node
+	Start    int
+	End      int
+	Line     int
+	Col      int
+	EndLine  int
+	EndCol   int
+	// value is the result of a CONST node, a form folded by optimize.
+	value *Value
+	// paren marks a group in parentheses in an expr form, until the form
+	// is lowered.
+	paren bool
+}
+
+// Diagnostic is a syntax error found by the tokenizer or the parser, or a
+// problem that check finds. It is exported as SyntaxError.
+type Diagnostic struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s, line: %d, col: %d", d.Msg, d.Line, d.Col)
+}
+
+// Diagnostics collects every syntax error found in one run.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, len(ds))
+	for i, d := range ds {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Tokenize the input string
+func tokenize(source string) ([]Token, error) {
+	tokens, diags := tokenizeRecover(source)
+	if len(diags) > 0 {
+		return nil, diags[0]
+	}
+	return tokens, nil
+}
+
+// Character classes for the tokenizer, indexed by byte.
+const (
+	classDigit = 1 << iota
+	classIdentStart
+	classSpace
+)
+
+var charClasses [256]uint8
+
+func init() {
+	for c := '0'; c <= '9'; c++ {
+		charClasses[c] |= classDigit
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		charClasses[c] |= classIdentStart
+		charClasses[c-'a'+'A'] |= classIdentStart
+	}
+	charClasses['_'] |= classIdentStart
+	for _, c := range "\t\n\f\r " {
+		charClasses[c] |= classSpace
+	}
+}
+
+func isDigit(c byte) bool {
+	return charClasses[c]&classDigit != 0
+}
+
+func isIdentStart(c byte) bool {
+	return charClasses[c]&classIdentStart != 0
+}
+
+func isIdentPart(c byte) bool {
+	return charClasses[c]&(classIdentStart|classDigit) != 0 || c == '-'
+}
+
+func isSpace(c byte) bool {
+	return charClasses[c]&classSpace != 0
+}
+
+// scanChar returns the length of the character literal at the start of s,
+// or 0 if there is none.
+func scanChar(s string) int {
+	if len(s) < 3 {
+		return 0
+	}
+	n := 0
+	switch {
+	case strings.HasPrefix(s[1:], `\u{`):
+		hex := 4
+		for hex < len(s) && (isDigit(s[hex]) || strings.IndexByte("abcdefABCDEF", s[hex]) >= 0) {
+			hex++
+		}
+		if hex > 4 && hex+1 < len(s) && s[hex] == '}' && s[hex+1] == '\'' {
+			return hex + 2
+		}
+		fallthrough
+	case s[1] == '\\':
+		_, size := utf8.DecodeRuneInString(s[2:])
+		if s[2] == '\n' {
+			return 0
+		}
+		n = 2 + size
+	case s[1] == '\'':
+		return 0
+	default:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		n = 1 + size
+	}
+	if n < len(s) && s[n] == '\'' {
+		return n + 1
+	}
+	return 0
+}
+
+// tokenizeRecover tokenizes the whole source, skipping and reporting every
+// character that does not start a token.
+func tokenizeRecover(source string) ([]Token, Diagnostics) {
+	source = blankShebang(source)
+	var tokens []Token
+	var diags Diagnostics
+	line, col := 1, 1
+	for pos := 0; pos < len(source); {
+		c := source[pos]
+		typ, n := "", 0
+		switch {
+		case isDigit(c):
+			n = pos + 1
+			for n < len(source) && isDigit(source[n]) {
+				n++
+			}
+			typ = "INTEGER"
+			if n+1 < len(source) && source[n] == '.' && isDigit(source[n+1]) {
+				n += 2
+				for n < len(source) && isDigit(source[n]) {
+					n++
+				}
+				typ = "FLOAT"
+			}
+			n -= pos
+		case isIdentStart(c):
+			n = pos + 1
+			for n < len(source) && isIdentPart(source[n]) {
+				n++
+			}
+			typ, n = "IDENTIFIER", n-pos
+		case c == '"':
+			typ, n = "STRING", scanString(source[pos:])
+			if n == 0 {
+				n = scanPlainString(source[pos:])
+			}
+		case c == '\'':
+			typ, n = "CHAR", scanChar(source[pos:])
+		case c == '[' || c == '(':
+			typ, n = "LBRACKET", 1
+		case c == ']' || c == ')':
+			typ, n = "RBRACKET", 1
+		case isSpace(c):
+			n = pos + 1
+			for n < len(source) && isSpace(source[n]) {
+				n++
+			}
+			typ, n = "WHITESPACE", n-pos
+		default:
+			typ, n = "OPERATOR", scanOperator(source[pos:])
+		}
+		if n == 0 {
+			r, size := utf8.DecodeRuneInString(source[pos:])
+			diags = append(diags, &Diagnostic{Line: line, Col: col, Msg: fmt.Sprintf("unexpected character: %q", r)})
+			pos += size
+			col++
+			continue
+		}
+		text := source[pos : pos+n]
+		switch typ {
+		case "WHITESPACE":
+		case "STRING":
+			tok := Token{Type: typ, Value: text, Offset: pos, Line: line, Col: col}
+			tokens = append(tokens, tok)
+			if _, err := interpolation(tok); err != nil {
+				diags = append(diags, err.(*Diagnostic))
+			}
+		case "CHAR":
+			tokens = append(tokens, Token{Type: typ, Value: text, Offset: pos, Line: line, Col: col})
+			if _, err := unescape(text[1 : len(text)-1]); err != nil {
+				diags = append(diags, &Diagnostic{Line: line, Col: col, Msg: err.Error()})
+			}
+		default:
+			tokens = append(tokens, Token{Type: typ, Value: text, Offset: pos, Line: line, Col: col})
+		}
+		line, col = position(text, line, col)
+		pos += n
+	}
+	return tokens, diags
+}
+
+// atomNode builds the leaf node for a single token. String and character
+// nodes hold the text between the quotes, with its escapes replaced; a
+// string with expressions in braces becomes a format form.
+func atomNode(token Token) *Node {
+	node := &Node{Type: token.Type, Value: token.Value, Start: token.Offset, End: token.Offset + len(token.Value),
+		Line: token.Line, Col: token.Col, EndLine: token.Line, EndCol: token.Col + utf8.RuneCountInString(token.Value)}
+	switch token.Type {
+	case "STRING":
+		if n, err := interpolation(token); err == nil {
+			return n
+		}
+		node.Value, _ = unescape(token.Value[1 : len(token.Value)-1])
+	case "CHAR":
+		node.Value, _ = unescape(token.Value[1 : len(token.Value)-1])
+	}
+	return node
+}
+
+// escapes maps the character after a backslash in a string or character
+// literal to the character the pair stands for. \u{hex} is handled apart.
+var escapes = map[byte]rune{'n': '\n', 't': '\t', 'r': '\r', '"': '"', '\'': '\'', '\\': '\\', '{': '{', '}': '}'}
+
+// unescape replaces the escape sequences in the text of a literal. A
+// backslash that does not start one is kept.
+func unescape(lit string) (string, error) {
+	if !strings.Contains(lit, `\`) {
+		return lit, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != '\\' {
+			sb.WriteByte(lit[i])
+			continue
+		}
+		i++
+		if i == len(lit) {
+			return "", errors.New("escape \\ at the end of a literal")
+		}
+		if r, ok := escapes[lit[i]]; ok {
+			sb.WriteRune(r)
+			continue
+		}
+		if !strings.HasPrefix(lit[i:], "u{") {
+			// Any other backslash stands for itself, as in the regular
+			// expressions given to rematch.
+			sb.WriteByte('\\')
+			i--
+			continue
+		}
+		end := strings.IndexByte(lit[i:], '}')
+		if end < 0 {
+			return "", errors.New("expected \\u{hex}")
+		}
+		n, err := strconv.ParseUint(lit[i+2:i+end], 16, 32)
+		if err != nil || n > unicode.MaxRune || (n >= 0xD800 && n < 0xE000) {
+			return "", fmt.Errorf("\\u{%s} is not a Unicode code point", lit[i+2:i+end])
+		}
+		sb.WriteRune(rune(n))
+		i += end
+	}
+	return sb.String(), nil
+}
+
+// escape writes s as the text of a literal quoted by quote.
+func escape(s string, quote rune) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case quote, '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '{', '}':
+			if quote == '"' {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// nodeSource renders n back into piku source.
+func nodeSource(n *Node) string {
+	switch n.Type {
+	case "STRING":
+		return quoteString(n.Value)
+	case "CHAR":
+		return "'" + escape(n.Value, '\'') + "'"
+	case "LIST":
+		parts := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			parts[i] = nodeSource(c)
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return n.Value
+}
+
+// charValue returns the code point a character literal stands for.
+func charValue(n *Node) *Value {
+	r, _ := utf8.DecodeRuneInString(n.Value)
+	return &Value{kind: KindInt, varval: int(r)}
+}
+
+// closers gives the delimiter closing a list for each that opens one. A
+// list may be written in parentheses as well as in brackets, but it must
+// end with the one matching its start.
+var closers = map[string]string{"[": "]", "(": ")"}
+
+// Parse a list
+func parseList(tokens []Token) (*Node, []Token, error) {
+	return parseForm(tokens, false)
+}
+
+// parseForm parses a list, or with group set a group in an expr form,
+// where operators may appear and parentheses group as well. An expr form
+// is lowered to the forms it stands for.
+func parseForm(tokens []Token, group bool) (*Node, []Token, error) {
+	if len(tokens) == 0 || tokens[0].Type != "LBRACKET" {
+		return nil, tokens, fmt.Errorf("expected '[' or '(' at the beginning of the list")
+	}
+
+	open := tokens[0]
+	closer := closers[open.Value]
+	tokens = tokens[1:]
+	rootNode := &Node{Type: "LIST", Children: []*Node{}, Start: open.Offset, Line: open.Line, Col: open.Col, paren: group}
+
+	for len(tokens) > 0 && tokens[0].Type != "RBRACKET" {
+		token := tokens[0]
+		infix := group || (len(rootNode.Children) > 0 && rootNode.Children[0].Type == "IDENTIFIER" && rootNode.Children[0].Value == "expr")
+		if token.Type == "INTEGER" || token.Type == "FLOAT" || token.Type == "IDENTIFIER" || token.Type == "STRING" || token.Type == "CHAR" || (token.Type == "OPERATOR" && infix) {
+			rootNode.Children = append(rootNode.Children, atomNode(token))
+			tokens = tokens[1:]
+		} else if token.Type == "OPERATOR" {
+			return nil, nil, &Diagnostic{Line: token.Line, Col: token.Col, Msg: fmt.Sprintf("operator %s outside of an expr form", token.Value)}
+		} else if token.Type == "LBRACKET" {
+			nestedNode, remainingTokens, err := parseForm(tokens, infix && token.Value == "(")
+			if err != nil {
+				return nil, nil, err
+			}
+			rootNode.Children = append(rootNode.Children, nestedNode)
+			tokens = remainingTokens
+		} else {
+			return nil, nil, &Diagnostic{Line: token.Line, Col: token.Col, Msg: fmt.Sprintf("unexpected token: %v", token.Value)}
+		}
+	}
+
+	if len(tokens) == 0 || tokens[0].Type != "RBRACKET" {
+		return nil, nil, &Diagnostic{Line: open.Line, Col: open.Col, Msg: fmt.Sprintf("expected '%s' at the end of the list", closer)}
+	}
+
+	closing := tokens[0]
+	if closing.Value != closer {
+		return nil, nil, &Diagnostic{Line: closing.Line, Col: closing.Col,
+			Msg: fmt.Sprintf("'%s' does not match the '%s' at line %d, col %d; expected '%s'", closing.Value, open.Value, open.Line, open.Col, closer)}
+	}
+	rootNode.End, rootNode.EndLine, rootNode.EndCol = closing.Offset+1, closing.Line, closing.Col+1
+	tokens = tokens[1:]
+	if !group && len(rootNode.Children) > 0 && rootNode.Children[0].Type == "IDENTIFIER" && rootNode.Children[0].Value == "expr" {
+		lowered, err := lowerExpr(rootNode, rootNode.Children[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return lowered, tokens, nil
+	}
+	return rootNode, tokens, nil
+}
+
+// Parse multiple lists
+func parseMultipleLists(tokens []Token) ([]*Node, error) {
+	var nodes []*Node
+	var err error
+
+	for len(tokens) > 0 {
+		if tokens[0].Type == "LBRACKET" {
+			var node *Node
+			node, tokens, err = parseList(tokens)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		} else {
+			return nil, &Diagnostic{Line: tokens[0].Line, Col: tokens[0].Col, Msg: fmt.Sprintf("unexpected token outside brackets: %v", tokens[0].Value)}
+		}
+	}
+
+	return nodes, nil
+}
+
+// parseRecover parses every top-level list it can. After an error it skips
+// to the end of the broken form (or, if the form is never closed, to the
+// next '[' or '(' at the start of a line) and carries on, so that all syntax errors
+// are reported at once.
+func parseRecover(tokens []Token) ([]*Node, Diagnostics) {
+	var nodes []*Node
+	var diags Diagnostics
+	for len(tokens) > 0 {
+		if tokens[0].Type != "LBRACKET" {
+			diags = append(diags, &Diagnostic{Line: tokens[0].Line, Col: tokens[0].Col, Msg: fmt.Sprintf("unexpected token outside brackets: %v", tokens[0].Value)})
+			tokens = tokens[1:]
+			continue
+		}
+		node, rest, err := parseList(tokens)
+		if err == nil {
+			nodes = append(nodes, node)
+			tokens = rest
+			continue
+		}
+		d, ok := err.(*Diagnostic)
+		if !ok {
+			d = &Diagnostic{Line: tokens[0].Line, Col: tokens[0].Col, Msg: err.Error()}
+		}
+		diags = append(diags, d)
+		tokens = skipForm(tokens)
+	}
+	return nodes, diags
+}
+
+func skipForm(tokens []Token) []Token {
+	// want holds the closers of the lists open, innermost last. A closer
+	// that does not match the innermost list is taken to be a stray.
+	var want []string
+	for i, t := range tokens {
+		switch t.Type {
+		case "LBRACKET":
+			want = append(want, closers[t.Value])
+		case "RBRACKET":
+			if len(want) > 0 && t.Value == want[len(want)-1] {
+				want = want[:len(want)-1]
+			}
+		}
+		if len(want) == 0 {
+			return tokens[i+1:]
+		}
+	}
+	for i, t := range tokens[1:] {
+		if t.Type == "LBRACKET" && t.Col == 1 {
+			return tokens[i+1:]
+		}
+	}
+	return nil
+}
+
+// parseSource tokenizes and parses source with error recovery.
+func parseSource(source string) ([]*Node, Diagnostics) {
+	tokens, diags := tokenizeRecover(source)
+	nodes, pdiags := parseRecover(tokens)
+	return nodes, append(diags, pdiags...)
+}
+
+// blankShebang replaces a leading #! line, as in an executable script,
+// with spaces, so that it is skipped without moving the positions of the
+// code after it.
+func blankShebang(source string) string {
+	if !strings.HasPrefix(source, "#!") {
+		return source
+	}
+	end := strings.IndexByte(source, '\n')
+	if end < 0 {
+		end = len(source)
+	}
+	return strings.Repeat(" ", end) + source[end:]
+}
+
+// Env is one scope of variables. Function calls run in a child Env whose
+// parent is the scope the function was created in; lookups walk up the
+// parents while set always binds in the innermost scope.
+type Env struct {
+	vals map[string]*Value
+	// consts marks the names in vals bound with const.
+	consts map[string]bool
+	parent *Env
+	interp *Interpreter
+	// gen is the generator whose body runs in this scope, if any.
+	gen *generator
+}
+
+// child returns a new empty scope nested in env.
+func (env *Env) child() *Env {
+	return &Env{vals: make(map[string]*Value), parent: env, interp: env.interp}
+}
+
+// constant reports whether name refers to a const binding.
+func (env *Env) constant(name string) bool {
+	for e := env; e != nil; e = e.parent {
+		if _, ok := e.vals[name]; ok {
+			return e.consts[name]
+		}
+	}
+	return false
+}
+
+// assign rebinds name to v in the scope that binds it.
+func (env *Env) assign(name string, v *Value) {
+	for e := env; e != nil; e = e.parent {
+		if _, ok := e.vals[name]; ok {
+			e.vals[name] = v
+			return
+		}
+	}
+}
+
+// get looks name up in env and then in its enclosing scopes.
+func (env *Env) get(name string) (*Value, bool) {
+	for e := env; e != nil; e = e.parent {
+		if v, ok := e.vals[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+type Function struct {
+	Args []string
+	// Defaults holds the default expression of each argument, or nil.
+	Defaults []*Node
+	// Types holds the type annotation of each argument, or "". They are
+	// only used by piku check --types.
+	Types []string
+	// Doc is the documentation string written before the body, if any.
+	Doc  string
+	expr *Node
+	// env is the scope the function was created in, nil for macros.
+	env *Env
+	// memo, when set, holds the results of earlier calls; see memoize.
+	memo *memoTable
+	// parts, when set, holds what a function made by compose or partial
+	// calls in place of a body.
+	parts *fnParts
+	// gen marks a function made with genfunc, whose calls return a
+	// generator running its body.
+	gen bool
+	// file is the source file the function was defined in, if known.
+	file string
+}
+
+// arity is the number of arguments a builtin form takes. max is -1 for
+// forms taking any number of arguments from min up.
+type arity struct {
+	min, max int
+}
+
+func (a arity) allows(n int) bool {
+	return n >= a.min && (a.max < 0 || n <= a.max)
+}
+
+// nilValue is the one nil value, shared like the small integers.
+var nilValue = Value{kind: KindNil}
+
+// mknil returns the nil value, the result of forms that produce nothing.
+func mknil() *Value {
+	return &nilValue
+}
+
+// isnil reports whether v is nil.
+func isnil(v *Value) bool {
+	return v == nil || v.kind == KindNil
+}
+
+// control is the error break, continue and return unwind with. Passing
+// it through the error result of eval means every form on the way gives
+// up and hands it on unchanged, until the nearest enclosing loop or
+// function catches it.
+type control struct {
+	kind string
+	val  *Value
+	line int
+}
+
+func (c *control) Error() string {
+	if c.kind == "return" {
+		return fmt.Sprintf("return outside a function, line: %d", c.line)
+	}
+	return fmt.Sprintf("%s outside a loop, line: %d", c.kind, c.line)
+}
+
+// exitError is the error exit unwinds with, so that every form on the way
+// gives up and the program ends with status code once it reaches the top.
+type exitError struct {
+	code int
+	line int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit with status %d, line: %d", e.code, e.line)
+}
+
+// catchable reports whether default, try and retry may handle err: every
+// error can be, except the ones that leave a loop, function or program.
+func catchable(err error) bool {
+	switch err.(type) {
+	case *control, *exitError:
+		return false
+	}
+	return true
+}
+
+// loopControl handles an error from a loop body: it reports whether the
+// loop should stop for a break, and passes on any other error.
+func loopControl(err error) (bool, error) {
+	if c, ok := err.(*control); ok && c.kind != "return" {
+		return c.kind == "break", nil
+	}
+	return false, err
+}
+
+// eval evaluates node, enforcing the limits of the environment's
+// interpreter around the actual work done by evalNode.
+func eval(node *Node, env *Env, ln int) (*Value, error, *Env) {
+	if node.Line > 0 {
+		ln = node.Line
+	}
+	in := env.interp
+	if in == nil {
+		v, err, nenv := evalNode(node, env, ln)
+		if err == nil && v == nil {
+			v = mknil()
+		}
+		return v, err, nenv
+	}
+	if err := in.step(ln); err != nil {
+		return nil, err, nil
+	}
+	// current is deliberately left alone when evalNode panics.
+	prev := in.current
+	in.current = node
+	if in.Enter != nil && node.Type == "LIST" {
+		in.Enter(&EvalStep{Node: node, Env: env, Depth: in.depth})
+	}
+	in.depth++
+	v, err, nenv := evalNode(node, env, ln)
+	in.depth--
+	in.current = prev
+	if err == nil && v == nil {
+		v = mknil()
+	}
+	if err == nil {
+		in.counted(node, v, nenv)
+	}
+	if in.Hook != nil && node.Type == "LIST" {
+		in.Hook(&EvalStep{Node: node, Env: env, Value: v, Err: err, Depth: in.depth})
+	}
+	if err == nil && node.Type == "LIST" {
+		if err := in.checkValue(v, ln); err != nil {
+			return nil, err, nil
+		}
+	}
+	if err == nil {
+		if err := in.signalled(env, ln); err != nil {
+			return nil, err, nil
+		}
+	}
+	return v, err, nenv
+}
+
+func evalNode(node *Node, env *Env, ln int) (*Value, error, *Env) {
+	switch node.Type {
+	case "IDENTIFIER":
+		v, ok := env.get(node.Value)
+		if ok {
+			return v, nil, env
+		}
+		return nil, &NameError{Name: node.Value, Line: ln}, env
+	case "INTEGER":
+		if n, err := strconv.Atoi(node.Value); err == nil {
+			return mknum(n), nil, env
+		}
+		v, err := parseInt(node.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%v, line: %d", err, ln), nil
+		}
+		return v, nil, env
+	case "FLOAT":
+		f, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s, line: %d", node.Value, ln), nil
+		}
+		return mkfloat(f), nil, env
+	case "STRING":
+		return mkstr(node.Value), nil, env
+	case "CHAR":
+		return charValue(node), nil, env
+	case "CONST":
+		return constCopy(node.value), nil, env
+	case "LIST":
+		if len(node.Children) == 0 {
+			return nil, fmt.Errorf("empty form, line: %d", ln), nil
+		}
+		name := node.Children[0].Value
+		f, ok := forms[name]
+		if !ok {
+			return evalOther(node, env, ln)
+		}
+		if err := env.interp.allow(name, f.ns, ln); err != nil {
+			return nil, err, nil
+		}
+		if !f.arity.allows(len(node.Children) - 1) {
+			return nil, fmt.Errorf("%s expects %s, got %d, line: %d", name, f.arity, len(node.Children)-1, ln), nil
+		}
+		return f.run(node, env, ln)
+	default:
+		return nil, fmt.Errorf("interpreter internal error 181, line: %d", ln), nil
+	}
+}
+
+// pv prints a value as echo does: a string as its text and anything else
+// as the REPL shows it.
+func pv(node *Value, env *Env, ln int) (error, *Env) {
+	var in *Interpreter
+	if env != nil {
+		in = env.interp
+	}
+	text := in.render(node)
+	if typeof(node) == "string" && (in == nil || !in.CharLists) {
+		text, _ = strval(node)
+	}
+	_, err := fmt.Fprint(in.stdout(), text)
+	return err, env
+}
+
+// quotenode turns an unevaluated node into data: lists stay lists,
+// integers, floats and characters become numbers, strings become character
+// lists and identifiers become symbols.
+func quotenode(node *Node) *Value {
+	switch node.Type {
+	case "INTEGER":
+		if v, err := parseInt(node.Value); err == nil {
+			return v
+		}
+		return mknil()
+	case "FLOAT":
+		f, _ := strconv.ParseFloat(node.Value, 64)
+		return mkfloat(f)
+	case "IDENTIFIER":
+		return &Value{kind: KindSymbol, ref: node.Value}
+	case "STRING":
+		return mkstr(node.Value)
+	case "CHAR":
+		return charValue(node)
+	}
+	lst := []Value{}
+	for _, c := range node.Children {
+		lst = append(lst, *quotenode(c))
+	}
+	return &Value{kind: KindList, listval: &lst}
+}
+
+// unquote is the inverse of quotenode, rebuilding code from data.
+func unquote(v *Value, ln int) (*Node, error) {
+	switch v = asList(v); v.kind {
+	case KindInt:
+		return &Node{Type: "INTEGER", Value: strconv.Itoa(v.varval)}, nil
+	case KindFloat:
+		return &Node{Type: "FLOAT", Value: strconv.FormatFloat(v.realval, 'f', -1, 64)}, nil
+	case KindSymbol:
+		return &Node{Type: "IDENTIFIER", Value: v.sym()}, nil
+	case KindList:
+		node := &Node{Type: "LIST", Children: []*Node{}}
+		for i := range *v.listval {
+			c, err := unquote(&(*v.listval)[i], ln)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, c)
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("cannot evaluate value as code: %+v line: %d", v, ln)
+}
+
+func pass(a any) {
+}
+
+// typeNames are the type annotations a func parameter may carry. int is
+// another name for number.
+var typeNames = map[string]string{
+	"int": "number", "number": "number", "float": "float", "string": "string", "list": "list", "nil": "nil",
+	"function": "function", "dict": "dict", "tuple": "tuple",
+	"symbol": "symbol", "handle": "handle", "set": "set", "error": "error",
+	"sequence": "sequence", "generator": "generator", "coroutine": "coroutine",
+	"any": "any",
+}
+
+// paramParts splits a func parameter into its name node, its type
+// annotation ("" when there is none) and its default expression (nil when
+// there is none). A parameter is a name, [name default], [name type] or
+// [name type default].
+func paramParts(p *Node) (*Node, string, *Node, bool) {
+	if p.Type == "IDENTIFIER" {
+		return p, "", nil, true
+	}
+	if p.Type != "LIST" || len(p.Children) < 2 || len(p.Children) > 3 || p.Children[0].Type != "IDENTIFIER" {
+		return nil, "", nil, false
+	}
+	name, rest := p.Children[0], p.Children[1:]
+	typ := ""
+	if t, ok := typeNames[rest[0].Value]; ok && rest[0].Type == "IDENTIFIER" {
+		typ, rest = t, rest[1:]
+	}
+	switch len(rest) {
+	case 0:
+		return name, typ, nil, true
+	case 1:
+		return name, typ, rest[0], true
+	}
+	return nil, "", nil, false
+}
+
+// parseParams reads a func parameter list.
+func parseParams(params *Node, ln int) (*Function, error) {
+	f := &Function{Args: []string{}, Defaults: []*Node{}, Types: []string{}}
+	for _, p := range params.Children {
+		name, typ, def, ok := paramParts(p)
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter: expected a name, [name default], [name type] or [name type default], line: %d", ln)
+		}
+		f.Args = append(f.Args, name.Value)
+		f.Types = append(f.Types, typ)
+		f.Defaults = append(f.Defaults, def)
+	}
+	return f, nil
+}
+
+// arity returns how many arguments the function accepts; parameters with a
+// default may be left out.
+func (f *Function) arity() arity {
+	a := arity{max: len(f.Args)}
+	for i := range f.Args {
+		if i >= len(f.Defaults) || f.Defaults[i] == nil {
+			a.min++
+		}
+	}
+	return a
+}
+
+// callfunc evaluates the argument nodes of a call and applies f to them.
+// An argument written as [name value], where name is one of the parameters
+// of f, is passed by name instead of by position.
+func callfunc(f *Value, name string, env *Env, ln int, args []*Node) (*Value, error, *Env) {
+	vals := []*Value{}
+	named := map[string]*Value{}
+	for _, a := range args {
+		if name, ok := namedarg(f.fn(), a); ok {
+			if _, dup := named[name]; dup {
+				return nil, fmt.Errorf("argument %s given twice, line: %d", name, ln), nil
+			}
+			x, err, nenv := eval(a.Children[1], env, ln)
+			if err != nil {
+				return nil, err, nil
+			}
+			env = nenv
+			named[name] = x
+			continue
+		}
+		if len(vals) >= len(f.fn().Args) {
+			return nil, fmt.Errorf("%s expects %s, got %d, line: %d", name, f.fn().arity(), len(args), ln), nil
+		}
+		x, err, nenv := eval(a, env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		env = nenv
+		vals = append(vals, x)
+	}
+	for i := range vals {
+		if _, dup := named[f.fn().Args[i]]; dup {
+			return nil, fmt.Errorf("argument %s given twice, line: %d", f.fn().Args[i], ln), nil
+		}
+	}
+	return bindargs(f, name, vals, named, env, ln)
+}
+
+// namedarg reports whether the node a is a [name value] argument naming a
+// parameter of f. Builtin forms keep their usual meaning.
+func namedarg(f *Function, a *Node) (string, bool) {
+	if a.Type != "LIST" || len(a.Children) != 2 || a.Children[0].Type != "IDENTIFIER" {
+		return "", false
+	}
+	name := a.Children[0].Value
+	if isBuiltin(name) {
+		return "", false
+	}
+	for _, p := range f.Args {
+		if p == name {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// applyfunc calls the function value f with already evaluated arguments.
+func applyfunc(f *Value, args []*Value, env *Env, ln int) (*Value, error, *Env) {
+	if len(args) > len(f.fn().Args) {
+		return nil, fmt.Errorf("function expects %s, got %d, line: %d", f.fn().arity(), len(args), ln), nil
+	}
+	return bindargs(f, "function", args, nil, env, ln)
+}
+
+// bindargs binds positional and then named arguments to the parameters of f
+// in a new scope and evaluates its body there. Parameters given neither way
+// take their default values, which may refer to the parameters before them.
+func bindargs(f *Value, name string, args []*Value, named map[string]*Value, env *Env, ln int) (*Value, error, *Env) {
+	if f.fn().memo != nil {
+		return memocall(f, name, args, named, env, ln)
+	}
+	if f.fn().parts != nil {
+		return callparts(f, name, args, named, env, ln)
+	}
+	scope := f.fn().env
+	if scope == nil {
+		scope = env
+	}
+	frame := scope.child()
+	// The call runs on the interpreter of its caller, which for a pmap
+	// worker is not the one the function was made on.
+	if env.interp != nil {
+		frame.interp = env.interp
+	}
+	for i, a := range f.fn().Args {
+		if i < len(args) {
+			frame.vals[a] = args[i]
+			continue
+		}
+		if v, ok := named[a]; ok {
+			frame.vals[a] = v
+			continue
+		}
+		var def *Node
+		if i < len(f.fn().Defaults) {
+			def = f.fn().Defaults[i]
+		}
+		if def == nil && len(named) > 0 {
+			return nil, fmt.Errorf("%s: missing argument %s, line: %d", name, a, ln), nil
+		}
+		if def == nil {
+			return nil, fmt.Errorf("%s expects %s, got %d, line: %d", name, f.fn().arity(), len(args), ln), nil
+		}
+		x, err, _ := eval(def, frame, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		frame.vals[a] = x
+	}
+	if f.fn().gen {
+		return newGenerator(f.fn().expr, frame, ln), nil, env
+	}
+	in := env.interp
+	if in != nil {
+		atomic.AddInt64(&in.counter().ncalls, 1)
+	}
+	leave := in.enter(name, ln, f.fn().file)
+	v, err, _ := eval(f.fn().expr, frame, ln)
+	if err != nil {
+		err = in.traced(err)
+	}
+	leave()
+	if c, ok := err.(*control); ok {
+		// break and continue do not reach loops outside the function.
+		if c.kind != "return" {
+			return nil, errors.New(c.Error()), nil
+		}
+		return c.val, nil, env
+	}
+	if err != nil {
+		return nil, err, nil
+	}
+	return v, nil, env
+}
+
+// expandmacro binds the unevaluated argument nodes as data in a new scope,
+// evaluates the macro template there to build new code and then evaluates
+// that code in the calling scope.
+func expandmacro(m *Value, env *Env, ln int, args []*Node) (*Value, error, *Env) {
+	frame := env.child()
+	for i, a := range m.fn().Args {
+		frame.vals[a] = quotenode(args[i])
+	}
+	data, err, _ := eval(m.fn().expr, frame, ln)
+	if err != nil {
+		return nil, err, nil
+	}
+	code, err := unquote(data, ln)
+	if err != nil {
+		return nil, err, nil
+	}
+	return eval(code, env, ln)
+}
+
+func execast(nodes []*Node, env *Env) (*Env, error) {
+	in := env.interp
+	for i, node := range nodes {
+		// Imported files run inside a top level form of the main program.
+		outer := in != nil && in.toplevel == nil
+		if outer {
+			in.toplevel = node
+		}
+		_, err, nenv := eval(node, env, i)
+		if outer {
+			in.toplevel = nil
+		}
+		env = nenv
+		if err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+func LoadFile(filename string) ([]*Node, error) {
+	if strings.HasSuffix(filename, ".pic") {
+		return loadCompiled(filename)
+	}
+	data, err := readSource(filename)
+	if err != nil {
+		return nil, err
+	}
+	if nodes := cachedAST(data); nodes != nil {
+		return nodes, nil
+	}
+	nodes, diags := parseSource(string(data))
+	if len(diags) > 0 {
+		return nil, diags
+	}
+	cacheAST(data, nodes)
+	return nodes, nil
+}
+
+// stdinSource is the program read from standard input, once it has been.
+var stdinSource []byte
+
+// readSource reads a program file, or standard input when name is "-".
+// Standard input is read once and the same text returned on later calls.
+func readSource(name string) ([]byte, error) {
+	if name != "-" {
+		return os.ReadFile(name)
+	}
+	if stdinSource == nil {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		stdinSource = data
+	}
+	return stdinSource, nil
+}
+
+// RunSource runs a complete program in a fresh environment and returns
+// everything it printed, followed by the error if it failed.
+func RunSource(source string) string {
+	return runCaptured(&Interpreter{}, source)
+}
+
+func runfile(filename string, env *Env) (*Env, error) {
+	code, err := LoadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return runcode(filename, code, env)
+}
+
+// runcode runs code, loaded from filename, in env.
+func runcode(filename string, code []*Node, env *Env) (*Env, error) {
+	in := env.interp
+	saved, savedFile := in.dir, in.file
+	in.dir = filepath.Dir(filename)
+	in.file = sourceName(filename)
+	defer func() { in.dir, in.file = saved, savedFile }()
+
+	if in != nil && in.Optimize {
+		code = optimize(code, in)
+	}
+	env, err2 := execast(code, env)
+
+	if err2 != nil {
+		return nil, err2
+	}
+	// A program that got past its deadline in a builtin not watching the
+	// context has still run out of time.
+	if in.Ctx != nil && in.Ctx.Err() != nil {
+		return nil, stopped(in.Ctx.Err(), 0)
+	}
+
+	return env, nil
+
+}
@@ -0,0 +1,15 @@
+package piku
+
+import "testing"
+
+func TestCallsKeepGlobals(t *testing.T) {
+	out := RunSource(`
+[set x 5]
+[set g [func [x] [set x 1]]]
+[call g 3]
+[echo x]
+`)
+	if out != "5\n" {
+		t.Errorf("got %q, want %q", out, "5\n")
+	}
+}
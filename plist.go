@@ -0,0 +1,189 @@
+package piku
+
+// A persistent list (KindPList) is a list that is never changed in place:
+// append and edit return a new version and leave the old one as it was.
+// The versions share all but the path to what changed, so each of them
+// costs time and space growing with the log of the length rather than the
+// length, which keeps code that builds up a large list one update at a
+// time fast. [plist ...] makes one, as does list when the interpreter is
+// run with --immutable; to everything else it is a list.
+//
+// The elements are held in the leaves of a tree 32 wide, filled from the
+// left, with the last up to 32 elements kept apart in a tail so that
+// appending seldom touches the tree.
+
+const (
+	plistBits  = 5
+	plistWidth = 1 << plistBits
+	plistMask  = plistWidth - 1
+)
+
+type plistNode struct {
+	// kids are the children of an inner node and elems the elements of a
+	// leaf.
+	kids  []*plistNode
+	elems []Value
+}
+
+type plist struct {
+	n int
+	// shift is how far an index is shifted to find the child of the root
+	// it lies under.
+	shift uint
+	root  *plistNode
+	tail  []Value
+}
+
+var emptyPlist = &plist{shift: plistBits, root: &plistNode{}}
+
+// plistOf returns a persistent list of the elements of lst.
+func plistOf(lst []Value) *plist {
+	p := emptyPlist
+	for i := range lst {
+		p = p.push(&lst[i])
+	}
+	return p
+}
+
+func mkplist(p *plist) *Value {
+	return &Value{kind: KindPList, ref: p}
+}
+
+// plist returns the persistent list behind a persistent list value.
+func (v *Value) plist() *plist {
+	p, _ := v.ref.(*plist)
+	return p
+}
+
+func (p *plist) len() int {
+	return p.n
+}
+
+// tailStart is the index of the first element in the tail.
+func (p *plist) tailStart() int {
+	if p.n < plistWidth {
+		return 0
+	}
+	return (p.n - 1) >> plistBits << plistBits
+}
+
+// leaf returns the elements of the leaf, or the tail, holding element i.
+func (p *plist) leaf(i int) []Value {
+	if i >= p.tailStart() {
+		return p.tail
+	}
+	node := p.root
+	for level := p.shift; level > 0; level -= plistBits {
+		node = node.kids[(i>>level)&plistMask]
+	}
+	return node.elems
+}
+
+// get returns element i, which must be in range.
+func (p *plist) get(i int) *Value {
+	e := p.leaf(i)[i&plistMask]
+	return &e
+}
+
+// set returns the list with element i, which must be in range, replaced
+// by v.
+func (p *plist) set(i int, v *Value) *plist {
+	q := *p
+	if i >= p.tailStart() {
+		q.tail = append([]Value(nil), p.tail...)
+		q.tail[i&plistMask] = *v
+		return &q
+	}
+	q.root = setIn(p.shift, p.root, i, v)
+	return &q
+}
+
+func setIn(level uint, node *plistNode, i int, v *Value) *plistNode {
+	if level == 0 {
+		leaf := &plistNode{elems: append([]Value(nil), node.elems...)}
+		leaf.elems[i&plistMask] = *v
+		return leaf
+	}
+	inner := &plistNode{kids: append([]*plistNode(nil), node.kids...)}
+	k := (i >> level) & plistMask
+	inner.kids[k] = setIn(level-plistBits, node.kids[k], i, v)
+	return inner
+}
+
+// push returns the list with v added at the end.
+func (p *plist) push(v *Value) *plist {
+	q := *p
+	q.n++
+	if p.n-p.tailStart() < plistWidth {
+		q.tail = append(append(make([]Value, 0, len(p.tail)+1), p.tail...), *v)
+		return &q
+	}
+	// The tail is full: it becomes a leaf of the tree, growing the tree a
+	// level if the root has no room left.
+	leaf := &plistNode{elems: p.tail}
+	if p.n>>plistBits > 1<<p.shift {
+		q.root = &plistNode{kids: []*plistNode{p.root, newPath(p.shift, leaf)}}
+		q.shift += plistBits
+	} else {
+		q.root = p.pushLeaf(p.shift, p.root, leaf)
+	}
+	q.tail = []Value{*v}
+	return &q
+}
+
+// pushLeaf returns node, at level, with leaf added after its last leaf.
+func (p *plist) pushLeaf(level uint, node, leaf *plistNode) *plistNode {
+	k := ((p.n - 1) >> level) & plistMask
+	inner := &plistNode{kids: append(make([]*plistNode, 0, k+1), node.kids...)}
+	var child *plistNode
+	switch {
+	case level == plistBits:
+		child = leaf
+	case k < len(node.kids):
+		child = p.pushLeaf(level-plistBits, node.kids[k], leaf)
+	default:
+		child = newPath(level-plistBits, leaf)
+	}
+	if k < len(inner.kids) {
+		inner.kids[k] = child
+	} else {
+		inner.kids = append(inner.kids, child)
+	}
+	return inner
+}
+
+// newPath returns leaf under a chain of nodes reaching down from level.
+func newPath(level uint, leaf *plistNode) *plistNode {
+	if level == 0 {
+		return leaf
+	}
+	return &plistNode{kids: []*plistNode{newPath(level-plistBits, leaf)}}
+}
+
+// items returns the elements of the list in a slice of their own.
+func (p *plist) items() []Value {
+	lst := make([]Value, 0, p.n)
+	for i := 0; i < p.tailStart(); i += plistWidth {
+		lst = append(lst, p.leaf(i)...)
+	}
+	return append(lst, p.tail...)
+}
+
+// listLen returns the number of elements of a list, persistent list or
+// tuple.
+func listLen(v *Value) int {
+	if v.kind == KindPList {
+		return v.plist().len()
+	}
+	return len(*v.listval)
+}
+
+// asList returns v as an ordinary list if it is a persistent one, for the
+// builtins that only read the elements of a list, and otherwise v.
+func asList(v *Value) *Value {
+	if v == nil || v.kind != KindPList {
+		return v
+	}
+	lst := v.plist().items()
+	return &Value{kind: KindList, listval: &lst}
+}
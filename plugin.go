@@ -0,0 +1,62 @@
+package piku
+
+import "fmt"
+
+// [loadplugin "path.so"] opens a Go plugin, built with
+// go build -buildmode=plugin, and lets it add builtins. A plugin is built
+// apart from the interpreter, so it deals only in plain Go values: it exports
+//
+//	func Register(add func(name string, fn func(args []any) (any, error)) error) error
+//
+// and calls add for each builtin. Arguments and results are converted by
+// goValue and pikuValue, so that a plugin can hand out database
+// connections and the like as handles and get them back.
+
+func init() {
+	defEager("io", "loadplugin", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		path, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("loadplugin: %v, line: %d", err, ln)
+		}
+		if env.interp == nil {
+			return nil, fmt.Errorf("loadplugin needs an interpreter, line: %d", ln)
+		}
+		if err := env.interp.loadPlugin(path); err != nil {
+			return nil, fmt.Errorf("loadplugin: %v, line: %d", err, ln)
+		}
+		return mknil(), nil
+	})
+}
+
+// pluginRegister is the type of the Register function of a plugin.
+type pluginRegister = func(add func(name string, fn func(args []any) (any, error)) error) error
+
+// loadPlugin opens the plugin at path and registers its builtins with in.
+func (in *Interpreter) loadPlugin(path string) error {
+	sym, err := openPlugin(path, "Register")
+	if err != nil {
+		return err
+	}
+	register, ok := sym.(pluginRegister)
+	if !ok {
+		return fmt.Errorf("%s: Register has type %T, not func(func(string, func([]any) (any, error)) error) error", path, sym)
+	}
+	err = register(func(name string, fn func(args []any) (any, error)) error {
+		return in.RegisterBuiltin(name, func(args []*Value) (*Value, error) {
+			xs := make([]any, len(args))
+			for i, a := range args {
+				xs[i] = goValue(a)
+			}
+			x, err := fn(xs)
+			if err != nil {
+				return nil, err
+			}
+			return pikuValue(x), nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !((linux || darwin) && cgo)
+
+package piku
+
+import "errors"
+
+// openPlugin fails: Go plugins need cgo on Linux or macOS.
+func openPlugin(path, name string) (any, error) {
+	return nil, errors.New("plugins are not supported by this build of piku")
+}
@@ -0,0 +1,14 @@
+//go:build (linux || darwin) && cgo
+
+package piku
+
+import "plugin"
+
+// openPlugin looks up the symbol name in the Go plugin at path.
+func openPlugin(path, name string) (any, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.Lookup(name)
+}
@@ -0,0 +1,127 @@
+package piku
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// pmap calls a function on the elements of a list on a pool of goroutines,
+// one for each processor. Unlike tasks, the workers do run at the same
+// time: each evaluates on an interpreter of its own, in a scope of its own
+// nested in the caller's, and function calls run on the interpreter of
+// their caller, so the workers share only the environments they read.
+// The function should therefore not change variables outside it or edit
+// the lists it is given. The hooks of the interpreter are not called for
+// the forms the workers evaluate.
+
+func init() {
+	defEager("core", "pmap", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f, v := args[0], args[1]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		v = asList(v)
+		if v.kind != KindList {
+			return nil, typeError("list", v, ln)
+		}
+		res, err := env.interp.pmap(f, *v.listval, env, ln)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+}
+
+// worker returns an interpreter for a pmap worker, with the limits of in
+// and the calls in progress, and counting its steps against in.
+func (in *Interpreter) worker() *Interpreter {
+	if in == nil {
+		return nil
+	}
+	return &Interpreter{
+		MaxSteps:          in.MaxSteps,
+		MaxListLen:        in.MaxListLen,
+		Ctx:               in.Ctx,
+		Restricted:        in.Restricted,
+		Disabled:          in.Disabled,
+		Optimize:          in.Optimize,
+		Immutable:         in.Immutable,
+		CheckedArithmetic: in.CheckedArithmetic,
+		PrintDepth:        in.PrintDepth,
+		PrintWidth:        in.PrintWidth,
+		CharLists:         in.CharLists,
+		LogLevel:          in.LogLevel,
+		Stdout:            in.Stdout,
+		Stderr:            in.Stderr,
+		Stdin:             in.Stdin,
+		current:           in.current,
+		toplevel:          in.toplevel,
+		depth:             in.depth,
+		dir:               in.dir,
+		file:              in.file,
+		calls:             append([]callFrame(nil), in.calls...),
+		builtins:          in.builtins,
+		parent:            in,
+	}
+}
+
+// pmap calls f on each element of lst and returns the results in order.
+// If calls fail, the error of the first element that failed is returned.
+func (in *Interpreter) pmap(f *Value, lst []Value, env *Env, ln int) (*Value, error) {
+	results := make([]Value, len(lst))
+	errs := make([]error, len(lst))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(lst) {
+		workers = len(lst)
+	}
+	// Elements are handed out in order, so once one fails the workers
+	// need only finish those before it.
+	var next atomic.Int64
+	var failed atomic.Int64
+	failed.Store(int64(len(lst)))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scope := &Env{vals: map[string]*Value{}, parent: env, interp: in.worker()}
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(len(lst)) || i > failed.Load() {
+					return
+				}
+				v, err := pcall(f, lst[i], scope, ln)
+				if err != nil {
+					errs[i] = err
+					for {
+						j := failed.Load()
+						if i > j || failed.CompareAndSwap(j, i) {
+							break
+						}
+					}
+					continue
+				}
+				results[i] = *v
+			}
+		}()
+	}
+	wg.Wait()
+	if i := failed.Load(); i < int64(len(lst)) {
+		return nil, errs[i]
+	}
+	return &Value{kind: KindList, listval: &results}, nil
+}
+
+// pcall calls f on x for a pmap worker, turning a crash into an error
+// rather than taking the program down from a goroutine it cannot recover.
+func pcall(f *Value, x Value, env *Env, ln int) (v *Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("pmap: internal error: %v, line: %d", r, ln)
+		}
+	}()
+	v, err, _ = applyfunc(f, []*Value{&x}, env, ln)
+	return v, err
+}
@@ -0,0 +1,151 @@
+package piku
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Values are shown the way they would be written: [list 1 2 3],
+// [dict [name "Grace"]], "text" for a string of printable characters, and
+// <func (a b)> for the values that cannot be written. The interpreter may
+// bound how deep and how long a value is shown, so that a large one does
+// not flood the terminal.
+
+// printer renders values within the limits of an interpreter.
+type printer struct {
+	// maxDepth is how many containers deep elements are shown, and
+	// maxWidth how many elements of each; 0 means no limit.
+	maxDepth, maxWidth int
+	// charLists shows strings as the lists of character codes they are.
+	charLists bool
+	sb        strings.Builder
+}
+
+// render returns v as it is shown by the REPL, strings quoted.
+func (in *Interpreter) render(v *Value) string {
+	if in == nil {
+		return show(v, 0, 0)
+	}
+	p := &printer{maxDepth: in.PrintDepth, maxWidth: in.PrintWidth, charLists: in.CharLists}
+	p.value(v, 0)
+	return p.sb.String()
+}
+
+// renderText returns v as echostr shows it: a list of character codes as
+// its text, and anything else as render does but with the strings in it
+// quoted even under CharLists.
+func (in *Interpreter) renderText(v *Value) string {
+	if s, err := strval(v); err == nil {
+		return s
+	}
+	if in == nil {
+		return show(v, 0, 0)
+	}
+	return show(v, in.PrintDepth, in.PrintWidth)
+}
+
+// show returns v as the REPL shows it, within the limits given.
+func show(v *Value, maxDepth, maxWidth int) string {
+	p := &printer{maxDepth: maxDepth, maxWidth: maxWidth}
+	p.value(v, 0)
+	return p.sb.String()
+}
+
+// quoteString returns s as a string literal.
+func quoteString(s string) string {
+	return `"` + escape(s, '"') + `"`
+}
+
+func (p *printer) value(v *Value, depth int) {
+	switch v.kind {
+	case KindInt:
+		p.sb.WriteString(strconv.Itoa(v.varval))
+	case KindBigInt:
+		p.sb.WriteString(v.big().String())
+	case KindFloat:
+		p.sb.WriteString(formatFloat(v.realval))
+	case KindNil:
+		p.sb.WriteString("nil")
+	case KindSymbol:
+		p.sb.WriteString(v.sym())
+	case KindError:
+		p.sb.WriteString("[error ")
+		if v.scriptErr().code != nil {
+			p.value(v.scriptErr().code, depth+1)
+			p.sb.WriteString(" ")
+		}
+		p.sb.WriteString(quoteString(v.scriptErr().msg) + "]")
+	case KindFunc, KindMacro:
+		kind := "func"
+		if v.kind == KindMacro {
+			kind = "macro"
+		} else if v.fn().gen {
+			kind = "genfunc"
+		}
+		fmt.Fprintf(&p.sb, "<%s (%s)>", kind, strings.Join(v.fn().Args, " "))
+	case KindHandle:
+		fmt.Fprintf(&p.sb, "<%v>", v.handle())
+	case KindSeq:
+		p.sb.WriteString("<sequence>")
+	case KindGenerator:
+		p.sb.WriteString("<generator>")
+	case KindCoroutine:
+		p.sb.WriteString("<coroutine>")
+	case KindList:
+		if !p.charLists && typeof(v) == "string" {
+			s, _ := strval(v)
+			p.sb.WriteString(quoteString(s))
+			return
+		}
+		p.elems("list", *v.listval, depth)
+	case KindTuple:
+		p.elems("tuple", *v.listval, depth)
+	case KindPList:
+		p.elems("plist", v.plist().items(), depth)
+	case KindSet:
+		p.elems("set-new", setElems(v), depth)
+	case KindDict:
+		keys := sortedKeys(v.dictval)
+		p.open("dict", len(keys), depth, func(i int) {
+			k, e := keys[i], v.dictval[keys[i]]
+			if isIdent(k) {
+				p.sb.WriteString("[" + k + " ")
+			} else {
+				p.sb.WriteString("[" + quoteString(k) + " ")
+			}
+			p.value(&e, depth+1)
+			p.sb.WriteString("]")
+		})
+	default:
+		fmt.Fprintf(&p.sb, "<unprintable %s>", v.kind)
+	}
+}
+
+func (p *printer) elems(head string, lst []Value, depth int) {
+	p.open(head, len(lst), depth, func(i int) {
+		p.value(&lst[i], depth+1)
+	})
+}
+
+// open writes a container of n elements headed by head, calling elem to
+// write each one shown.
+func (p *printer) open(head string, n, depth int, elem func(int)) {
+	p.sb.WriteString("[" + head)
+	if n > 0 && p.maxDepth > 0 && depth >= p.maxDepth {
+		p.sb.WriteString(" ...]")
+		return
+	}
+	shown := n
+	if p.maxWidth > 0 && n > p.maxWidth {
+		shown = p.maxWidth
+	}
+	for i := 0; i < shown; i++ {
+		p.sb.WriteString(" ")
+		elem(i)
+	}
+	if shown < n {
+		fmt.Fprintf(&p.sb, " ... %d more", n-shown)
+	}
+	p.sb.WriteString("]")
+}
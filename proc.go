@@ -0,0 +1,340 @@
+package piku
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+func init() {
+	defEager("io", "spawnproc", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		name, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("spawnproc: %v, line: %d", err, ln)
+		}
+		argv, err := strlist(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("spawnproc: %v, line: %d", err, ln)
+		}
+		p, err := spawnProc(name, argv, env.interp.childStdin(), env.interp.stderr())
+		if err != nil {
+			return nil, fmt.Errorf("spawnproc: %v, line: %d", err, ln)
+		}
+		return &Value{kind: KindHandle, ref: p}, nil
+	})
+	procForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			h := args[0]
+			p, err := prochandle(h, op, ln)
+			if err != nil {
+				return nil, err
+			}
+			if op == "prockill" {
+				if err := p.kill(); err != nil {
+					return nil, fmt.Errorf("prockill: %v, line: %d", err, ln)
+				}
+				return mknil(), nil
+			}
+			code, err := p.wait(env.interp.stdout())
+			if err != nil {
+				return nil, fmt.Errorf("procwait: %v, line: %d", err, ln)
+			}
+			return &Value{kind: KindInt, varval: code}, nil
+		}
+	}
+	defEager("io", "procwait", arity{1, 1}, procForm("procwait"))
+	defEager("io", "prockill", arity{1, 1}, procForm("prockill"))
+	defEager("io", "procstdout", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		p, err := prochandle(h, "procstdout", ln)
+		if err != nil {
+			return nil, err
+		}
+		handler := args[1]
+		if handler.kind != KindFunc {
+			return nil, fmt.Errorf("procstdout expects a function handler, got %s, line: %d", typename(handler), ln)
+		}
+		for {
+			line, err := p.readLine()
+			if err == io.EOF {
+				return mknil(), nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("procstdout: %v, line: %d", err, ln)
+			}
+			_, err, nenv := applyfunc(handler, []*Value{mkstr(line)}, env, ln)
+			if err != nil {
+				return nil, err
+			}
+			env = nenv
+		}
+	})
+	defSpecial("io", "pipeline", arity{1, -1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		if len(node.Children) < 2 {
+			return nil, fmt.Errorf("pipeline expects at least one command, line: %d", ln), nil
+		}
+		stages := [][]string{}
+		for _, s := range node.Children[1:] {
+			if s.Type != "LIST" || len(s.Children) == 0 {
+				return nil, fmt.Errorf("pipeline expects commands written as [cmd args...], line: %d", ln), nil
+			}
+			words := []string{}
+			for _, w := range s.Children {
+				v, err, nenv := eval(w, env, ln)
+				if err != nil {
+					return nil, err, nil
+				}
+				env = nenv
+				word, err := strval(v)
+				if err != nil {
+					return nil, fmt.Errorf("pipeline: %v, line: %d", err, ln), nil
+				}
+				words = append(words, word)
+			}
+			stages = append(stages, words)
+		}
+		out, err := runPipeline(stages, env.interp.childStdin(), env.interp.stderr())
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: %v, line: %d", err, ln), nil
+		}
+		return mkstr(string(out)), nil, env
+	})
+	defSpecial("io", "exec", arity{2, 4}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		cmdv, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		argv, err, env := eval(node.Children[2], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		name, err := strval(cmdv)
+		if err != nil {
+			return nil, fmt.Errorf("exec: %v, line: %d", err, ln), nil
+		}
+		args, err := strlist(argv)
+		if err != nil {
+			return nil, fmt.Errorf("exec: %v, line: %d", err, ln), nil
+		}
+		var timeout time.Duration
+		var vars []string
+		for _, opt := range node.Children[3:] {
+			if opt.Type != "LIST" || len(opt.Children) != 2 {
+				return nil, fmt.Errorf("exec options are written [timeout seconds] or [env vars], line: %d", ln), nil
+			}
+			v, err, nenv := eval(opt.Children[1], env, ln)
+			if err != nil {
+				return nil, err, nil
+			}
+			env = nenv
+			switch opt.Children[0].Value {
+			case "timeout":
+				if !isNumber(v) {
+					return nil, fmt.Errorf("exec: timeout expects a number of seconds, got %s, line: %d", typename(v), ln), nil
+				}
+				timeout = time.Duration(floatval(v) * float64(time.Second))
+			case "env":
+				if vars, err = strlist(v); err != nil {
+					return nil, fmt.Errorf("exec: env: %v, line: %d", err, ln), nil
+				}
+			default:
+				return nil, fmt.Errorf("exec: unknown option %s, line: %d", opt.Children[0].Value, ln), nil
+			}
+		}
+		res, err := execCommand(env.interp.context(), name, args, vars, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("exec: %v, line: %d", err, ln), nil
+		}
+		timedout := 0
+		if res.timedOut {
+			timedout = 1
+		}
+		return &Value{kind: KindDict, dictval: map[string]Value{
+			"status":   {kind: KindInt, varval: res.status},
+			"stdout":   *mkstr(string(res.stdout)),
+			"stderr":   *mkstr(string(res.stderr)),
+			"timedout": {kind: KindInt, varval: timedout},
+		}}, nil, env
+	})
+}
+
+// process is the handle value behind spawnproc. Its stdout is read line by
+// line with procstdout; whatever is left unread is copied to the program's
+// output when the process is waited for.
+type process struct {
+	cmd    *exec.Cmd
+	out    *bufio.Reader
+	waited bool
+	code   int
+}
+
+func (p *process) String() string {
+	return fmt.Sprintf("process %d", p.cmd.Process.Pid)
+}
+
+// Processes still running when the interpreter exits are killed.
+var procs struct {
+	sync.Mutex
+	list []*process
+}
+
+// spawnProc starts name with stdin and stderr as its standard input and
+// error.
+func spawnProc(name string, args []string, stdin io.Reader, stderr io.Writer) (*process, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = stderr
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, out: bufio.NewReader(pipe)}
+	procs.Lock()
+	procs.list = append(procs.list, p)
+	procs.Unlock()
+	return p, nil
+}
+
+// readLine returns the next line of output without its newline, or io.EOF
+// once the process has closed its stdout.
+func (p *process) readLine() (string, error) {
+	line, err := p.out.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	return line, err
+}
+
+// wait blocks until the process exits and returns its exit code. A process
+// killed by a signal reports -1.
+func (p *process) wait(w io.Writer) (int, error) {
+	if p.waited {
+		return p.code, nil
+	}
+	io.Copy(w, p.out)
+	err := p.cmd.Wait()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return 0, err
+	}
+	p.waited = true
+	p.code = p.cmd.ProcessState.ExitCode()
+	return p.code, nil
+}
+
+func (p *process) kill() error {
+	if p.waited {
+		return nil
+	}
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+func cleanupProcs() {
+	procs.Lock()
+	defer procs.Unlock()
+	for _, p := range procs.list {
+		if !p.waited {
+			p.cmd.Process.Kill()
+			p.cmd.Wait()
+		}
+	}
+	procs.list = nil
+}
+
+// prochandle extracts the process behind a handle value.
+func prochandle(v *Value, op string, ln int) (*process, error) {
+	if p, ok := v.handle().(*process); ok && v.kind == KindHandle {
+		return p, nil
+	}
+	return nil, fmt.Errorf("%s expects a process handle, got %s, line: %d", op, typename(v), ln)
+}
+
+// runPipeline runs the commands with the stdout of each connected to the
+// stdin of the next, like a shell pipeline, and returns the output of the
+// last one. As in a shell, only failing to start a command is an error;
+// exit codes are ignored. The first command reads stdin, and all of them
+// write their errors to stderr.
+func runPipeline(stages [][]string, stdin io.Reader, stderr io.Writer) ([]byte, error) {
+	cmds := make([]*exec.Cmd, len(stages))
+	for i, s := range stages {
+		cmds[i] = exec.Command(s[0], s[1:]...)
+		cmds[i].Stderr = stderr
+	}
+	cmds[0].Stdin = stdin
+	for i := 1; i < len(cmds); i++ {
+		pipe, err := cmds[i-1].StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		cmds[i].Stdin = pipe
+	}
+	var out bytes.Buffer
+	cmds[len(cmds)-1].Stdout = &out
+	for i, c := range cmds {
+		if err := c.Start(); err != nil {
+			for _, started := range cmds[:i] {
+				started.Process.Kill()
+				started.Wait()
+			}
+			return nil, err
+		}
+	}
+	for _, c := range cmds {
+		c.Wait()
+	}
+	return out.Bytes(), nil
+}
+
+// execResult is what exec reports about a finished command.
+type execResult struct {
+	status         int
+	stdout, stderr []byte
+	timedOut       bool
+}
+
+// execCommand runs name to completion, capturing its output. A non-zero
+// exit status is part of the result rather than an error. With a timeout
+// the command is killed once it runs longer, or when ctx is done.
+func execCommand(ctx context.Context, name string, args []string, env []string, timeout time.Duration) (*execResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var out, errout bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errout
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		return nil, err
+	}
+	return &execResult{
+		status:   cmd.ProcessState.ExitCode(),
+		stdout:   out.Bytes(),
+		stderr:   errout.Bytes(),
+		timedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}, nil
+}
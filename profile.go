@@ -0,0 +1,280 @@
+package piku
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// piku --profile counts the forms evaluated and the functions called, and
+// how long they took, and prints the busiest of each when the program
+// ends. Forms are timed through the Enter and Hook of the interpreter,
+// calls as they enter and leave the call stack. The time of a form or
+// function includes what it calls; a recursive one is timed only from its
+// outermost use, so that it is not counted twice.
+
+// maxProfileRows bounds the lines of each table in the report.
+const maxProfileRows = 20
+
+type profileEntry struct {
+	name  string
+	count int
+	total time.Duration
+	// self is the time spent in the function itself, less the calls it
+	// made. Forms do not track it.
+	self time.Duration
+}
+
+// profileSample is the time spent in one call stack, leaf first.
+type profileSample struct {
+	stack []string
+	calls int64
+	self  time.Duration
+}
+
+type profiler struct {
+	start   time.Time
+	steps   int
+	forms   map[string]*profileEntry
+	funcs   map[string]*profileEntry
+	samples map[string]*profileSample
+	// running are the forms started and not finished, innermost last.
+	running []profileForm
+	// active counts the running forms of each name.
+	active map[string]int
+}
+
+type profileForm struct {
+	node  *Node
+	name  string
+	start time.Time
+}
+
+func newProfiler() *profiler {
+	return &profiler{
+		start:   time.Now(),
+		forms:   map[string]*profileEntry{},
+		funcs:   map[string]*profileEntry{},
+		samples: map[string]*profileSample{},
+		active:  map[string]int{},
+	}
+}
+
+func entry(m map[string]*profileEntry, name string) *profileEntry {
+	e, ok := m[name]
+	if !ok {
+		e = &profileEntry{name: name}
+		m[name] = e
+	}
+	return e
+}
+
+func (p *profiler) enter(s *EvalStep) {
+	p.steps++
+	if len(s.Node.Children) == 0 || s.Node.Children[0].Type != "IDENTIFIER" {
+		return
+	}
+	name := s.Node.Children[0].Value
+	p.active[name]++
+	p.running = append(p.running, profileForm{s.Node, name, time.Now()})
+}
+
+func (p *profiler) leave(s *EvalStep) {
+	// Tasks take turns, so the form finishing is not always the last one
+	// started; it is found by its node, and forms above it are dropped.
+	for i := len(p.running) - 1; i >= 0; i-- {
+		f := p.running[i]
+		if f.node != s.Node {
+			continue
+		}
+		for _, g := range p.running[i:] {
+			p.active[g.name]--
+		}
+		p.running = p.running[:i]
+		e := entry(p.forms, f.name)
+		e.count++
+		if p.active[f.name] == 0 {
+			e.total += time.Since(f.start)
+		}
+		return
+	}
+}
+
+// called records the end of the innermost call of calls.
+func (p *profiler) called(calls []callFrame) {
+	top := calls[len(calls)-1]
+	total := time.Since(top.start)
+	if len(calls) > 1 {
+		calls[len(calls)-2].inner += total
+	}
+	e := entry(p.funcs, top.name)
+	e.count++
+	e.self += total - top.inner
+	recursive := false
+	for _, c := range calls[:len(calls)-1] {
+		recursive = recursive || c.name == top.name
+	}
+	if !recursive {
+		e.total += total
+	}
+	stack := make([]string, len(calls))
+	for i, c := range calls {
+		stack[len(stack)-1-i] = c.name
+	}
+	key := strings.Join(stack, "\x00")
+	s, ok := p.samples[key]
+	if !ok {
+		s = &profileSample{stack: stack}
+		p.samples[key] = s
+	}
+	s.calls++
+	s.self += total - top.inner
+}
+
+// sorted returns the entries of m, the longest running first.
+func sorted(m map[string]*profileEntry) []*profileEntry {
+	var es []*profileEntry
+	for _, e := range m {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].total != es[j].total {
+			return es[i].total > es[j].total
+		}
+		return es[i].name < es[j].name
+	})
+	return es
+}
+
+// report writes the tables of functions and forms to w.
+func (p *profiler) report(w io.Writer) {
+	fmt.Fprintf(w, "profile: %d forms evaluated in %v\n", p.steps, time.Since(p.start).Round(time.Microsecond))
+	if len(p.funcs) > 0 {
+		fmt.Fprintf(w, "\n%-24s %10s %14s %14s\n", "function", "calls", "total", "self")
+		for i, e := range sorted(p.funcs) {
+			if i == maxProfileRows {
+				fmt.Fprintf(w, "... %d more\n", len(p.funcs)-i)
+				break
+			}
+			fmt.Fprintf(w, "%-24s %10d %14v %14v\n", e.name, e.count, e.total.Round(time.Microsecond), e.self.Round(time.Microsecond))
+		}
+	}
+	if len(p.forms) > 0 {
+		fmt.Fprintf(w, "\n%-24s %10s %14s\n", "form", "count", "total")
+		for i, e := range sorted(p.forms) {
+			if i == maxProfileRows {
+				fmt.Fprintf(w, "... %d more\n", len(p.forms)-i)
+				break
+			}
+			fmt.Fprintf(w, "%-24s %10d %14v\n", e.name, e.count, e.total.Round(time.Microsecond))
+		}
+	}
+}
+
+// writePprof writes the calls as a gzipped profile in the format of
+// pprof, with the number of calls and the time spent in each call stack.
+func (p *profiler) writePprof(w io.Writer) error {
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return uint64(i)
+		}
+		strs[s] = len(table)
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+	var prof protoBuf
+	for _, t := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuf
+		vt.uint(1, str(t[0]))
+		vt.uint(2, str(t[1]))
+		prof.bytes(1, vt)
+	}
+	keys := make([]string, 0, len(p.samples))
+	for k := range p.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	funcs := map[string]uint64{}
+	var names []string
+	for _, k := range keys {
+		s := p.samples[k]
+		var locs []uint64
+		for _, name := range s.stack {
+			id, ok := funcs[name]
+			if !ok {
+				id = uint64(len(funcs) + 1)
+				funcs[name] = id
+				names = append(names, name)
+			}
+			locs = append(locs, id)
+		}
+		var sample protoBuf
+		sample.packed(1, locs)
+		sample.packed(2, []uint64{uint64(s.calls), uint64(s.self.Nanoseconds())})
+		prof.bytes(2, sample)
+	}
+	// Each function has one location, with the same id.
+	for i, name := range names {
+		id := uint64(i + 1)
+		var line, loc, fn protoBuf
+		line.uint(1, id)
+		loc.uint(1, id)
+		loc.bytes(4, line)
+		prof.bytes(4, loc)
+		fn.uint(1, id)
+		fn.uint(2, str(name))
+		fn.uint(3, str(name))
+		prof.bytes(5, fn)
+	}
+	// The strings are added last, once every one has been used.
+	prof.uint(9, uint64(p.start.UnixNano()))
+	prof.uint(10, uint64(time.Since(p.start).Nanoseconds()))
+	for _, s := range table {
+		prof.str(6, s)
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(prof); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuf builds an encoded protocol buffer message, which is all pprof
+// needs of the format.
+type protoBuf []byte
+
+func (b *protoBuf) varint(x uint64) {
+	for x >= 0x80 {
+		*b = append(*b, byte(x)|0x80)
+		x >>= 7
+	}
+	*b = append(*b, byte(x))
+}
+
+func (b *protoBuf) uint(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuf) str(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuf) packed(field int, xs []uint64) {
+	var data protoBuf
+	for _, x := range xs {
+		data.varint(x)
+	}
+	b.bytes(field, data)
+}
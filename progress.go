@@ -0,0 +1,69 @@
+package piku
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func init() {
+	defEager("core", "progress", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if v.kind != KindInt || v.varval <= 0 {
+			return nil, fmt.Errorf("progress expects a positive total, line: %d", ln)
+		}
+		return &Value{kind: KindHandle, ref: newProgress(v.varval, env.interp.stderr())}, nil
+	})
+	defEager("core", "progress-tick", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		p, ok := h.handle().(*progressBar)
+		if !ok || h.kind != KindHandle {
+			return nil, fmt.Errorf("progress-tick expects a progress handle, got %s, line: %d", typename(h), ln)
+		}
+		p.tick(1)
+		return mknil(), nil
+	})
+}
+
+const progressWidth = 30
+
+// progressBar is the handle value behind progress. It is drawn on the
+// interpreter's stderr so that it does not mix with the program's output;
+// when that is not a terminal only the finished bar is printed.
+type progressBar struct {
+	total, done int
+	out         io.Writer
+	live        bool
+}
+
+// newProgress returns a bar drawn on w, redrawn as it advances if w is a
+// terminal.
+func newProgress(total int, w io.Writer) *progressBar {
+	f, ok := w.(*os.File)
+	return &progressBar{total: total, out: w, live: ok && isTerminal(int(f.Fd()))}
+}
+
+func (p *progressBar) String() string {
+	return fmt.Sprintf("progress %d/%d", p.done, p.total)
+}
+
+// tick advances the bar by n steps and redraws it.
+func (p *progressBar) tick(n int) {
+	if p.done >= p.total {
+		return
+	}
+	p.done += n
+	if p.done > p.total {
+		p.done = p.total
+	}
+	finished := p.done == p.total
+	if !p.live && !finished {
+		return
+	}
+	filled := progressWidth * p.done / p.total
+	fmt.Fprintf(p.out, "\r[%s%s] %d/%d %3d%%", strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), p.done, p.total, 100*p.done/p.total)
+	if finished {
+		fmt.Fprintln(p.out)
+	}
+}
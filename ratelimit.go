@@ -0,0 +1,82 @@
+package piku
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	defEager("core", "retry", arity{3, 3}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		nv, dv, f := args[0], args[1], args[2]
+		if nv.kind != KindInt || nv.varval < 1 {
+			return nil, fmt.Errorf("retry expects a positive number of attempts, line: %d", ln)
+		}
+		if !isNumber(dv) {
+			return nil, typeError("number", dv, ln)
+		}
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		delay := time.Duration(floatval(dv) * float64(time.Second))
+		for attempt := 1; ; attempt++ {
+			v, err, _ := applyfunc(f, nil, env, ln)
+			if err == nil {
+				return v, nil
+			}
+			if !catchable(err) {
+				return nil, err
+			}
+			if attempt == nv.varval {
+				return nil, fmt.Errorf("retry: gave up after %d attempts: %w", attempt, err)
+			}
+			if err := env.interp.sleep(delay, ln); err != nil {
+				return nil, err
+			}
+			delay *= 2
+		}
+	})
+	defEager("core", "ratelimit", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if !isNumber(v) || floatval(v) <= 0 {
+			return nil, fmt.Errorf("ratelimit expects a positive number of calls per second, line: %d", ln)
+		}
+		return &Value{kind: KindHandle, ref: newRateLimiter(floatval(v))}, nil
+	})
+	defEager("core", "ratelimit-wait", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		h := args[0]
+		r, ok := h.handle().(*rateLimiter)
+		if !ok || h.kind != KindHandle {
+			return nil, fmt.Errorf("ratelimit-wait expects a ratelimit handle, got %s, line: %d", typename(h), ln)
+		}
+		if err := env.interp.sleep(r.reserve(), ln); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+}
+
+// rateLimiter is the handle value behind ratelimit. It spaces calls to
+// wait evenly, allowing at most perSecond of them each second.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (r *rateLimiter) String() string {
+	return fmt.Sprintf("ratelimit %g/s", float64(time.Second)/float64(r.interval))
+}
+
+// reserve claims the next free slot and returns how long to wait for it.
+func (r *rateLimiter) reserve() time.Duration {
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	d := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	return d
+}
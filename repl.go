@@ -0,0 +1,93 @@
+package piku
+
+import (
+	"fmt"
+	"strings"
+)
+
+// repl reads forms from the terminal and evaluates them in env, printing
+// every result other than nil, until the input ends or exit is called. It
+// returns the error of exit, if any. A form left open at the end of a line
+// is continued on the next, read with a prompt of its own; Ctrl-C there
+// drops the form.
+func repl(env *Env) error {
+	ed := newLineEditor(historyPath(), completer(env))
+	ed.cancel = true
+	for ln := 1; ; ln++ {
+		line, err := ed.readLine("piku> ")
+		if err == errCancelled {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		if cmd := strings.Fields(line); len(cmd) > 0 && cmd[0] == ":help" {
+			replHelp(strings.Join(cmd[1:], " "), env)
+			continue
+		}
+		for err == nil && unfinished(line) {
+			var more string
+			more, err = ed.readLine("....> ")
+			line += "\n" + more
+		}
+		if err == errCancelled {
+			continue
+		}
+		if err != nil {
+			return nil
+		}
+		nodes, err := parseLine(line)
+		if err != nil {
+			fmt.Println("Error", err)
+			continue
+		}
+		for _, node := range nodes {
+			v, err, nenv := eval(node, env, ln)
+			if _, ok := err.(*exitError); ok {
+				return err
+			}
+			if err != nil {
+				fmt.Printf("Error %v%s\n", err, traceback(err))
+				break
+			}
+			env = nenv
+			if !isnil(v) {
+				fmt.Fprintln(env.interp.stdout(), env.interp.render(v))
+			}
+		}
+	}
+}
+
+// unfinished reports whether src stops inside a form or a string.
+func unfinished(src string) bool {
+	tokens, diags := tokenizeRecover(src)
+	for _, d := range diags {
+		// A string with no closing quote is reported at its opening one.
+		if d.Msg == fmt.Sprintf("unexpected character: %q", '"') {
+			return true
+		}
+	}
+	depth := 0
+	for _, t := range tokens {
+		switch t.Type {
+		case "LBRACKET":
+			depth++
+		case "RBRACKET":
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// parseLine parses a line typed at a prompt: either forms or a single atom,
+// such as the name of a variable.
+func parseLine(line string) ([]*Node, error) {
+	tokens, err := tokenize(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 && tokens[0].Type != "LBRACKET" && tokens[0].Type != "OPERATOR" {
+		return []*Node{atomNode(tokens[0])}, nil
+	}
+	return parseMultipleLists(tokens)
+}
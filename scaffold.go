@@ -0,0 +1,95 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Project templates for piku new. NAME is replaced by the project name,
+// which is also the module that main.pi and main_test.pi import, so the
+// name must be a valid identifier. main_test.pi is named for piku test to
+// find it.
+//
+// The manifest, piku.toml, gives the name and version of the project and
+// its entry point: main.pi for a cli, the module for a lib.
+var templates = map[string]map[string]string{
+	"cli": {
+		"piku.toml":    manifest + "main = \"main.pi\"\n",
+		"NAME.pi":      libModule,
+		"main.pi":      "[import NAME]\n[print [call greet \"world\"]]\n[newline]\n",
+		"main_test.pi": libTest,
+		".gitignore":   gitignore,
+	},
+	"lib": {
+		"piku.toml":    manifest + "main = \"NAME.pi\"\n",
+		"NAME.pi":      libModule,
+		"main_test.pi": libTest,
+		".gitignore":   gitignore,
+	},
+}
+
+const (
+	manifest  = "name = \"NAME\"\nversion = \"0.1.0\"\n"
+	libModule = "[set greet [func [who] [concat \"Hello, \" who]]]\n"
+	gitignore = "*.pic\n"
+	libTest   = "[import NAME]\n[asserteq [call greet \"piku\"] \"Hello, piku\" \"greet\"]\n"
+)
+
+var projectName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9-]*$`)
+
+// newCmd implements "piku new name [--template=cli|lib]".
+func newCmd(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	tmpl := fs.String("template", "cli", "project template: cli or lib")
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		return errors.New("usage: piku new name [--template=cli|lib]")
+	}
+	if !projectName.MatchString(name) {
+		return fmt.Errorf("project name %q must be a valid identifier so it can be imported", name)
+	}
+	if *tmpl == "web" {
+		return errors.New("the web template needs HTTP builtins, which piku does not have yet")
+	}
+	files, ok := templates[*tmpl]
+	if !ok {
+		return fmt.Errorf("unknown template %q: expected cli or lib", *tmpl)
+	}
+	if _, err := os.Stat(name); err == nil {
+		return fmt.Errorf("%s already exists", name)
+	}
+	if err := os.Mkdir(name, 0o755); err != nil {
+		return err
+	}
+	paths := []string{}
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		content := strings.ReplaceAll(files[p], "NAME", name)
+		path := filepath.Join(name, strings.ReplaceAll(p, "NAME", name))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+		fmt.Println("created", path)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewProjectPassesItsTests(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, tmpl := range []string{"cli", "lib"} {
+		name := "demo_" + tmpl
+		if err := newCmd([]string{name, "--template=" + tmpl}); err != nil {
+			t.Fatal(err)
+		}
+		if err := testCmd([]string{name}); err != nil {
+			t.Errorf("%s: piku test: %v", tmpl, err)
+		}
+		data, err := os.ReadFile(filepath.Join(name, "piku.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := parseTOML(string(data))
+		if err != nil {
+			t.Fatalf("%s: piku.toml: %v", tmpl, err)
+		}
+		if m["name"] != name {
+			t.Errorf("%s: manifest names %v", tmpl, m["name"])
+		}
+		if _, err := os.Stat(filepath.Join(name, m["main"].(string))); err != nil {
+			t.Errorf("%s: manifest entry point: %v", tmpl, err)
+		}
+	}
+}
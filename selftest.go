@@ -0,0 +1,234 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// piku selftest runs the golden tests of the interpreter: every program
+// testdata/name.pi is run and what it prints, errors included, compared
+// with testdata/name.expected. A change to the language comes with a
+// program using it and the output it should give; piku selftest -update
+// writes the .expected files from what the programs print now, to be read
+// over before they are committed.
+
+// goldenTimeout bounds how long one golden program may run.
+const goldenTimeout = 10 * time.Second
+
+// diffContext is how many unchanged lines a diff shows around a change.
+const diffContext = 2
+
+type goldenResult struct {
+	name string
+	// diff is the difference between the expected output and the actual,
+	// empty when they match.
+	diff []string
+	// err is set when the program could not be run or its expected output
+	// not read or written.
+	err error
+}
+
+func (r goldenResult) passed() bool {
+	return r.err == nil && len(r.diff) == 0
+}
+
+// runGolden runs the golden tests in dir, or with update writes their
+// expected output. It is what piku selftest runs, and a Go test can call
+// it on testdata and report each result that did not pass.
+func runGolden(dir string, update bool) ([]goldenResult, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pi"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pi files in %s", dir)
+	}
+	var results []goldenResult
+	for _, file := range files {
+		res := goldenResult{name: strings.TrimSuffix(filepath.Base(file), ".pi")}
+		expected := strings.TrimSuffix(file, ".pi") + ".expected"
+		got, err := goldenOutput(file)
+		switch {
+		case err != nil:
+			res.err = err
+		case update:
+			res.err = os.WriteFile(expected, []byte(got), 0644)
+		default:
+			want, err := os.ReadFile(expected)
+			if err != nil {
+				res.err = err
+				break
+			}
+			res.diff = lineDiff(string(want), got)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// goldenOutput runs the program in file on an interpreter of its own, with
+// nothing on standard input, and returns what it printed to standard
+// output and standard error. An error stopping the program is reported as
+// piku reports it, but without the file name in its stack trace, so that
+// the output does not depend on where the tests are run from.
+func goldenOutput(file string) (out string, err error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), goldenTimeout)
+	defer cancel()
+	var buf bytes.Buffer
+	in := &Interpreter{Ctx: ctx, Stdout: &buf, Stderr: &buf, Stdin: strings.NewReader(""), dir: filepath.Dir(file)}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(&buf, "Error", r)
+		}
+		out = buf.String()
+	}()
+	nodes, diags := parseSource(string(src))
+	if len(diags) > 0 {
+		fmt.Fprintln(&buf, "Error", diags)
+		return
+	}
+	if _, err := execast(nodes, newEnv(in)); err != nil {
+		fmt.Fprintf(&buf, "Error %v%s\n", err, traceback(err))
+	}
+	return
+}
+
+// lineDiff compares want and got line by line and returns the lines that
+// differ, want's marked - and got's +, with diffContext unchanged lines
+// around each run of them. It returns nothing when they are the same.
+func lineDiff(want, got string) []string {
+	if want == got {
+		return nil
+	}
+	a, b := splitLines(want), splitLines(got)
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	if len(lines) == 0 {
+		// The texts differ only in the newline at the end.
+		return []string{"(the final newline differs)"}
+	}
+	return trimContext(lines)
+}
+
+// splitLines splits s into lines, marking one without a final newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += " (no newline at end)"
+	}
+	return lines
+}
+
+// trimContext leaves out the unchanged lines of a diff more than
+// diffContext lines from a change, putting ... where they were.
+func trimContext(lines []string) []string {
+	near := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  ") {
+			continue
+		}
+		for k := max(0, i-diffContext); k <= min(len(lines)-1, i+diffContext); k++ {
+			near[k] = true
+		}
+	}
+	var out []string
+	for i, l := range lines {
+		switch {
+		case near[i]:
+			out = append(out, l)
+		case i == 0 || near[i-1]:
+			out = append(out, "  ...")
+		}
+	}
+	return out
+}
+
+// selftestCmd implements "piku selftest [-update] [dir]".
+func selftestCmd(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	update := fs.Bool("update", false, "write each .expected file from the output of its program")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("usage: piku selftest [-update] [dir]")
+	}
+	dir := "testdata"
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+	results, err := runGolden(dir, *update)
+	if err != nil {
+		return err
+	}
+	passed := 0
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			fmt.Printf("FAIL  %s\n      %v\n", r.name, r.err)
+		case *update:
+			fmt.Printf("wrote %s.expected\n", r.name)
+			passed++
+		case len(r.diff) > 0:
+			fmt.Printf("FAIL  %s  (- expected, + actual)\n", r.name)
+			for _, l := range r.diff {
+				fmt.Printf("      %s\n", l)
+			}
+		default:
+			fmt.Printf("ok    %s\n", r.name)
+			passed++
+		}
+	}
+	if !*update {
+		fmt.Printf("%d of %d passed\n", passed, len(results))
+	}
+	if passed < len(results) {
+		return errTestsFailed
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	checkGolden(t, "testdata")
+}
+
+// TestExamples runs the example gallery, each example against the output
+// in its .expected file.
+func TestExamples(t *testing.T) {
+	checkGolden(t, "examples")
+}
+
+func checkGolden(t *testing.T, dir string) {
+	results, err := runGolden(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			t.Errorf("%s: %v", r.name, r.err)
+		case len(r.diff) > 0:
+			t.Errorf("%s: output differs (- expected, + actual):\n%s", r.name, strings.Join(r.diff, "\n"))
+		}
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	if d := lineDiff("a\nb\n", "a\nb\n"); d != nil {
+		t.Errorf("equal texts gave %q", d)
+	}
+	got := strings.Join(lineDiff("a\nb\nc\n", "a\nx\nc\n"), "\n")
+	if want := "  a\n- b\n+ x\n  c"; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package piku
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	defEager("core", "semver-parse", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		s, err := strval(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("semver-parse: %v, line: %d", err, ln)
+		}
+		v, err := parseSemver(s)
+		if err != nil {
+			return nil, fmt.Errorf("semver-parse: %v, line: %d", err, ln)
+		}
+		lst := []Value{{kind: KindInt, varval: v.major}, {kind: KindInt, varval: v.minor}, {kind: KindInt, varval: v.patch}, *mkstr(v.pre)}
+		return &Value{kind: KindList, listval: &lst}, nil
+	})
+	semverForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			av, bv := args[0], args[1]
+			a, err := strval(av)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			b, err := strval(bv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			va, err := parseSemver(a)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			if op == "semver-satisfies" {
+				ok, err := semverSatisfies(va, b)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+				}
+				if ok {
+					return &Value{kind: KindInt, varval: 1}, nil
+				}
+				return &Value{kind: KindInt, varval: 0}, nil
+			}
+			vb, err := parseSemver(b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v, line: %d", op, err, ln)
+			}
+			return &Value{kind: KindInt, varval: va.compare(vb)}, nil
+		}
+	}
+	defEager("core", "semver-cmp", arity{2, 2}, semverForm("semver-cmp"))
+	defEager("core", "semver-satisfies", arity{2, 2}, semverForm("semver-satisfies"))
+}
+
+// semver is a parsed semantic version. Build metadata is dropped since it
+// does not take part in precedence.
+type semver struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func parseSemver(s string) (semver, error) {
+	v := semver{}
+	core := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(core, '+'); i >= 0 {
+		core = core[:i]
+	}
+	if i := strings.IndexByte(core, '-'); i >= 0 {
+		core, v.pre = core[:i], core[i+1:]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version: %q", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version: %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// compare orders versions by semver precedence, returning -1, 0 or 1.
+func (a semver) compare(b semver) int {
+	for _, d := range []int{a.major - b.major, a.minor - b.minor, a.patch - b.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case a.pre == b.pre:
+		return 0
+	case a.pre == "":
+		return 1
+	case b.pre == "":
+		return -1
+	}
+	pa, pb := strings.Split(a.pre, "."), strings.Split(b.pre, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, erra := strconv.Atoi(pa[i])
+		nb, errb := strconv.Atoi(pb[i])
+		switch {
+		case erra == nil && errb == nil:
+			if na != nb {
+				return sign(na - nb)
+			}
+		case erra == nil:
+			return -1
+		case errb == nil:
+			return 1
+		default:
+			if c := strings.Compare(pa[i], pb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(pa) - len(pb))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// semverSatisfies reports whether v is inside rng. A range is a list of
+// alternatives separated by "||", each a space separated list of
+// comparators that must all hold: =, >, >=, <, <= followed by a version,
+// ^ and ~ ranges, x-ranges such as 1.2.x or *, and bare versions.
+func semverSatisfies(v semver, rng string) (bool, error) {
+	for _, alt := range strings.Split(rng, "||") {
+		ok := true
+		for _, c := range strings.Fields(alt) {
+			match, err := semverComparator(v, c)
+			if err != nil {
+				return false, err
+			}
+			ok = ok && match
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func semverComparator(v semver, c string) (bool, error) {
+	op := ""
+	for _, p := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(c, p) {
+			op, c = p, c[len(p):]
+			break
+		}
+	}
+	lo, hi, err := semverBounds(c, op)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case ">":
+		return v.compare(hi) >= 0, nil
+	case ">=":
+		return v.compare(lo) >= 0, nil
+	case "<":
+		return v.compare(lo) < 0, nil
+	case "<=":
+		return v.compare(hi) < 0, nil
+	}
+	return v.compare(lo) >= 0 && v.compare(hi) < 0, nil
+}
+
+// semverBounds turns a possibly partial version into the half-open interval
+// [lo, hi) it denotes under op.
+func semverBounds(s, op string) (semver, semver, error) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	pre := ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, pre = s[:i], s[i+1:]
+	}
+	var nums []int
+	for _, p := range strings.Split(s, ".") {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, semver{}, fmt.Errorf("invalid version range: %q", s)
+		}
+		nums = append(nums, n)
+	}
+	if len(nums) > 3 {
+		return semver{}, semver{}, fmt.Errorf("invalid version range: %q", s)
+	}
+	lo := semver{}
+	for i, n := range nums {
+		*[]*int{&lo.major, &lo.minor, &lo.patch}[i] = n
+	}
+	lo.pre = pre
+	fixed := len(nums)
+	switch op {
+	case "^":
+		// Allow changes that do not modify the left-most non-zero part.
+		switch {
+		case lo.major > 0 || fixed == 1:
+			fixed = 1
+		case lo.minor > 0 || fixed == 2:
+			fixed = 2
+		default:
+			fixed = 3
+		}
+	case "~":
+		if fixed > 2 {
+			fixed = 2
+		}
+	}
+	// hi is the smallest version outside the range; a "0" prerelease keeps
+	// prereleases of the next version out.
+	var hi semver
+	switch {
+	case fixed == 0:
+		hi = semver{major: int(^uint(0) >> 1)}
+	case fixed == 1:
+		hi = semver{major: lo.major + 1, pre: "0"}
+	case fixed == 2:
+		hi = semver{major: lo.major, minor: lo.minor + 1, pre: "0"}
+	case pre != "" && op != "^":
+		hi = semver{major: lo.major, minor: lo.minor, patch: lo.patch, pre: pre + ".0"}
+	default:
+		hi = semver{major: lo.major, minor: lo.minor, patch: lo.patch + 1, pre: "0"}
+	}
+	return lo, hi, nil
+}
@@ -0,0 +1,173 @@
+package piku
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sets (KindSet) keep their elements in dictval under a key encoding the
+// element, so that membership is a map lookup. Values equal by equal get
+// the same key. Functions, macros and handles have no key and cannot be
+// put in a set.
+
+func init() {
+	defEager("core", "set-new", arity{0, -1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		s := mkset()
+		for _, v := range args {
+			if err := setAdd(s, v, ln); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	})
+	setMemberForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			s, v := args[0], args[1]
+			if s.kind != KindSet {
+				return nil, typeError("set", s, ln)
+			}
+			if op == "set-has" {
+				if setHas(s, v) {
+					return &Value{kind: KindInt, varval: 1}, nil
+				}
+				return &Value{kind: KindInt, varval: 0}, nil
+			}
+			// Sets are updated in place, like the variables edit changes.
+			if err := setAdd(s, v, ln); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+	}
+	defEager("core", "set-add", arity{2, 2}, setMemberForm("set-add"))
+	defEager("core", "set-has", arity{2, 2}, setMemberForm("set-has"))
+	setOpForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			a, b := args[0], args[1]
+			if a.kind != KindSet {
+				return nil, typeError("set", a, ln)
+			}
+			if b.kind != KindSet {
+				return nil, typeError("set", b, ln)
+			}
+			s := mkset()
+			for k, v := range a.dictval {
+				if _, in := b.dictval[k]; in || op == "set-union" {
+					s.dictval[k] = v
+				}
+			}
+			if op == "set-union" {
+				for k, v := range b.dictval {
+					s.dictval[k] = v
+				}
+			}
+			return s, nil
+		}
+	}
+	defEager("core", "set-union", arity{2, 2}, setOpForm("set-union"))
+	defEager("core", "set-intersect", arity{2, 2}, setOpForm("set-intersect"))
+}
+
+// setKey encodes v as the key of a set element.
+func setKey(v *Value) (string, bool) {
+	var sb strings.Builder
+	ok := writeSetKey(&sb, v)
+	return sb.String(), ok
+}
+
+// collectionKeys open the keys of the collections writeSetKey encodes.
+var collectionKeys = map[Kind]string{KindList: "l(", KindTuple: "t(", KindSet: "s("}
+
+func writeSetKey(sb *strings.Builder, v *Value) bool {
+	switch v = asList(v); v.kind {
+	case KindInt:
+		sb.WriteString("n" + strconv.Itoa(v.varval))
+	case KindBigInt:
+		sb.WriteString("n" + v.big().String())
+	case KindFloat:
+		sb.WriteString("r" + strconv.FormatFloat(v.realval, 'g', -1, 64))
+	case KindNil:
+		sb.WriteString("u")
+	case KindSymbol:
+		sb.WriteString("y" + strconv.Quote(v.sym()))
+	case KindList, KindTuple, KindSet:
+		sb.WriteString(collectionKeys[v.kind])
+		if v.kind == KindSet {
+			for _, k := range sortedKeys(v.dictval) {
+				sb.WriteString(k + " ")
+			}
+		} else {
+			for i := range *v.listval {
+				if !writeSetKey(sb, &(*v.listval)[i]) {
+					return false
+				}
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(")")
+	case KindDict:
+		sb.WriteString("d(")
+		for _, k := range sortedKeys(v.dictval) {
+			e := v.dictval[k]
+			sb.WriteString(strconv.Quote(k) + ":")
+			if !writeSetKey(sb, &e) {
+				return false
+			}
+			sb.WriteString(" ")
+		}
+		sb.WriteString(")")
+	default:
+		return false
+	}
+	return true
+}
+
+func sortedKeys(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setElems returns the elements of the set s in order: numbers and
+// strings as sort orders them, everything else by key.
+func setElems(s *Value) []Value {
+	keys := sortedKeys(s.dictval)
+	elems := make([]Value, len(keys))
+	for i, k := range keys {
+		elems[i] = s.dictval[k]
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		c, ok := compare(&elems[i], &elems[j])
+		return ok && c < 0
+	})
+	return elems
+}
+
+func mkset() *Value {
+	return &Value{kind: KindSet, dictval: map[string]Value{}}
+}
+
+// setAdd puts v into the set s.
+func setAdd(s, v *Value, ln int) error {
+	k, ok := setKey(v)
+	if !ok {
+		return fmt.Errorf("a %s cannot be put in a set, line: %d", typename(v), ln)
+	}
+	s.dictval[k] = *v
+	return nil
+}
+
+// setHas reports whether v is in the set s.
+func setHas(s, v *Value) bool {
+	k, ok := setKey(v)
+	if !ok {
+		return false
+	}
+	_, ok = s.dictval[k]
+	return ok
+}
@@ -0,0 +1,162 @@
+package piku
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A program run by piku is not killed by SIGINT or SIGTERM. The signal is
+// noted, and once the form being evaluated finishes the evaluator calls
+// the handler set for it with [trap "SIGINT" f], then carries on where it
+// was. With no handler, evaluation fails with an interrupted error, which
+// try can catch to clean up. Waiting in sleep is cut short by a signal; a
+// second signal arriving before the first is handled, say while the
+// program waits for input, ends the process at once.
+
+func init() {
+	defEager("core", "trap", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		s, f := args[0], args[1]
+		str, err := strval(s)
+		if err != nil {
+			return nil, typeError("string", s, ln)
+		}
+		name, ok := signalName(str)
+		if !ok {
+			return nil, fmt.Errorf("trap: unknown signal %s, expected SIGINT or SIGTERM, line: %d", str, ln)
+		}
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		env.interp.trap(name, f)
+		return mknil(), nil
+	})
+}
+
+// signalNumbers are the signals a program can trap, by name.
+var signalNumbers = map[string]int{"SIGINT": 2, "SIGTERM": 15}
+
+// signalState holds the signals received by the program of an
+// interpreter and the handlers it has set.
+type signalState struct {
+	// arrived is set while a signal waits to be handled, so that the
+	// evaluator need not take the lock to find there is none.
+	arrived atomic.Bool
+	mu      sync.Mutex
+	pending string
+	// handling is set while a handler runs.
+	handling bool
+	traps    map[string]*Value
+	// wake is closed when a signal arrives, to end waits early.
+	wake chan struct{}
+}
+
+func newSignalState() *signalState {
+	return &signalState{traps: map[string]*Value{}, wake: make(chan struct{})}
+}
+
+// interruption is the error evaluation fails with on a signal the program
+// has no handler for.
+type interruption struct {
+	signal string
+	line   int
+}
+
+func (e *interruption) Error() string {
+	return fmt.Sprintf("interrupted by %s, line: %d", e.signal, e.line)
+}
+
+// signalName returns the name of the signal s, written with or without
+// the SIG prefix in any case.
+func signalName(s string) (string, bool) {
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	_, ok := signalNumbers[name]
+	return name, ok
+}
+
+// signals returns the signal state of the program in runs, making it if
+// create is set and there is none.
+func (in *Interpreter) signals(create bool) *signalState {
+	if in == nil {
+		return nil
+	}
+	for in.parent != nil {
+		in = in.parent
+	}
+	if in.sigs == nil && create {
+		in.sigs = newSignalState()
+	}
+	return in.sigs
+}
+
+// deliver records that the signal name arrived. It returns false if the
+// last one has not been handled yet.
+func (s *signalState) deliver(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != "" || s.handling {
+		return false
+	}
+	s.pending = name
+	s.arrived.Store(true)
+	close(s.wake)
+	return true
+}
+
+// woken returns a channel closed when a signal arrives, or nil if the
+// program gets none.
+func (in *Interpreter) woken() <-chan struct{} {
+	s := in.signals(false)
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wake
+}
+
+// trap sets f to handle the signal name.
+func (in *Interpreter) trap(name string, f *Value) {
+	s := in.signals(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traps[name] = f
+}
+
+// signalled handles a signal that has arrived, if any, calling its
+// handler in env or failing with an interruption.
+func (in *Interpreter) signalled(env *Env, ln int) error {
+	s := in.signals(false)
+	if s == nil || !s.arrived.Load() {
+		return nil
+	}
+	s.mu.Lock()
+	name, f := s.pending, s.traps[s.pending]
+	if name == "" {
+		s.mu.Unlock()
+		return nil
+	}
+	s.pending = ""
+	s.arrived.Store(false)
+	s.wake = make(chan struct{})
+	s.handling = f != nil
+	s.mu.Unlock()
+	if f == nil {
+		return &interruption{signal: name, line: ln}
+	}
+	defer func() {
+		s.mu.Lock()
+		s.handling = false
+		s.mu.Unlock()
+	}()
+	var args []*Value
+	if len(f.fn().Args) > 0 {
+		args = []*Value{mkstr(name)}
+	}
+	_, err, _ := applyfunc(f, args, env, ln)
+	return err
+}
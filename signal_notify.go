@@ -0,0 +1,42 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySignals has SIGINT and SIGTERM delivered to the program run by in
+// rather than end the process, until stop is called. A signal arriving
+// while the last is still waiting to be handled ends the process with the
+// status a shell gives a program killed by it.
+func (in *Interpreter) notifySignals() (stop func()) {
+	s := in.signals(true)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				name := "SIGINT"
+				if sig == syscall.SIGTERM {
+					name = "SIGTERM"
+				}
+				if !s.deliver(name) {
+					cleanupProcs()
+					cleanupTemps()
+					os.Exit(128 + signalNumbers[name])
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
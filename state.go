@@ -0,0 +1,273 @@
+package piku
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+)
+
+func init() {
+	defEager("io", "savestate", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		path, err := strval(v)
+		if err != nil {
+			return nil, fmt.Errorf("savestate: %v, line: %d", err, ln)
+		}
+		if err := saveState(path, env); err != nil {
+			return nil, fmt.Errorf("savestate: %v, line: %d", err, ln)
+		}
+		return nil, nil
+	})
+}
+
+// A saved state is the global scope of a program encoded with gob behind
+// a short header, like a compiled program. Functions are saved as their
+// code and come back closed over the scope they are loaded into. What
+// cannot come back as it was is not saved at all: a closure over local
+// variables, a function made by compose or partial, and handles, which are
+// host resources. Saving a scope holding one fails, naming it.
+const stateMagic = "PIKUS1\n"
+
+type savedState struct {
+	Vals   map[string]savedValue
+	Consts []string
+}
+
+// savedValue is a value in a form gob can encode.
+type savedValue struct {
+	Kind    Kind
+	Text    bool
+	Int     int
+	Big     string
+	Real    float64
+	Sym     string
+	List    []savedValue
+	Dict    map[string]savedValue
+	Func    *savedFunc
+	ErrMsg  string
+	ErrCode *savedValue
+	ErrLine int
+}
+
+// savedFunc is the code of a function. gob cannot encode the nil entries
+// Defaults has for arguments without a default, so Defaults holds an
+// empty node for them and HasDefault says which are real. Gen marks a
+// function made with genfunc, and Doc is the function's documentation.
+type savedFunc struct {
+	Args       []string
+	Defaults   []*Node
+	HasDefault []bool
+	Types      []string
+	Expr       *Node
+	Gen        bool
+	Doc        string
+}
+
+// saveValue converts v for gob, failing with what v is when it cannot be
+// saved.
+func saveValue(v *Value) (savedValue, error) {
+	s := savedValue{Kind: v.kind, Text: v.text}
+	switch v.kind {
+	case KindInt:
+		s.Int = v.varval
+	case KindBigInt:
+		s.Big = v.big().String()
+	case KindFloat:
+		s.Real = v.realval
+	case KindSymbol:
+		s.Sym = v.sym()
+	case KindNil:
+	case KindList, KindTuple, KindPList:
+		s.List = []savedValue{}
+		for _, el := range *asList(v).listval {
+			e, err := saveValue(&el)
+			if err != nil {
+				return s, err
+			}
+			s.List = append(s.List, e)
+		}
+	case KindDict, KindSet:
+		s.Dict = map[string]savedValue{}
+		for k, e := range v.dictval {
+			sv, err := saveValue(&e)
+			if err != nil {
+				return s, err
+			}
+			s.Dict[k] = sv
+		}
+	case KindFunc, KindMacro:
+		f := v.fn()
+		if f.parts != nil {
+			return s, errors.New("a function made by compose or partial cannot be saved")
+		}
+		if f.env != nil && f.env.parent != nil {
+			return s, errors.New("a closure over local variables cannot be saved")
+		}
+		s.Func = &savedFunc{Args: f.Args, Types: f.Types, Expr: f.expr, Gen: f.gen, Doc: f.Doc}
+		for _, d := range f.Defaults {
+			s.Func.HasDefault = append(s.Func.HasDefault, d != nil)
+			if d == nil {
+				d = &Node{}
+			}
+			s.Func.Defaults = append(s.Func.Defaults, d)
+		}
+	case KindError:
+		s.ErrMsg, s.ErrLine = v.scriptErr().msg, v.scriptErr().line
+		if v.scriptErr().code != nil {
+			code, err := saveValue(v.scriptErr().code)
+			if err != nil {
+				return s, err
+			}
+			s.ErrCode = &code
+		}
+	default:
+		return s, fmt.Errorf("a %s cannot be saved", typeof(v))
+	}
+	return s, nil
+}
+
+// loadValue rebuilds a saved value, closing functions over env.
+func loadValue(s savedValue, env *Env) (*Value, error) {
+	v := &Value{kind: s.Kind, text: s.Text}
+	switch s.Kind {
+	case KindInt:
+		v.varval = s.Int
+	case KindBigInt:
+		x, ok := new(big.Int).SetString(s.Big, 10)
+		if !ok {
+			return nil, fmt.Errorf("bad integer %q", s.Big)
+		}
+		v.ref = x
+	case KindFloat:
+		v.realval = s.Real
+	case KindSymbol:
+		v.ref = s.Sym
+	case KindNil:
+	case KindList, KindTuple, KindPList:
+		lst := []Value{}
+		for _, e := range s.List {
+			ev, err := loadValue(e, env)
+			if err != nil {
+				return nil, err
+			}
+			lst = append(lst, *ev)
+		}
+		if v.kind == KindPList {
+			v.ref = plistOf(lst)
+			break
+		}
+		v.listval = &lst
+	case KindDict, KindSet:
+		v.dictval = map[string]Value{}
+		for k, e := range s.Dict {
+			ev, err := loadValue(e, env)
+			if err != nil {
+				return nil, err
+			}
+			v.dictval[k] = *ev
+		}
+	case KindFunc, KindMacro:
+		if s.Func == nil || s.Func.Expr == nil {
+			return nil, errors.New("function without code")
+		}
+		f := &Function{Args: s.Func.Args, Types: s.Func.Types, expr: s.Func.Expr, gen: s.Func.Gen, Doc: s.Func.Doc}
+		for i, d := range s.Func.Defaults {
+			if i >= len(s.Func.HasDefault) || !s.Func.HasDefault[i] {
+				d = nil
+			}
+			f.Defaults = append(f.Defaults, d)
+		}
+		if s.Kind == KindFunc {
+			f.env = env
+		}
+		v.ref = f
+	case KindError:
+		e := &scriptError{msg: s.ErrMsg, line: s.ErrLine}
+		if s.ErrCode != nil {
+			code, err := loadValue(*s.ErrCode, env)
+			if err != nil {
+				return nil, err
+			}
+			e.code = code
+		}
+		v.ref = e
+	default:
+		return nil, fmt.Errorf("unknown value kind %q", s.Kind)
+	}
+	return v, nil
+}
+
+// saveState writes the global scope of env to path. It fails, writing
+// nothing, when a value in the scope cannot be saved, naming the first
+// such variable.
+func saveState(path string, env *Env) error {
+	for env.parent != nil {
+		env = env.parent
+	}
+	names := make([]string, 0, len(env.vals))
+	for name := range env.vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	st := savedState{Vals: map[string]savedValue{}}
+	for _, name := range names {
+		s, err := saveValue(env.vals[name])
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		st.Vals[name] = s
+		if env.consts[name] {
+			st.Consts = append(st.Consts, name)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, stateMagic); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(&st); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadState binds the names saved in path in env.
+func loadState(path string, env *Env) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic := make([]byte, len(stateMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != stateMagic {
+		return fmt.Errorf("%s: not a saved piku state", path)
+	}
+	var st savedState
+	if err := gob.NewDecoder(br).Decode(&st); err != nil {
+		return fmt.Errorf("%s: corrupt saved state: %v", path, err)
+	}
+	for name, s := range st.Vals {
+		v, err := loadValue(s, env)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+		env.vals[name] = v
+	}
+	for _, name := range st.Consts {
+		if env.consts == nil {
+			env.consts = map[string]bool{}
+		}
+		env.consts[name] = true
+	}
+	return nil
+}
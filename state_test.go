@@ -0,0 +1,78 @@
+package piku
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restored runs saved, saves the state it leaves, loads the state on a
+// fresh interpreter and returns what src prints there.
+func restored(t *testing.T, saved, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "s.state")
+	if out := RunSource(saved + ` [savestate "` + path + `"]`); out != "" {
+		t.Fatal(out)
+	}
+	var buf strings.Builder
+	env := newEnv(&Interpreter{Stdout: &buf})
+	if err := loadState(path, env); err != nil {
+		t.Fatal(err)
+	}
+	nodes, diags := parseSource(src)
+	if len(diags) > 0 {
+		t.Fatal(diags)
+	}
+	if _, err := execast(nodes, env); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	got := restored(t, `
+[set x [list 1 2]]
+[set f [func [a] [add a 1]]]
+`, `[echo x] [echo [call f 41]]`)
+	if got != "[list 1 2]\n42\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStateKeepsGenerators(t *testing.T) {
+	got := restored(t, `[set count [genfunc [n] [while 1 [yield n]]]]`, `
+[set g [call count 3]]
+[echo [next g]]
+[echo [next g]]
+`)
+	if got != "3\n3\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStateKeepsDocs(t *testing.T) {
+	got := restored(t, `[set inc [func [a] "Adds one to a." [add a 1]]]`, `[help inc]`)
+	if !strings.Contains(got, "Adds one to a.") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStateRefusesWhatItCannotSave(t *testing.T) {
+	tests := []struct{ name, src, want string }{
+		{"closure", `[set mk [func [n] [func [x] [add x n]]]] [set add5 [call mk 5]]`,
+			"add5: a closure over local variables cannot be saved"},
+		{"partial", `[set inc [partial [func [a b] [add a b]] 1]]`,
+			"inc: a function made by compose or partial cannot be saved"},
+		{"handle", `[set limit [ratelimit 10]]`,
+			"limit: a handle cannot be saved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "s.state")
+			out := RunSource(tt.src + ` [savestate "` + path + `"]`)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("got %q, want it to contain %q", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// decisionForms are the forms that add a path through the code, for the
+// complexity count of piku stats.
+var decisionForms = map[string]bool{
+	"if": true, "while": true, "foreach": true, "default": true,
+	"try": true,
+}
+
+// programStats is what piku stats reports about a program.
+type programStats struct {
+	bytes, lines, forms int
+	funcs, macros       int
+	depth               int
+	complexity          int
+	builtins            map[string]int
+	// funcComplexity maps each function bound by set or const to its
+	// complexity.
+	funcComplexity map[string]int
+}
+
+func collectStats(source string, nodes []*Node) *programStats {
+	s := &programStats{
+		bytes:          len(source),
+		lines:          strings.Count(source, "\n"),
+		forms:          len(nodes),
+		complexity:     1,
+		builtins:       map[string]int{},
+		funcComplexity: map[string]int{},
+	}
+	if source != "" && !strings.HasSuffix(source, "\n") {
+		s.lines++
+	}
+	for _, n := range nodes {
+		s.visit(n, 1)
+		if (isForm(n, "set") || isForm(n, "const")) && len(n.Children) == 3 && isForm(n.Children[2], "func") {
+			s.funcComplexity[n.Children[1].Value] = 1 + decisions(n.Children[2])
+		}
+	}
+	return s
+}
+
+func (s *programStats) visit(n *Node, depth int) {
+	if n.Type != "LIST" {
+		return
+	}
+	if depth > s.depth {
+		s.depth = depth
+	}
+	if len(n.Children) > 0 && n.Children[0].Type == "IDENTIFIER" {
+		head := n.Children[0].Value
+		if isBuiltin(head) {
+			s.builtins[head]++
+		}
+		switch {
+		case head == "func" || head == "genfunc":
+			s.funcs++
+		case head == "macro":
+			s.macros++
+		case head == "quote":
+			return
+		case decisionForms[head]:
+			s.complexity++
+		}
+	}
+	for _, c := range n.Children {
+		s.visit(c, depth+1)
+	}
+}
+
+// decisions counts the decision forms under n.
+func decisions(n *Node) int {
+	count := 0
+	if isForm(n, "quote") {
+		return 0
+	}
+	if n.Type == "LIST" && len(n.Children) > 0 && decisionForms[n.Children[0].Value] {
+		count++
+	}
+	for _, c := range n.Children {
+		count += decisions(c)
+	}
+	return count
+}
+
+func (s *programStats) write(name string) {
+	fmt.Printf("%s\n", name)
+	fmt.Printf("  size:       %d bytes, %d lines, %d top level forms\n", s.bytes, s.lines, s.forms)
+	fmt.Printf("  functions:  %d, macros: %d\n", s.funcs, s.macros)
+	fmt.Printf("  max depth:  %d\n", s.depth)
+	fmt.Printf("  complexity: %d\n", s.complexity)
+	if len(s.funcComplexity) > 0 {
+		fmt.Println("\nmost complex functions:")
+		names := make([]string, 0, len(s.funcComplexity))
+		for f := range s.funcComplexity {
+			names = append(names, f)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := s.funcComplexity[names[i]], s.funcComplexity[names[j]]
+			return a > b || (a == b && names[i] < names[j])
+		})
+		if len(names) > 10 {
+			names = names[:10]
+		}
+		for _, f := range names {
+			fmt.Printf("  %-20s %d\n", f, s.funcComplexity[f])
+		}
+	}
+	if len(s.builtins) > 0 {
+		fmt.Println("\nbuiltin usage:")
+		names := make([]string, 0, len(s.builtins))
+		for b := range s.builtins {
+			names = append(names, b)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			a, b := s.builtins[names[i]], s.builtins[names[j]]
+			return a > b || (a == b && names[i] < names[j])
+		})
+		for _, b := range names {
+			fmt.Printf("  %-20s %d\n", b, s.builtins[b])
+		}
+	}
+}
+
+// statsCmd implements "piku stats file.pi".
+func statsCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: piku stats file.pi")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	nodes, diags := parseSource(string(data))
+	if len(diags) > 0 {
+		return diags
+	}
+	collectStats(string(data), nodes).write(args[0])
+	return nil
+}
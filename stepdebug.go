@@ -0,0 +1,229 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// piku debug file.pi runs a program a form at a time. It stops before
+// the first form and then wherever it is told to: at the next form, at
+// the next one not nested in the current one, or at a line with a
+// breakpoint. While stopped, expressions are evaluated in the scope of
+// the form about to run. The stepper watches the run through the Enter
+// hook of the interpreter, which eval calls before each form.
+
+const stepHelp = `Type an expression to evaluate it in the current scope.
+:step, :s       run to the next form, going into calls
+:next, :n       run to the next form not nested in this one
+:out, :o        run to the next form outside the one this is part of
+:continue, :c   run to the next breakpoint
+:break, :b N    stop when the run gets to line N; with no N, list breakpoints
+:clear N        remove the breakpoint at line N
+:where          show the form about to run and the calls in progress
+:vars           list the variables of each scope, innermost first
+:quit           stop the program`
+
+type stepper struct {
+	ed *lineEditor
+	// forms are the forms of the file being debugged, so that a
+	// breakpoint does not stop in an imported file, and lines the lines
+	// any of them starts on.
+	forms  map[*Node]bool
+	lines  map[int]bool
+	breaks map[int]bool
+	// mode is how the run goes on: "step", "next", "out" or "continue".
+	// next and out stop at a form nested no deeper than depth.
+	mode  string
+	depth int
+	// line is that of the last form entered, so that a breakpoint stops
+	// once on getting to its line rather than at every form on it.
+	line int
+	// busy is set while an expression typed at the prompt is evaluated.
+	busy bool
+}
+
+func (d *stepper) enter(s *EvalStep) {
+	if d.busy {
+		return
+	}
+	line := s.Node.Line
+	arrived := d.forms[s.Node] && line != d.line
+	if d.forms[s.Node] {
+		d.line = line
+	}
+	switch {
+	case d.mode == "step":
+	case d.mode == "next" && s.Depth <= d.depth:
+	case d.mode == "out" && s.Depth < d.depth:
+	case arrived && d.breaks[line]:
+	default:
+		return
+	}
+	d.prompt(s)
+}
+
+// prompt reads commands while the run is stopped before the form of s.
+func (d *stepper) prompt(s *EvalStep) {
+	d.where(s, false)
+	for ln := 1; ; ln++ {
+		line, err := d.ed.readLine("debug> ")
+		if err != nil {
+			d.quit()
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		arg = strings.TrimSpace(arg)
+		switch cmd {
+		case "":
+			continue
+		case ":step", ":s":
+			d.mode = "step"
+			return
+		case ":next", ":n":
+			d.mode, d.depth = "next", s.Depth
+			return
+		case ":out", ":o":
+			d.mode, d.depth = "out", s.Depth
+			return
+		case ":continue", ":c":
+			d.mode = "continue"
+			return
+		case ":quit":
+			d.quit()
+		case ":help":
+			fmt.Println(stepHelp)
+			continue
+		case ":where":
+			d.where(s, true)
+			continue
+		case ":vars":
+			listVars(s.Env, "current")
+			continue
+		case ":break", ":b":
+			d.setBreak(arg)
+			continue
+		case ":clear":
+			n, err := strconv.Atoi(arg)
+			if err != nil || !d.breaks[n] {
+				fmt.Printf("no breakpoint at line %s\n", arg)
+				continue
+			}
+			delete(d.breaks, n)
+			continue
+		}
+		nodes, err := parseLine(line)
+		if err != nil {
+			fmt.Println("Error", err)
+			continue
+		}
+		d.busy = true
+		for _, node := range nodes {
+			v, err, _ := eval(node, s.Env, ln)
+			if err != nil {
+				fmt.Println("Error", err)
+				break
+			}
+			fmt.Println(describe(v))
+		}
+		d.busy = false
+	}
+}
+
+func (d *stepper) setBreak(arg string) {
+	if arg == "" {
+		if len(d.breaks) == 0 {
+			fmt.Println("no breakpoints")
+		}
+		lines := make([]int, 0, len(d.breaks))
+		for n := range d.breaks {
+			lines = append(lines, n)
+		}
+		sort.Ints(lines)
+		for _, n := range lines {
+			fmt.Printf("breakpoint at line %d\n", n)
+		}
+		return
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Printf("%s is not a line number\n", arg)
+		return
+	}
+	if !d.lines[n] {
+		fmt.Printf("no form starts on line %d\n", n)
+		return
+	}
+	d.breaks[n] = true
+}
+
+// where shows the form of s and, with calls set, the function calls in
+// progress, innermost first.
+func (d *stepper) where(s *EvalStep, calls bool) {
+	fmt.Printf("line %d: %s\n", s.Node.Line, clip(nodeSource(s.Node)))
+	if !calls {
+		return
+	}
+	frames := s.Env.interp.calls
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Printf("  in %s\n", frames[i])
+	}
+}
+
+// quit ends the program there and then, as a second signal does, since
+// it may be stopped in a task of its own.
+func (d *stepper) quit() {
+	cleanupProcs()
+	cleanupTemps()
+	os.Exit(0)
+}
+
+// collectForms records the forms in nodes and the lines they start on.
+func (d *stepper) collectForms(nodes []*Node) {
+	for _, n := range nodes {
+		if n.Type != "LIST" {
+			continue
+		}
+		d.forms[n] = true
+		d.lines[n.Line] = true
+		d.collectForms(n.Children)
+	}
+}
+
+// debugCmd implements "piku debug file.pi".
+func debugCmd(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: piku debug file.pi")
+	}
+	file := fs.Arg(0)
+	nodes, err := LoadFile(file)
+	if err != nil {
+		return err
+	}
+	in := &Interpreter{}
+	env := newEnv(in)
+	d := &stepper{
+		ed:     newLineEditor(historyPath(), completer(env)),
+		forms:  map[*Node]bool{},
+		lines:  map[int]bool{},
+		breaks: map[int]bool{},
+		mode:   "step",
+	}
+	d.collectForms(nodes)
+	in.Enter = d.enter
+	fmt.Println(stepHelp)
+	_, err = runcode(file, nodes, env)
+	if err == nil {
+		fmt.Println("the program finished")
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package piku
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin reads standard input for every interpreter that has no Stdin of
+// its own, and for a program read from standard input, so that none of
+// them loses what another has buffered.
+var stdin = bufio.NewReader(os.Stdin)
+
+// stdout returns the writer the program prints to.
+func (in *Interpreter) stdout() io.Writer {
+	if in == nil || in.Stdout == nil {
+		return os.Stdout
+	}
+	return in.Stdout
+}
+
+// stderr returns the writer the program logs and draws progress to, and
+// the errors of its tasks are reported to.
+func (in *Interpreter) stderr() io.Writer {
+	if in == nil || in.Stderr == nil {
+		return os.Stderr
+	}
+	return in.Stderr
+}
+
+// stdin returns the reader interactive builtins such as choose read
+// lines from. Workers started by pmap share the one of the program.
+func (in *Interpreter) stdin() *bufio.Reader {
+	if in == nil || in.Stdin == nil {
+		return stdin
+	}
+	for in.parent != nil && in.parent.Stdin == in.Stdin {
+		in = in.parent
+	}
+	in.stdinOnce.Do(func() { in.stdinBuf = bufio.NewReader(in.Stdin) })
+	return in.stdinBuf
+}
+
+// childStdin returns what a process the program starts reads as its
+// standard input: the program's own, unbuffered.
+func (in *Interpreter) childStdin() io.Reader {
+	if in == nil || in.Stdin == nil {
+		return os.Stdin
+	}
+	return in.Stdin
+}
+
+// RunOutput runs a complete program in a fresh environment with input as
+// its standard input and returns everything it printed, followed by the
+// error if it failed.
+func RunOutput(source, input string) string {
+	return runCaptured(&Interpreter{Stdin: strings.NewReader(input)}, source)
+}
+
+// runCaptured runs source in a fresh environment of in and returns what
+// it printed.
+func runCaptured(in *Interpreter, source string) (out string) {
+	var buf bytes.Buffer
+	in.Stdout = &buf
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(&buf, "Error", r)
+		}
+		out = buf.String()
+	}()
+	nodes, diags := parseSource(source)
+	if len(diags) > 0 {
+		fmt.Fprintln(&buf, "Error", diags)
+		return
+	}
+	if _, err := execast(nodes, newEnv(in)); err != nil {
+		fmt.Fprintf(&buf, "Error %v%s\n", err, traceback(err))
+	}
+	return
+}
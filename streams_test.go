@@ -0,0 +1,60 @@
+package piku
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunSourceCapturesOutput(t *testing.T) {
+	got := RunSource(`
+[echo [add 1 2]]
+[print "a"]
+[printchar 98]
+[newline]
+[echo "text"]
+`)
+	if want := "3\nab\ntext\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRunSourceReportsErrors(t *testing.T) {
+	got := RunSource(`[echo 1] [echo [div 1 0]] [echo 2]`)
+	if !strings.HasPrefix(got, "1\nError ") || strings.Contains(got, "2\n") {
+		t.Errorf("got %q, want the output up to the error, then the error", got)
+	}
+}
+
+func TestRunOutputReadsInput(t *testing.T) {
+	got := RunOutput(`[echo [choose "Pick:" [list "x" "y"]]]`, "7\n2\n")
+	want := "Pick:\n  1) x\n  2) y\nEnter a number from 1 to 2: Invalid choice.\nEnter a number from 1 to 2: y\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStderrIsSeparate(t *testing.T) {
+	var stderr strings.Builder
+	out := runCaptured(&Interpreter{Stderr: &stderr}, `[log-warn "careful"] [echo "done"]`)
+	if out != "done\n" {
+		t.Errorf("stdout got %q", out)
+	}
+	if !strings.Contains(stderr.String(), "careful") {
+		t.Errorf("stderr got %q", stderr.String())
+	}
+}
+
+func TestTaskErrorsGoToStderr(t *testing.T) {
+	var stderr strings.Builder
+	out := runCaptured(&Interpreter{Stderr: &stderr}, `
+[spawn [func [] [div 1 0]]]
+[sleep 20]
+[echo "done"]
+`)
+	if out != "done\n" {
+		t.Errorf("stdout got %q", out)
+	}
+	if !strings.Contains(stderr.String(), "Error in task: ") {
+		t.Errorf("stderr got %q, want the error of the task", stderr.String())
+	}
+}
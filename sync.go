@@ -0,0 +1,204 @@
+package piku
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
+
+// The handle values behind mutex, atomic and waitgroup. A task blocked on
+// a mutex or a waitgroup lets the others run, like one waiting on a
+// channel, but is not counted as waiting by the deadlock check.
+
+func init() {
+	defEager("core", "mutex", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return &Value{kind: KindHandle, ref: &pikuMutex{}}, nil
+	})
+	lockForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v := args[0]
+			m, err := mutexhandle(v, op, ln)
+			if err != nil {
+				return nil, err
+			}
+			if op == "lock" {
+				err = env.interp.lock(m, ln)
+			} else {
+				err = m.unlock(ln)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return mknil(), nil
+		}
+	}
+	defEager("core", "lock", arity{1, 1}, lockForm("lock"))
+	defEager("core", "unlock", arity{1, 1}, lockForm("unlock"))
+	defEager("core", "atomic", arity{0, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a := &atomicCounter{}
+		if len(args) == 1 {
+			if n := args[0]; n.kind != KindInt {
+				return nil, typeError("number", n, ln)
+			}
+			a.n.Store(int64(args[0].varval))
+		}
+		return &Value{kind: KindHandle, ref: a}, nil
+	})
+	defEager("core", "atomicadd", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v, n := args[0], args[1]
+		a, err := atomichandle(v, "atomicadd", ln)
+		if err != nil {
+			return nil, err
+		}
+		if n.kind != KindInt {
+			return nil, typeError("number", n, ln)
+		}
+		return mkint(big.NewInt(a.n.Add(int64(n.varval)))), nil
+	})
+	defEager("core", "waitgroup", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return &Value{kind: KindHandle, ref: &waitGroup{}}, nil
+	})
+	waitGroupForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			n := mkint(big.NewInt(-1))
+			if op == "wgadd" {
+				if n = args[1]; n.kind != KindInt {
+					return nil, typeError("number", n, ln)
+				}
+			}
+			w, err := wghandle(args[0], op, ln)
+			if err != nil {
+				return nil, err
+			}
+			if op == "wait" {
+				err = env.interp.await(background(w.wg.Wait), ln)
+			} else {
+				err = w.add(n.varval, ln)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return mknil(), nil
+		}
+	}
+	defEager("core", "wgadd", arity{2, 2}, waitGroupForm("wgadd"))
+	defEager("core", "wgdone", arity{1, 1}, waitGroupForm("wgdone"))
+	defEager("core", "wait", arity{1, 1}, waitGroupForm("wait"))
+}
+
+type pikuMutex struct {
+	mu sync.Mutex
+	// locked mirrors mu, so that unlocking a mutex that is not locked is
+	// an error rather than a crash.
+	locked bool
+}
+
+func (m *pikuMutex) String() string {
+	if m.locked {
+		return "mutex locked"
+	}
+	return "mutex"
+}
+
+type atomicCounter struct {
+	n atomic.Int64
+}
+
+func (a *atomicCounter) String() string {
+	return fmt.Sprintf("atomic %d", a.n.Load())
+}
+
+type waitGroup struct {
+	wg sync.WaitGroup
+	// n mirrors the counter of wg, which may not go below zero.
+	n int
+}
+
+func (w *waitGroup) String() string {
+	return fmt.Sprintf("waitgroup %d", w.n)
+}
+
+func mutexhandle(v *Value, op string, ln int) (*pikuMutex, error) {
+	if m, ok := v.handle().(*pikuMutex); ok && v.kind == KindHandle {
+		return m, nil
+	}
+	return nil, fmt.Errorf("%s expects a mutex, got %s, line: %d", op, typename(v), ln)
+}
+
+func atomichandle(v *Value, op string, ln int) (*atomicCounter, error) {
+	if a, ok := v.handle().(*atomicCounter); ok && v.kind == KindHandle {
+		return a, nil
+	}
+	return nil, fmt.Errorf("%s expects an atomic counter, got %s, line: %d", op, typename(v), ln)
+}
+
+func wghandle(v *Value, op string, ln int) (*waitGroup, error) {
+	if w, ok := v.handle().(*waitGroup); ok && v.kind == KindHandle {
+		return w, nil
+	}
+	return nil, fmt.Errorf("%s expects a waitgroup, got %s, line: %d", op, typename(v), ln)
+}
+
+// background runs f on a goroutine of its own and returns a channel that
+// is closed once f returns.
+func background(f func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	return done
+}
+
+// await waits for done to be closed, letting other tasks run meanwhile,
+// and returns early with an error when the program is stopped.
+func (in *Interpreter) await(done <-chan struct{}, ln int) error {
+	var stop <-chan struct{}
+	if ctx := in.context(); ctx != nil {
+		stop = ctx.Done()
+	}
+	var err error
+	in.unlocked(func() {
+		select {
+		case <-done:
+		case <-stop:
+			err = stopped(in.context().Err(), ln)
+		}
+	})
+	return err
+}
+
+func (in *Interpreter) lock(m *pikuMutex, ln int) error {
+	if !m.mu.TryLock() {
+		got := background(m.mu.Lock)
+		if err := in.await(got, ln); err != nil {
+			// Give the lock back once the abandoned Lock gets it.
+			go func() {
+				<-got
+				m.mu.Unlock()
+			}()
+			return err
+		}
+	}
+	m.locked = true
+	return nil
+}
+
+func (m *pikuMutex) unlock(ln int) error {
+	if !m.locked {
+		return fmt.Errorf("unlock of a mutex that is not locked, line: %d", ln)
+	}
+	m.locked = false
+	m.mu.Unlock()
+	return nil
+}
+
+func (w *waitGroup) add(n, ln int) error {
+	if w.n+n < 0 {
+		return fmt.Errorf("waitgroup counter would go below zero, line: %d", ln)
+	}
+	w.n += n
+	w.wg.Add(n)
+	return nil
+}
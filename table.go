@@ -0,0 +1,110 @@
+package piku
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	defEager("core", "printtable", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		rowsv, headv := asList(args[0]), asList(args[1])
+		if rowsv.kind != KindList || headv.kind != KindList {
+			return nil, fmt.Errorf("printtable expects a list of rows and a list of headers, line: %d", ln)
+		}
+		headers := []tableCell{}
+		for i := range *headv.listval {
+			headers = append(headers, mkcell(&(*headv.listval)[i]))
+		}
+		rows := [][]tableCell{}
+		for _, r := range *rowsv.listval {
+			if r.kind != KindList && r.kind != KindTuple {
+				return nil, fmt.Errorf("printtable expects each row to be a list, got %s, line: %d", typename(&r), ln)
+			}
+			row := []tableCell{}
+			for i := range *r.listval {
+				row = append(row, mkcell(&(*r.listval)[i]))
+			}
+			rows = append(rows, row)
+		}
+		_, err := fmt.Fprint(env.interp.stdout(), renderTable(headers, rows))
+		return nil, err
+	})
+}
+
+// tableCell is the text of one table cell; numbers are right aligned.
+type tableCell struct {
+	text  string
+	right bool
+}
+
+func mkcell(v *Value) tableCell {
+	switch {
+	case v == nil:
+		return tableCell{}
+	case v.kind == KindInt:
+		return tableCell{text: strconv.Itoa(v.varval), right: true}
+	case v.kind == KindBigInt:
+		return tableCell{text: v.big().String(), right: true}
+	case v.kind == KindSymbol:
+		return tableCell{text: v.sym()}
+	}
+	if s, err := strval(v); err == nil {
+		return tableCell{text: s}
+	}
+	return tableCell{text: "<" + typename(v) + ">"}
+}
+
+// renderTable draws rows as an ASCII table with a header line when
+// headers is not empty. Short rows are padded with empty cells.
+func renderTable(headers []tableCell, rows [][]tableCell) string {
+	cols := len(headers)
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	widths := make([]int, cols)
+	for _, r := range append([][]tableCell{headers}, rows...) {
+		for i, c := range r {
+			if n := utf8.RuneCountInString(c.text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	var sb strings.Builder
+	rule := func() {
+		for _, w := range widths {
+			sb.WriteString("+" + strings.Repeat("-", w+2))
+		}
+		sb.WriteString("+\n")
+	}
+	line := func(r []tableCell) {
+		for i, w := range widths {
+			c := tableCell{}
+			if i < len(r) {
+				c = r[i]
+			}
+			pad := strings.Repeat(" ", w-utf8.RuneCountInString(c.text))
+			if c.right {
+				fmt.Fprintf(&sb, "| %s%s ", pad, c.text)
+			} else {
+				fmt.Fprintf(&sb, "| %s%s ", c.text, pad)
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	rule()
+	if len(headers) > 0 {
+		line(headers)
+		rule()
+	}
+	for _, r := range rows {
+		line(r)
+	}
+	if len(rows) > 0 {
+		rule()
+	}
+	return sb.String()
+}
@@ -0,0 +1,286 @@
+package piku
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Tasks started by spawn run on goroutines of their own, but take turns:
+// once there is more than one task, a task must hold the interpreter lock
+// to evaluate anything. It lets go of the lock while it waits on a channel
+// or sleeps, and every so many steps so that a busy task does not keep the
+// others from running. Environments and the interpreter's own state are
+// therefore never touched by two tasks at once. The program ends when the
+// main program does, whatever tasks are still running.
+
+func init() {
+	defEager("core", "spawn", arity{1, -1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		f := args[0]
+		if f.kind != KindFunc {
+			return nil, typeError("function", f, ln)
+		}
+		env.interp.spawn(f, args[1:], env, ln)
+		return mknil(), nil
+	})
+	defEager("core", "chan", arity{0, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		size := 0
+		if len(args) == 1 {
+			n := args[0]
+			if n.kind != KindInt || n.varval < 0 {
+				return nil, fmt.Errorf("chan expects a buffer size of at least 0, got %s, line: %d", describe(n), ln)
+			}
+			size = n.varval
+		}
+		return &Value{kind: KindHandle, ref: &chanHandle{size: size}}, nil
+	})
+	defEager("core", "send", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		cv, v := args[0], args[1]
+		c, err := chanhandle(cv, "send", ln)
+		if err != nil {
+			return nil, err
+		}
+		if err := env.interp.send(c, v, ln); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+	defEager("core", "recv", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		cv := args[0]
+		c, err := chanhandle(cv, "recv", ln)
+		if err != nil {
+			return nil, err
+		}
+		v, err := env.interp.recv(c, ln)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
+
+type taskState struct {
+	lock sync.Mutex
+	// alive counts the tasks, the main program included, and blocked
+	// those waiting on a channel.
+	alive, blocked int
+	// exclusive is set while a generator or coroutine is being run, which
+	// must not be interrupted by another task.
+	exclusive int
+	// waiters are the tasks waiting on a channel, and the channel.
+	waiters map[*chanWaiter]*chanHandle
+}
+
+// chanHandle is the handle value behind chan. Channels are kept under the
+// interpreter lock rather than built on Go channels, so that it is known
+// exactly which tasks cannot go on until another runs.
+type chanHandle struct {
+	size      int
+	buf       []Value
+	senders   []*chanWaiter
+	receivers []*chanWaiter
+}
+
+// chanWaiter is a task waiting to send val, or to receive into it. Whoever
+// lets it go on sends to wake.
+type chanWaiter struct {
+	val  Value
+	ln   int
+	wake chan error
+}
+
+func (c *chanHandle) String() string {
+	return fmt.Sprintf("chan %d/%d", len(c.buf), c.size)
+}
+
+func chanhandle(v *Value, op string, ln int) (*chanHandle, error) {
+	if c, ok := v.handle().(*chanHandle); ok && v.kind == KindHandle {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%s expects a channel, got %s, line: %d", op, typename(v), ln)
+}
+
+// spawn calls f with args on a new task.
+func (in *Interpreter) spawn(f *Value, args []*Value, env *Env, ln int) {
+	if in.tasks == nil {
+		// The caller is the main program, which holds the lock from now on.
+		in.tasks = &taskState{alive: 1, waiters: map[*chanWaiter]*chanHandle{}}
+		in.tasks.lock.Lock()
+	}
+	t := in.tasks
+	t.alive++
+	go func() {
+		t.lock.Lock()
+		in.calls = nil
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintln(in.stderr(), "Error internal error in task:", r)
+			}
+			t.alive--
+			t.checkStuck()
+			t.lock.Unlock()
+		}()
+		if _, err, _ := applyfunc(f, args, env.child(), ln); err != nil {
+			fmt.Fprintf(in.stderr(), "Error in task: %v%s\n", err, traceback(err))
+		}
+	}()
+}
+
+// unlocked runs f, which may block, without holding the interpreter lock.
+func (in *Interpreter) unlocked(f func()) {
+	if in == nil || in.tasks == nil {
+		f()
+		return
+	}
+	calls := in.calls
+	in.tasks.lock.Unlock()
+	defer func() {
+		in.tasks.lock.Lock()
+		in.calls = calls
+	}()
+	f()
+}
+
+// switchTasks gives the other tasks a turn.
+func (in *Interpreter) switchTasks() {
+	if t := in.tasks; t != nil && t.exclusive == 0 && t.alive > 1 {
+		calls := in.calls
+		t.lock.Unlock()
+		runtime.Gosched()
+		t.lock.Lock()
+		in.calls = calls
+	}
+}
+
+// exclude keeps other tasks from running until the function it returns is
+// called, except while this one waits.
+func (in *Interpreter) exclude() func() {
+	t := in.tasks
+	if t == nil {
+		return func() {}
+	}
+	t.exclusive++
+	return func() { t.exclusive-- }
+}
+
+// errDeadlock reports that every task is waiting on a channel.
+func errDeadlock(ln int) error {
+	return fmt.Errorf("deadlock: every task is waiting on a channel, line: %d", ln)
+}
+
+// wake lets w go on, with err if it is not to have its send or receive.
+func (t *taskState) wake(w *chanWaiter, err error) {
+	delete(t.waiters, w)
+	t.blocked--
+	w.wake <- err
+}
+
+// checkStuck fails the tasks waiting on channels once none is left that
+// could let them go on.
+func (t *taskState) checkStuck() {
+	if t.alive == 0 || t.alive != t.blocked {
+		return
+	}
+	for w, c := range t.waiters {
+		c.remove(w)
+		t.wake(w, errDeadlock(w.ln))
+	}
+}
+
+func (c *chanHandle) remove(w *chanWaiter) {
+	drop := func(ws []*chanWaiter) []*chanWaiter {
+		for i, x := range ws {
+			if x == w {
+				return append(ws[:i:i], ws[i+1:]...)
+			}
+		}
+		return ws
+	}
+	c.senders, c.receivers = drop(c.senders), drop(c.receivers)
+}
+
+// wait blocks until w, queued on c, is let go on by another task.
+func (in *Interpreter) wait(c *chanHandle, w *chanWaiter) error {
+	t := in.tasks
+	if t == nil {
+		c.remove(w)
+		return errDeadlock(w.ln)
+	}
+	t.waiters[w] = c
+	t.blocked++
+	if t.alive == t.blocked {
+		c.remove(w)
+		delete(t.waiters, w)
+		t.blocked--
+		return errDeadlock(w.ln)
+	}
+	var done <-chan struct{}
+	if ctx := in.context(); ctx != nil {
+		done = ctx.Done()
+	}
+	var err error
+	woken := false
+	in.unlocked(func() {
+		select {
+		case err = <-w.wake:
+			woken = true
+		case <-done:
+		}
+	})
+	if woken {
+		return err
+	}
+	// Stopped, unless another task let w go on in the meantime.
+	select {
+	case err = <-w.wake:
+		return err
+	default:
+	}
+	c.remove(w)
+	delete(t.waiters, w)
+	t.blocked--
+	return stopped(in.context().Err(), w.ln)
+}
+
+func (in *Interpreter) send(c *chanHandle, v *Value, ln int) error {
+	if len(c.receivers) > 0 {
+		w := c.receivers[0]
+		c.receivers = c.receivers[1:]
+		w.val = *v
+		in.tasks.wake(w, nil)
+		return nil
+	}
+	if len(c.buf) < c.size {
+		c.buf = append(c.buf, *v)
+		return nil
+	}
+	w := &chanWaiter{val: *v, ln: ln, wake: make(chan error, 1)}
+	c.senders = append(c.senders, w)
+	return in.wait(c, w)
+}
+
+func (in *Interpreter) recv(c *chanHandle, ln int) (*Value, error) {
+	if len(c.buf) > 0 {
+		v := c.buf[0]
+		c.buf = c.buf[1:]
+		if len(c.senders) > 0 {
+			w := c.senders[0]
+			c.senders = c.senders[1:]
+			c.buf = append(c.buf, w.val)
+			in.tasks.wake(w, nil)
+		}
+		return &v, nil
+	}
+	if len(c.senders) > 0 {
+		w := c.senders[0]
+		c.senders = c.senders[1:]
+		in.tasks.wake(w, nil)
+		return &w.val, nil
+	}
+	w := &chanWaiter{ln: ln, wake: make(chan error, 1)}
+	c.receivers = append(c.receivers, w)
+	if err := in.wait(c, w); err != nil {
+		return nil, err
+	}
+	return &w.val, nil
+}
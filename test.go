@@ -0,0 +1,68 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// errTestsFailed is returned by piku test when an assertion failed or a
+// test file did not run to the end.
+var errTestsFailed = errors.New("tests failed")
+
+// testCmd implements "piku test [dir]": it runs every *_test.pi file in
+// dir, counting the assertions that pass and fail.
+func testCmd(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: piku test [dir]")
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.pi"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no *_test.pi files in %s", dir)
+	}
+	passed, failed, broken := 0, 0, 0
+	for _, file := range files {
+		in := &Interpreter{asserts: &assertTally{}}
+		_, err := runfile(file, newEnv(in))
+		t := in.asserts
+		passed += t.passed
+		failed += t.failed
+		switch {
+		case err != nil:
+			broken++
+			fmt.Printf("FAIL  %s\n", file)
+		case t.failed > 0:
+			fmt.Printf("FAIL  %s  (%d of %d assertions failed)\n", file, t.failed, t.passed+t.failed)
+		default:
+			fmt.Printf("ok    %s  (%d assertions)\n", file, t.passed)
+		}
+		for _, f := range t.failures {
+			fmt.Printf("      %s\n", f)
+		}
+		if err != nil {
+			fmt.Printf("      stopped: %v\n", err)
+		}
+	}
+	summary := []string{fmt.Sprintf("%d passed", passed), fmt.Sprintf("%d failed", failed)}
+	switch {
+	case broken == 1:
+		summary = append(summary, "1 file stopped by an error")
+	case broken > 1:
+		summary = append(summary, fmt.Sprintf("%d files stopped by an error", broken))
+	}
+	fmt.Println(strings.Join(summary, ", "))
+	if failed > 0 || broken > 0 {
+		return errTestsFailed
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package piku
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+func init() {
+	defEager("core", "now", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return mktime(time.Now()), nil
+	})
+	defEager("core", "millis", arity{0, 0}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		return mkint(big.NewInt(time.Now().UnixMilli())), nil
+	})
+	defEager("core", "sleep", arity{1, 1}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		v := args[0]
+		if !isNumber(v) || floatval(v) < 0 {
+			return nil, fmt.Errorf("sleep expects a number of milliseconds of at least 0, got %s, line: %d", describe(v), ln)
+		}
+		if err := env.interp.sleep(time.Duration(floatval(v)*float64(time.Millisecond)), ln); err != nil {
+			return nil, err
+		}
+		return mknil(), nil
+	})
+	defSpecial("core", "elapsed", arity{1, 1}, func(node *Node, env *Env, ln int) (*Value, error, *Env) {
+		start := time.Now()
+		v, err, env := eval(node.Children[1], env, ln)
+		if err != nil {
+			return nil, err, nil
+		}
+		ms := float64(time.Since(start)) / float64(time.Millisecond)
+		return &Value{kind: KindTuple, listval: &[]Value{*v, *mkfloat(ms)}}, nil, env
+	})
+	timeForm := func(op string) eagerFn {
+		return func(args []*Value, env *Env, ln int) (*Value, error) {
+			v, lv := args[0], args[1]
+			layout, err := strval(lv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: layout: %v, line: %d", op, err, ln)
+			}
+			if op == "timeformat" {
+				if !isNumber(v) {
+					return nil, typeError("number", v, ln)
+				}
+				return mkstr(unixTime(v).Format(timeLayout(layout))), nil
+			}
+			s, err := strval(v)
+			if err != nil {
+				return nil, fmt.Errorf("timeparse: %v, line: %d", err, ln)
+			}
+			t, err := time.ParseInLocation(timeLayout(layout), s, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("timeparse: %v, line: %d", err, ln)
+			}
+			return mktime(t), nil
+		}
+	}
+	defEager("core", "timeformat", arity{2, 2}, timeForm("timeformat"))
+	defEager("core", "timeparse", arity{2, 2}, timeForm("timeparse"))
+	defEager("core", "timediff", arity{2, 2}, func(args []*Value, env *Env, ln int) (*Value, error) {
+		a, b := args[0], args[1]
+		// The difference in seconds, positive when a is later.
+		v, err := arith("sub", a, b, ln)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
+
+// Times are Unix timestamps: seconds since 1970 as a number, fractional
+// when a float. Layouts are Go time layouts such as "2006-01-02 15:04",
+// or one of the names below.
+var timeLayouts = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"date":     time.DateOnly,
+	"time":     time.TimeOnly,
+	"datetime": time.DateTime,
+}
+
+func timeLayout(s string) string {
+	if l, ok := timeLayouts[s]; ok {
+		return l
+	}
+	return s
+}
+
+// unixTime converts the timestamp v to a time in the local zone.
+func unixTime(v *Value) time.Time {
+	if v.kind == KindInt {
+		return time.Unix(int64(v.varval), 0)
+	}
+	sec, frac := math.Modf(v.realval)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// mktime returns t as a timestamp, a float only when it has a fraction of
+// a second.
+func mktime(t time.Time) *Value {
+	if t.Nanosecond() == 0 {
+		return &Value{kind: KindInt, varval: int(t.Unix())}
+	}
+	return mkfloat(float64(t.UnixNano()) / 1e9)
+}
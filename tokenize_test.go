@@ -0,0 +1,149 @@
+package piku
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// regexpTokenize is the tokenizer piku had before the byte scanner,
+// matching a regular expression for each kind of token in turn. It is
+// kept to measure the scanner against, and to check that the two agree on
+// the programs of the repository; it predates parentheses and infix
+// operators, which it reports as unexpected characters.
+func regexpTokenize(source string) ([]Token, Diagnostics) {
+	source = blankShebang(source)
+	tokenSpec := []struct {
+		pattern string
+		typeStr string
+	}{
+		{`^\d+\.\d+`, "FLOAT"},
+		{`^\d+`, "INTEGER"},
+		{`^[a-zA-Z_][a-zA-Z_0-9-]*`, "IDENTIFIER"},
+		{`^'(?:[^'\\]|\\u\{[0-9a-fA-F]+\}|\\.)'`, "CHAR"},
+		{`^\[`, "LBRACKET"},
+		{`^\]`, "RBRACKET"},
+		{`^\s+`, "WHITESPACE"},
+	}
+
+	var tokens []Token
+	var diags Diagnostics
+	line, col, offset := 1, 1, 0
+	for len(source) > 0 {
+		matched := false
+		if source[0] == '"' {
+			if n := scanString(source); n > 0 {
+				tok := Token{Type: "STRING", Value: source[:n], Offset: offset, Line: line, Col: col}
+				tokens = append(tokens, tok)
+				if _, err := interpolation(tok); err != nil {
+					diags = append(diags, err.(*Diagnostic))
+				}
+				line, col = position(tok.Value, line, col)
+				source = source[n:]
+				offset += n
+				continue
+			}
+		}
+		for _, spec := range tokenSpec {
+			re := regexp.MustCompile(spec.pattern)
+			match := re.FindString(source)
+			if match != "" {
+				if spec.typeStr != "WHITESPACE" {
+					tokens = append(tokens, Token{Type: spec.typeStr, Value: match, Offset: offset, Line: line, Col: col})
+				}
+				if spec.typeStr == "CHAR" {
+					if _, err := unescape(match[1 : len(match)-1]); err != nil {
+						diags = append(diags, &Diagnostic{Line: line, Col: col, Msg: err.Error()})
+					}
+				}
+				for _, r := range match {
+					if r == '\n' {
+						line, col = line+1, 1
+					} else {
+						col++
+					}
+				}
+				source = source[len(match):]
+				offset += len(match)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			r, size := utf8.DecodeRuneInString(source)
+			diags = append(diags, &Diagnostic{Line: line, Col: col, Msg: fmt.Sprintf("unexpected character: %q", r)})
+			source = source[size:]
+			offset += size
+			col++
+		}
+	}
+	return tokens, diags
+}
+
+// sources returns the piku programs of the repository, by file name.
+func sources(tb testing.TB) map[string]string {
+	tb.Helper()
+	srcs := map[string]string{}
+	for _, dir := range []string{"examples", "lessons", "testdata", "benchmarks"} {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.pi"))
+		for _, f := range files {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			srcs[f] = string(b)
+		}
+	}
+	if len(srcs) == 0 {
+		tb.Fatal("no programs found")
+	}
+	return srcs
+}
+
+func TestTokenizeMatchesRegexp(t *testing.T) {
+	srcs := sources(t)
+	srcs["odd"] = "#!/usr/bin/env piku\n[echo 'a' '\\u{1F600}' 1.5 2. x-y \"s {x}\"] é [\"open"
+	for name, src := range srcs {
+		got, gotDiags := tokenizeRecover(src)
+		want, wantDiags := regexpTokenize(src)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: tokens differ from the regexp tokenizer's", name)
+		}
+		if fmt.Sprint(gotDiags) != fmt.Sprint(wantDiags) {
+			t.Errorf("%s: got diagnostics %v, want %v", name, gotDiags, wantDiags)
+		}
+	}
+}
+
+// benchSource is every program of the repository run together.
+func benchSource(b *testing.B) string {
+	var sb strings.Builder
+	for _, src := range sources(b) {
+		sb.WriteString(src)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	src := benchSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokenizeRecover(src)
+	}
+}
+
+func BenchmarkTokenizeRegexp(b *testing.B) {
+	src := benchSource(b)
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		regexpTokenize(src)
+	}
+}
@@ -0,0 +1,485 @@
+package piku
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML reads a TOML document into maps, slices and the Go values
+// pikuValue knows: strings, bools, ints, big ints and floats. Dates and
+// times are kept as the strings they were written as.
+func parseTOML(src string) (map[string]any, error) {
+	p := &tomlParser{src: src, root: map[string]any{}, headers: map[string]bool{}}
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", strings.Count(src[:p.pos], "\n")+1, err)
+	}
+	return p.root, nil
+}
+
+type tomlParser struct {
+	src string
+	pos int
+	// root is the whole document and table the one keys are being added
+	// to, that of the last header.
+	root, table map[string]any
+	// headers are the tables given a [header] so far, so that one given
+	// twice is an error.
+	headers map[string]bool
+}
+
+func (p *tomlParser) parse() error {
+	p.table = p.root
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.src) {
+			return nil
+		}
+		var err error
+		if p.src[p.pos] == '[' {
+			err = p.header()
+		} else {
+			err = p.keyValue(p.table)
+		}
+		if err != nil {
+			return err
+		}
+		p.skipBlank(false)
+		if p.pos < len(p.src) && p.src[p.pos] != '\n' && !strings.HasPrefix(p.src[p.pos:], "\r\n") {
+			return fmt.Errorf("unexpected %q after a value", p.peekRune())
+		}
+	}
+}
+
+// header reads a [table] or [[array of tables]] line and makes the table
+// it names the one keys are added to.
+func (p *tomlParser) header() error {
+	array := strings.HasPrefix(p.src[p.pos:], "[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	p.skipBlank(false)
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	end := "]"
+	if array {
+		end = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], end) {
+		return fmt.Errorf("expected %s after the table name", end)
+	}
+	p.pos += len(end)
+	parent, err := p.descend(p.root, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if array {
+		tables, _ := parent[last].([]any)
+		if _, ok := parent[last]; ok && tables == nil {
+			return fmt.Errorf("%s is not an array of tables", strings.Join(path, "."))
+		}
+		p.table = map[string]any{}
+		parent[last] = append(tables, p.table)
+		return nil
+	}
+	name := strings.Join(path, "\x00")
+	if p.headers[name] {
+		return fmt.Errorf("table %s is defined twice", strings.Join(path, "."))
+	}
+	p.headers[name] = true
+	p.table, err = p.descend(parent, path[len(path)-1:])
+	return err
+}
+
+// descend returns the table reached from t by the keys of path, making
+// any that do not exist yet. An array of tables leads to its last table.
+func (p *tomlParser) descend(t map[string]any, path []string) (map[string]any, error) {
+	for _, k := range path {
+		switch next := t[k].(type) {
+		case nil:
+			sub := map[string]any{}
+			t[k] = sub
+			t = sub
+		case map[string]any:
+			t = next
+		case []any:
+			last, ok := next[len(next)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", k)
+			}
+			t = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// keyValue reads key = value into t.
+func (p *tomlParser) keyValue(t map[string]any) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+		return fmt.Errorf("expected = after %s", strings.Join(path, "."))
+	}
+	p.pos++
+	p.skipBlank(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err = p.descend(t, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if _, ok := t[last]; ok {
+		return fmt.Errorf("key %s is defined twice", strings.Join(path, "."))
+	}
+	t[last] = v
+	return nil
+}
+
+// key reads a key, bare or quoted, with any parts after dots.
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		var part string
+		var err error
+		switch {
+		case p.pos >= len(p.src):
+			return nil, fmt.Errorf("expected a key")
+		case p.src[p.pos] == '"':
+			part, err = p.basicString()
+		case p.src[p.pos] == '\'':
+			part, err = p.literalString()
+		default:
+			start := p.pos
+			for p.pos < len(p.src) && isBareKeyChar(p.src[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("unexpected %q where a key was expected", p.peekRune())
+			}
+			part = p.src[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, part)
+		p.skipBlank(false)
+		if p.pos >= len(p.src) || p.src[p.pos] != '.' {
+			return path, nil
+		}
+		p.pos++
+		p.skipBlank(false)
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (any, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case rest == "":
+		return nil, fmt.Errorf("expected a value")
+	case strings.HasPrefix(rest, `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(rest, "'''"):
+		return p.multilineString("'''")
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		return p.literalString()
+	case rest[0] == '[':
+		return p.array()
+	case rest[0] == '{':
+		return p.inlineTable()
+	case strings.HasPrefix(rest, "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(rest, "false"):
+		p.pos += 5
+		return false, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("0123456789abcdefABCDEFxonitTZ+-_.:", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	// A date may be followed by a time after a space.
+	if isTOMLDate(p.src[start:p.pos]) && p.pos+1 < len(p.src) && p.src[p.pos] == ' ' && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9' {
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789Z+-.:", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	}
+	return tomlScalar(p.src[start:p.pos])
+}
+
+// tomlScalar converts the text of a number, date or time.
+func tomlScalar(s string) (any, error) {
+	switch s {
+	case "":
+		return nil, fmt.Errorf("expected a value")
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	if isTOMLDate(s) || len(s) >= 5 && s[2] == ':' {
+		return s, nil
+	}
+	if strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, "__") {
+		return nil, fmt.Errorf("invalid number %s", s)
+	}
+	digits := strings.ReplaceAll(s, "_", "")
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(digits, prefix) {
+			n, err := strconv.ParseInt(digits[2:], base, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", s)
+			}
+			return int(n), nil
+		}
+	}
+	if strings.ContainsAny(digits, ".eE") {
+		f, err := strconv.ParseFloat(digits, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", s)
+		}
+		return f, nil
+	}
+	if n, err := strconv.Atoi(digits); err == nil {
+		return n, nil
+	}
+	if n, ok := new(big.Int).SetString(digits, 10); ok {
+		return n, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", s)
+}
+
+// isTOMLDate reports whether s starts with a date, 1979-05-27.
+func isTOMLDate(s string) bool {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return false
+	}
+	for _, i := range []int{0, 1, 2, 3, 5, 6, 8, 9} {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *tomlParser) array() (any, error) {
+	p.pos++
+	items := []any{}
+	for {
+		p.skipBlank(true)
+		if p.pos < len(p.src) && p.src[p.pos] == ']' {
+			p.pos++
+			return items, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		p.skipBlank(true)
+		if p.pos < len(p.src) && p.src[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != ']' {
+			return nil, fmt.Errorf("expected , or ] in an array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (any, error) {
+	p.pos++
+	t := map[string]any{}
+	p.skipBlank(false)
+	if p.pos < len(p.src) && p.src[p.pos] == '}' {
+		p.pos++
+		return t, nil
+	}
+	for {
+		p.skipBlank(false)
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.pos >= len(p.src) {
+			return nil, fmt.Errorf("expected } to end an inline table")
+		}
+		switch p.src[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected , or } in an inline table")
+		}
+	}
+}
+
+// basicString reads a string in double quotes, with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\n':
+			return "", fmt.Errorf("a string in \" cannot go over a line")
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// literalString reads a string in single quotes, taken as it is.
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// multilineString reads a string in triple quotes. A newline right after
+// the opening quotes is dropped, and in """ strings so is a backslash at
+// the end of a line together with the space after it.
+func (p *tomlParser) multilineString(quote string) (string, error) {
+	p.pos += 3
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos += 2
+	} else if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.pos++
+	}
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		if strings.HasPrefix(p.src[p.pos:], quote) {
+			// Up to two quotes may come right before the closing ones.
+			n := 3
+			for n < 5 && p.pos+n < len(p.src) && p.src[p.pos+n] == quote[0] {
+				n++
+			}
+			b.WriteString(p.src[p.pos : p.pos+n-3])
+			p.pos += n
+			return b.String(), nil
+		}
+		c := p.src[p.pos]
+		if c == '\\' && quote == `"""` {
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				rest = strings.TrimLeft(rest, " \t\r\n")
+				p.pos = len(p.src) - len(rest)
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// escape reads the escape sequence at the backslash at p.pos into b.
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.src) {
+		return fmt.Errorf("unterminated string")
+	}
+	c := p.src[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return fmt.Errorf("invalid escape \\%c", c)
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid escape \\%c%s", c, p.src[p.pos:p.pos+n])
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines too when lines
+// is set.
+func (p *tomlParser) skipBlank(lines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case lines && (c == '\n' || c == '\r'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) peekRune() rune {
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
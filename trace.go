@@ -0,0 +1,145 @@
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The interpreter keeps the stack of function calls in progress. An error
+// that leaves a function takes a copy of the stack with it, so that the
+// report of an uncaught error shows how the program got to where it
+// failed, and try hands the copy on to the error value it binds.
+
+// maxTraceFrames bounds the calls a stack trace shows, so that runaway
+// recursion does not bury the error under thousands of lines.
+const maxTraceFrames = 20
+
+// callFrame is a call in progress: the name the function was called by,
+// or "function" when it has none, and the file and line of the call.
+type callFrame struct {
+	name string
+	line int
+	// file is the source file the call is in and def the one the function
+	// was defined in, each "" when not known.
+	file, def string
+	// start is when the call began and inner the time spent in the calls
+	// it made, kept only while profiling.
+	start time.Time
+	inner time.Duration
+}
+
+func (f callFrame) String() string {
+	if f.file == "" {
+		return fmt.Sprintf("%s called at line %d", f.name, f.line)
+	}
+	if f.def != "" && f.def != f.file {
+		return fmt.Sprintf("%s, defined in %s, called at line %d of %s", f.name, f.def, f.line, f.file)
+	}
+	return fmt.Sprintf("%s called at line %d of %s", f.name, f.line, f.file)
+}
+
+// tracedError is an error that left a function, with the calls that were
+// in progress when it did, innermost first.
+type tracedError struct {
+	err   error
+	trace []callFrame
+}
+
+func (e *tracedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tracedError) Unwrap() error {
+	return e.err
+}
+
+// enter records a call on line ln to name, a function defined in the
+// file def, until the function it returns is called. The body of the
+// function runs as code of def.
+func (in *Interpreter) enter(name string, ln int, def string) func() {
+	if in == nil {
+		return func() {}
+	}
+	file := in.file
+	in.calls = append(in.calls, callFrame{name: name, line: ln, file: file, def: def})
+	if def != "" {
+		in.file = def
+	}
+	if in.prof == nil {
+		return func() {
+			in.calls = in.calls[:len(in.calls)-1]
+			in.file = file
+		}
+	}
+	in.calls[len(in.calls)-1].start = time.Now()
+	return func() {
+		in.prof.called(in.calls)
+		in.calls = in.calls[:len(in.calls)-1]
+		in.file = file
+	}
+}
+
+// traced attaches the calls in progress to err, unless it already has a
+// trace or is not an error try could catch.
+func (in *Interpreter) traced(err error) error {
+	if in == nil || len(in.calls) == 0 || !catchable(err) || errorTrace(err) != nil {
+		return err
+	}
+	trace := make([]callFrame, len(in.calls))
+	for i, f := range in.calls {
+		trace[len(trace)-1-i] = f
+	}
+	return &tracedError{err: err, trace: trace}
+}
+
+// errorTrace returns the calls that were in progress when err was raised.
+// An error value raised again keeps the trace it was first raised with.
+func errorTrace(err error) []callFrame {
+	var se *scriptError
+	if errors.As(err, &se) && se.trace != nil {
+		return se.trace
+	}
+	var te *tracedError
+	if errors.As(err, &te) {
+		return te.trace
+	}
+	return nil
+}
+
+// traceLines renders a trace, one call to a line, leaving out the middle
+// of a long one.
+func traceLines(trace []callFrame) []string {
+	var lines []string
+	for i, f := range trace {
+		if len(trace) > maxTraceFrames && i == maxTraceFrames/2 {
+			lines = append(lines, fmt.Sprintf("... %d more calls", len(trace)-maxTraceFrames))
+		}
+		if len(trace) <= maxTraceFrames || i < maxTraceFrames/2 || i >= len(trace)-maxTraceFrames/2 {
+			lines = append(lines, f.String())
+		}
+	}
+	return lines
+}
+
+// traceback is printed after an uncaught error: its stack trace, if it
+// has one, or nothing.
+func traceback(err error) string {
+	trace := errorTrace(err)
+	if trace == nil {
+		return ""
+	}
+	return "\nstack trace, innermost call first:\n  " + strings.Join(traceLines(trace), "\n  ")
+}
+
+// swapCalls makes calls the call stack in progress and returns the one it
+// replaces, for handing control to a generator or coroutine and back.
+func (in *Interpreter) swapCalls(calls []callFrame) []callFrame {
+	if in == nil {
+		return nil
+	}
+	prev := in.calls
+	in.calls = calls
+	return prev
+}
@@ -0,0 +1,395 @@
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The transpiler turns a program into a standalone Go source file. Values
+// keep their dynamic nature: numbers are int, lists are *[]any and functions
+// are func(...any) any. Variables live in scopes as they do in the
+// interpreter: the program runs in the global scope, and each call of a
+// function in a scope of its own whose parent is the scope the function
+// was made in. The generated code names the current scope s.
+
+const transpileRuntime = `
+type scope struct {
+	vals   map[string]any
+	parent *scope
+}
+
+func (s *scope) child() *scope {
+	return &scope{vals: map[string]any{}, parent: s}
+}
+
+func get(s *scope, name string) any {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vals[name]; ok {
+			return v
+		}
+	}
+	panic(fmt.Sprintf("undefined identifier: %s", name))
+}
+
+func set(s *scope, name string, v any) any {
+	s.vals[name] = v
+	return nil
+}
+
+func num(v any) int {
+	n, ok := v.(int)
+	if !ok {
+		panic(fmt.Sprintf("expected number, got %T", v))
+	}
+	return n
+}
+
+func lst(v any) *[]any {
+	l, ok := v.(*[]any)
+	if !ok {
+		panic(fmt.Sprintf("expected list, got %T", v))
+	}
+	return l
+}
+
+func call(f any, args ...any) any {
+	fn, ok := f.(func(...any) any)
+	if !ok {
+		panic("not a function")
+	}
+	return fn(args...)
+}
+
+func truthy(v any) bool {
+	n, ok := v.(int)
+	return !ok || n > 0
+}
+
+func list(vs ...any) any {
+	return &vs
+}
+
+// texts holds the lists made as strings, which print as text.
+var texts = map[*[]any]bool{}
+
+func str(s string) any {
+	l := []any{}
+	for _, r := range s {
+		l = append(l, int(r))
+	}
+	texts[&l] = true
+	return &l
+}
+
+func index(l, i any) any {
+	return (*lst(l))[num(i)]
+}
+
+func rng(l, a, b any) any {
+	s := (*lst(l))[num(a):]
+	if num(b) != 0 {
+		s = (*lst(l))[num(a):num(b)]
+	}
+	texts[&s] = texts[lst(l)]
+	return &s
+}
+
+func edit(s *scope, name string, i, v any) any {
+	l := get(s, name)
+	(*lst(l))[num(i)] = v
+	return l
+}
+
+// text returns the string a list made as one stands for, while it holds
+// only printable characters.
+func text(l *[]any) (string, bool) {
+	if !texts[l] {
+		return "", false
+	}
+	var rs []rune
+	for _, e := range *l {
+		c, ok := e.(int)
+		if !ok || c > unicode.MaxRune || !(unicode.IsPrint(rune(c)) || unicode.IsSpace(rune(c))) {
+			return "", false
+		}
+		rs = append(rs, rune(c))
+	}
+	return string(rs), true
+}
+
+func quote(s string) string {
+	q := []rune{'"'}
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '{', '}':
+			q = append(q, '\\', r)
+		case '\n':
+			q = append(q, '\\', 'n')
+		case '\t':
+			q = append(q, '\\', 't')
+		case '\r':
+			q = append(q, '\\', 'r')
+		default:
+			q = append(q, r)
+		}
+	}
+	return string(append(q, '"'))
+}
+
+func show(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case int:
+		return fmt.Sprint(v)
+	case *[]any:
+		if s, ok := text(v); ok {
+			return quote(s)
+		}
+		s := "[list"
+		for _, e := range *v {
+			s += " " + show(e)
+		}
+		return s + "]"
+	case func(...any) any:
+		return "<func>"
+	}
+	return fmt.Sprintf("<unprintable %T>", v)
+}
+
+func echo(v any) any {
+	if l, ok := v.(*[]any); ok {
+		if s, ok := text(l); ok {
+			fmt.Println(s)
+			return nil
+		}
+	}
+	fmt.Println(show(v))
+	return nil
+}
+
+func printchar(v any) any {
+	fmt.Printf("%c", rune(num(v)))
+	return nil
+}
+
+func newline() any {
+	fmt.Println()
+	return nil
+}
+
+func print(v any) any {
+	if l, ok := v.(*[]any); ok {
+		rs := []rune{}
+		for _, e := range *l {
+			c, ok := e.(int)
+			if !ok {
+				rs = nil
+				break
+			}
+			rs = append(rs, rune(c))
+		}
+		if rs != nil {
+			fmt.Print(string(rs))
+			return nil
+		}
+	}
+	fmt.Print(show(v))
+	return nil
+}
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Error", r)
+			os.Exit(1)
+		}
+	}()
+	run()
+}
+`
+
+type transpiler struct {
+	sb strings.Builder
+}
+
+// transpile returns Go source equivalent to the program in nodes.
+func transpile(nodes []*Node) (string, error) {
+	t := &transpiler{}
+	t.sb.WriteString("// Code generated by piku transpile. DO NOT EDIT.\n\npackage main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"unicode\"\n)\n")
+	t.sb.WriteString(transpileRuntime)
+	t.sb.WriteString("\nfunc run() {\ns := &scope{vals: map[string]any{}}\n")
+	for _, n := range nodes {
+		if err := t.stmt(n); err != nil {
+			return "", err
+		}
+	}
+	t.sb.WriteString("}\n")
+	src, err := format.Source([]byte(t.sb.String()))
+	if err != nil {
+		return "", fmt.Errorf("transpile: generated invalid Go: %v", err)
+	}
+	return string(src), nil
+}
+
+func (t *transpiler) stmt(n *Node) error {
+	e, err := t.expr(n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&t.sb, "\t_ = %s\n", e)
+	return nil
+}
+
+func (t *transpiler) exprs(nodes []*Node) ([]string, error) {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		e, err := t.expr(n)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = e
+	}
+	return out, nil
+}
+
+func (t *transpiler) expr(n *Node) (string, error) {
+	switch n.Type {
+	case "INTEGER":
+		if _, err := strconv.Atoi(n.Value); err != nil {
+			return "", fmt.Errorf("transpile: integer %s is too large, line: %d", n.Value, n.Line)
+		}
+		return "any(" + n.Value + ")", nil
+	case "STRING":
+		return "str(" + strconv.Quote(n.Value) + ")", nil
+	case "CHAR":
+		return "any(" + strconv.Itoa(charValue(n).varval) + ")", nil
+	case "FLOAT":
+		return "", fmt.Errorf("transpile: floats are not supported, line: %d", n.Line)
+	case "IDENTIFIER":
+		return "get(s, " + strconv.Quote(n.Value) + ")", nil
+	}
+	if len(n.Children) == 0 {
+		return "", fmt.Errorf("transpile: empty form, line: %d", n.Line)
+	}
+	head := n.Children[0].Value
+	arity := map[string]int{
+		"set": 3, "echo": 2, "add": 3, "sub": 3, "mul": 3, "div": 3, "mod": 3,
+		"neg": 2, "if": 4, "index": 3, "range": 4, "edit": 4, "printchar": 2, "newline": 1, "print": 2,
+	}
+	if want, ok := arity[head]; ok && len(n.Children) != want {
+		return "", fmt.Errorf("transpile: %s expects %d arguments, got %d, line: %d", head, want-1, len(n.Children)-1, n.Line)
+	}
+	switch head {
+	case "set":
+		v, err := t.expr(n.Children[2])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("set(s, %q, %s)", n.Children[1].Value, v), nil
+	case "edit":
+		args, err := t.exprs(n.Children[2:])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("edit(s, %q, %s)", n.Children[1].Value, strings.Join(args, ", ")), nil
+	case "func":
+		// The documentation string, if there is one, is left out.
+		if len(n.Children) != 3 && len(n.Children) != 4 {
+			return "", fmt.Errorf("transpile: func expects 2 or 3 arguments, got %d, line: %d", len(n.Children)-1, n.Line)
+		}
+		body, err := t.expr(n.Children[len(n.Children)-1])
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		sb.WriteString("any(func(args ...any) any {\ns := s.child()\n")
+		for i, p := range n.Children[1].Children {
+			name, _, def, ok := paramParts(p)
+			if !ok {
+				return "", fmt.Errorf("transpile: invalid parameter, line: %d", p.Line)
+			}
+			if def == nil {
+				fmt.Fprintf(&sb, "s.vals[%q] = args[%d]\n", name.Value, i)
+				continue
+			}
+			d, err := t.expr(def)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&sb, "if len(args) > %d {\ns.vals[%q] = args[%d]\n} else {\ns.vals[%q] = %s\n}\n", i, name.Value, i, name.Value, d)
+		}
+		fmt.Fprintf(&sb, "return %s\n})", body)
+		return sb.String(), nil
+	case "if":
+		args, err := t.exprs(n.Children[1:])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("func() any {\nif truthy(%s) {\nreturn %s\n}\nreturn %s\n}()", args[0], args[1], args[2]), nil
+	case "add", "sub", "mul", "div", "mod":
+		args, err := t.exprs(n.Children[1:])
+		if err != nil {
+			return "", err
+		}
+		op := map[string]string{"add": "+", "sub": "-", "mul": "*", "div": "/", "mod": "%"}[head]
+		return fmt.Sprintf("any(num(%s) %s num(%s))", args[0], op, args[1]), nil
+	case "neg":
+		a, err := t.expr(n.Children[1])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("any(-num(%s))", a), nil
+	case "call", "list", "index", "range", "echo", "printchar", "newline", "print":
+		if head == "call" && len(n.Children) < 2 {
+			return "", fmt.Errorf("transpile: call expects a function, line: %d", n.Line)
+		}
+		args, err := t.exprs(n.Children[1:])
+		if err != nil {
+			return "", err
+		}
+		fn := map[string]string{"range": "rng"}[head]
+		if fn == "" {
+			fn = head
+		}
+		return fmt.Sprintf("%s(%s)", fn, strings.Join(args, ", ")), nil
+	}
+	return "", fmt.Errorf("transpile: unsupported form: %s, line: %d", head, n.Line)
+}
+
+// transpileCmd implements "piku transpile file.pi [-o out.go]".
+func transpileCmd(args []string) error {
+	fs := flag.NewFlagSet("transpile", flag.ContinueOnError)
+	out := fs.String("o", "", "write the Go source to this file instead of stdout")
+	var src string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		src, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if src == "" && fs.NArg() > 0 {
+		src = fs.Arg(0)
+	}
+	if src == "" {
+		return errors.New("usage: piku transpile file.pi [-o out.go]")
+	}
+	nodes, err := LoadFile(src)
+	if err != nil {
+		return err
+	}
+	code, err := transpile(nodes)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.WriteString(code)
+		return err
+	}
+	return os.WriteFile(*out, []byte(code), 0644)
+}
@@ -0,0 +1,84 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// transpileTests are programs whose transpiled Go must print what the
+// interpreter prints.
+var transpileTests = []struct {
+	name, src string
+}{
+	{"recursion", `
+[set fib [func [n] [if [sub n 1] [add [call fib [sub n 1]] [call fib [sub n 2]]] n]]]
+[echo [call fib 20]]
+`},
+	{"globals survive calls", `
+[set x 5]
+[set f [func [x] [mul x 2]]]
+[set g [func [x] [set x 1]]]
+[echo [call f 21]]
+[call g 3]
+[echo x]
+`},
+	{"closures", `
+[set adder [func [n] [func [x] [add x n]]]]
+[set add5 [call adder 5]]
+[set add7 [call adder 7]]
+[echo [call add5 1]]
+[echo [call add7 1]]
+`},
+	{"defaults", `
+[set f [func [a [b 10]] [sub a b]]]
+[echo [call f 3]]
+[echo [call f 3 1]]
+`},
+	{"lists", `
+[set l [list 1 2 3]]
+[edit l 0 9]
+[echo l]
+[echo [range l 1 0]]
+[print "text"] [newline]
+`},
+	{"strings", `
+[set w "piku"]
+[echo w]
+[echo [list 90 85 77]]
+[echo [range w 1 0]]
+`},
+}
+
+func TestTranspileMatchesInterpreter(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil || testing.Short() {
+		t.Skip("needs the go command")
+	}
+	for _, tt := range transpileTests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, diags := parseSource(tt.src)
+			if len(diags) > 0 {
+				t.Fatal(diags)
+			}
+			code, err := transpile(nodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(t.TempDir(), "main.go")
+			if err := os.WriteFile(file, []byte(code), 0644); err != nil {
+				t.Fatal(err)
+			}
+			out, err := exec.Command(gobin, "run", file).CombinedOutput()
+			if err != nil {
+				t.Fatalf("go run: %v\n%s", err, out)
+			}
+			if want := RunSource(tt.src); string(out) != want {
+				t.Errorf("transpiled program printed\n%s\nthe interpreter\n%s", out, want)
+			}
+		})
+	}
+}
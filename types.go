@@ -0,0 +1,443 @@
+package piku
+
+import "fmt"
+
+// The type pass of piku check --types infers the type of expressions from
+// literals, builtin results and parameter annotations, and reports
+// arguments whose type cannot be what the receiving builtin or annotated
+// function expects. Anything it cannot work out is "any" and never causes
+// a report, so untyped programs check cleanly.
+
+// signature gives the argument types of a builtin and the type it returns.
+// An argument type of "-" marks a name or other part that is not evaluated.
+type signature struct {
+	args   []string
+	result string
+}
+
+var builtinTypes = map[string]signature{
+	"add":                {[]string{"number", "number"}, "number"},
+	"sub":                {[]string{"number", "number"}, "number"},
+	"mul":                {[]string{"number", "number"}, "number"},
+	"div":                {[]string{"number", "number"}, "number"},
+	"mod":                {[]string{"number", "number"}, "number"},
+	"neg":                {[]string{"number"}, "number"},
+	"divmod":             {[]string{"number", "number"}, "tuple"},
+	"index":              {[]string{"list", "number"}, "any"},
+	"range":              {[]string{"list", "number", "number"}, "list"},
+	"edit":               {[]string{"list", "number", "any"}, "list"},
+	"print":              {[]string{"any"}, "any"},
+	"echostr":            {[]string{"any"}, "any"},
+	"printchar":          {[]string{"number"}, "any"},
+	"get":                {[]string{"dict", "any"}, "any"},
+	"stat":               {[]string{"string"}, "dict"},
+	"glob":               {[]string{"string"}, "list"},
+	"tempfile":           {[]string{"string"}, "string"},
+	"tempdir":            {nil, "string"},
+	"gzip":               {[]string{"list"}, "list"},
+	"gunzip":             {[]string{"list"}, "list"},
+	"semver-parse":       {[]string{"string"}, "any"},
+	"semver-cmp":         {[]string{"string", "string"}, "number"},
+	"semver-satisfies":   {[]string{"string", "string"}, "number"},
+	"newer":              {[]string{"string", "string"}, "number"},
+	"spawnproc":          {[]string{"string", "list"}, "handle"},
+	"procwait":           {[]string{"handle"}, "number"},
+	"prockill":           {[]string{"handle"}, "any"},
+	"procstdout":         {[]string{"handle", "function"}, "any"},
+	"clipget":            {nil, "string"},
+	"clipset":            {[]string{"string"}, "any"},
+	"choose":             {[]string{"string", "list"}, "any"},
+	"printtable":         {[]string{"list", "list"}, "any"},
+	"diff":               {[]string{"any", "any"}, "list"},
+	"ziplist":            {[]string{"string"}, "list"},
+	"watch":              {[]string{"string", "function"}, "any"},
+	"setmany":            {[]string{"-", "any"}, "any"},
+	"set":                {[]string{"-", "any"}, "any"},
+	"const":              {[]string{"-", "any"}, "any"},
+	"list":               {nil, "list"},
+	"tuple":              {nil, "tuple"},
+	"pipeline":           {nil, "string"},
+	"progress":           {[]string{"number"}, "handle"},
+	"progress-tick":      {[]string{"handle"}, "any"},
+	"format-locale":      {[]string{"number", "string"}, "string"},
+	"format-locale-date": {[]string{"number", "string"}, "string"},
+	"round":              {[]string{"number", "any"}, "number"},
+	"expand":             {[]string{"string"}, "string"},
+	"isnil":              {[]string{"any"}, "number"},
+	"exec":               {[]string{"string", "list", "-", "-"}, "dict"},
+	"typeof":             {[]string{"any"}, "string"},
+	"retry":              {[]string{"number", "number", "function"}, "any"},
+	"ratelimit":          {[]string{"number"}, "handle"},
+	"ratelimit-wait":     {[]string{"handle"}, "any"},
+	"sort":               {[]string{"list"}, "list"},
+	"sortby":             {[]string{"function", "list"}, "list"},
+	"pmap":               {[]string{"function", "list"}, "list"},
+	"help":               {[]string{"-"}, "nil"},
+	"trap":               {[]string{"string", "function"}, "nil"},
+	"copy":               {[]string{"any"}, "any"},
+	"plist":              {nil, "list"},
+	"append":             {[]string{"list", "any"}, "list"},
+	"importdata":         {[]string{"string", "-"}, "any"},
+	"log-debug":          {[]string{"any"}, "nil"},
+	"log-info":           {[]string{"any"}, "nil"},
+	"log-warn":           {[]string{"any"}, "nil"},
+	"log-error":          {[]string{"any"}, "nil"},
+	"ttlcache":           {[]string{"number"}, "handle"},
+	"cache-get":          {[]string{"handle", "string"}, "any"},
+	"cache-put":          {[]string{"handle", "string", "any"}, "any"},
+	"reverse":            {[]string{"list"}, "list"},
+	"contains":           {[]string{"list", "any"}, "number"},
+	"find":               {[]string{"function", "list"}, "any"},
+	"flatten":            {[]string{"list"}, "list"},
+	"zip":                {nil, "list"},
+	"concat":             {nil, "list"},
+	"while":              {[]string{"any", "any"}, "any"},
+	"foreach":            {[]string{"-", "any", "any"}, "any"},
+	"break":              {nil, "any"},
+	"continue":           {nil, "any"},
+	"return":             {[]string{"any"}, "any"},
+	"set-new":            {nil, "set"},
+	"set-add":            {[]string{"set", "any"}, "set"},
+	"set-has":            {[]string{"set", "any"}, "number"},
+	"set-union":          {[]string{"set", "set"}, "set"},
+	"set-intersect":      {[]string{"set", "set"}, "set"},
+	"rematch":            {[]string{"string", "string"}, "any"},
+	"refindall":          {[]string{"string", "string"}, "list"},
+	"rereplace":          {[]string{"string", "string", "string"}, "string"},
+	"now":                {nil, "any"},
+	"timeformat":         {[]string{"number", "string"}, "string"},
+	"timeparse":          {[]string{"string", "string"}, "any"},
+	"timediff":           {[]string{"number", "number"}, "number"},
+	"csvread":            {[]string{"string"}, "list"},
+	"csvwrite":           {[]string{"string", "list"}, "any"},
+	"tcpconnect":         {[]string{"string", "number"}, "handle"},
+	"tcplisten":          {[]string{"number"}, "handle"},
+	"tcpaccept":          {[]string{"handle"}, "handle"},
+	"tcpsend":            {[]string{"handle", "string"}, "nil"},
+	"tcprecv":            {[]string{"handle", "number"}, "any"},
+	"tcpclose":           {[]string{"handle"}, "nil"},
+	"sha256":             {[]string{"string"}, "string"},
+	"sha1":               {[]string{"string"}, "string"},
+	"md5":                {[]string{"string"}, "string"},
+	"hmac":               {[]string{"string", "string"}, "string"},
+	"b64encode":          {[]string{"string"}, "string"},
+	"b64decode":          {[]string{"string"}, "string"},
+	"hexencode":          {[]string{"string"}, "string"},
+	"hexdecode":          {[]string{"string"}, "string"},
+	"format":             {nil, "string"},
+	"printf":             {nil, "nil"},
+	"raise":              {[]string{"any"}, "any"},
+	"error":              {[]string{"any", "string"}, "error"},
+	"try":                {[]string{"any", "-", "any"}, "any"},
+	"errmsg":             {[]string{"error"}, "string"},
+	"errcode":            {[]string{"error"}, "any"},
+	"errtrace":           {[]string{"error"}, "list"},
+	"assert":             {[]string{"any", "string"}, "nil"},
+	"asserteq":           {[]string{"any", "any", "string"}, "nil"},
+	"exit":               {[]string{"number"}, "nil"},
+	"savestate":          {[]string{"string"}, "nil"},
+	"memoize":            {[]string{"function"}, "function"},
+	"apply":              {[]string{"function", "list"}, "any"},
+	"stats":              {nil, "dict"},
+	"compose":            {[]string{"function", "function"}, "function"},
+	"partial":            {[]string{"function"}, "function"},
+	"lazyrange":          {nil, "sequence"},
+	"lazymap":            {[]string{"function", "any"}, "sequence"},
+	"take":               {[]string{"number", "any"}, "list"},
+	"yield":              {[]string{"any"}, "nil"},
+	"next":               {[]string{"generator"}, "any"},
+	"coroutine":          {[]string{"function"}, "coroutine"},
+	"resume":             {[]string{"coroutine", "any"}, "any"},
+	"suspend":            {[]string{"any"}, "any"},
+	"spawn":              {nil, "nil"},
+	"chan":               {[]string{"number"}, "handle"},
+	"send":               {[]string{"handle", "any"}, "nil"},
+	"recv":               {[]string{"handle"}, "any"},
+	"mutex":              {nil, "handle"},
+	"lock":               {[]string{"handle"}, "nil"},
+	"unlock":             {[]string{"handle"}, "nil"},
+	"atomic":             {[]string{"number"}, "handle"},
+	"atomicadd":          {[]string{"handle", "number"}, "number"},
+	"waitgroup":          {nil, "handle"},
+	"wgadd":              {[]string{"handle", "number"}, "nil"},
+	"wgdone":             {[]string{"handle"}, "nil"},
+	"wait":               {[]string{"handle"}, "nil"},
+	"millis":             {nil, "number"},
+	"sleep":              {[]string{"number"}, "nil"},
+	"elapsed":            {[]string{"any"}, "tuple"},
+	"pow":                {[]string{"number", "number"}, "number"},
+	"sqrt":               {[]string{"number"}, "float"},
+	"abs":                {[]string{"number"}, "number"},
+	"floor":              {[]string{"number"}, "number"},
+	"ceil":               {[]string{"number"}, "number"},
+	"min":                {nil, "any"},
+	"max":                {nil, "any"},
+	"band":               {[]string{"number", "number"}, "number"},
+	"bor":                {[]string{"number", "number"}, "number"},
+	"bxor":               {[]string{"number", "number"}, "number"},
+	"shl":                {[]string{"number", "number"}, "number"},
+	"shr":                {[]string{"number", "number"}, "number"},
+	"bnot":               {[]string{"number"}, "number"},
+	"bench":              {nil, "dict"},
+	"loadplugin":         {[]string{"string"}, "nil"},
+	"if":                 {[]string{"any", "any", "any"}, "any"},
+	"call":               {nil, "any"},
+	"default":            {[]string{"any", "any"}, "any"},
+	"func":               {[]string{"-", "-", "-"}, "function"},
+	"genfunc":            {[]string{"-", "-", "-"}, "function"},
+	"macro":              {[]string{"-", "-", "-"}, "macro"},
+	"quote":              {[]string{"-"}, "any"},
+	"eval":               {[]string{"any"}, "any"},
+	"dict":               {nil, "dict"},
+	"import":             {[]string{"-", "-"}, "any"},
+	"echo":               {[]string{"any"}, "nil"},
+	"newline":            {nil, "nil"},
+	"try-getpath":        {[]string{"any", "list", "any"}, "any"},
+	"validate":           {[]string{"any", "any"}, "list"},
+	"zipcreate":          {[]string{"string", "list"}, "number"},
+	"zipextract":         {[]string{"string", "string"}, "list"},
+}
+
+// compatible reports whether a value of type got may be used where want is
+// expected. Strings are lists of characters, so any list may be a string,
+// and arithmetic accepts floats where it accepts numbers.
+func compatible(want, got string) bool {
+	if want == "any" || got == "any" || want == got {
+		return true
+	}
+	return (want == "list" && got == "string") || (want == "string" && got == "list") || (want == "number" && got == "float")
+}
+
+type typeChecker struct {
+	globals map[string]string
+	funcs   map[string]*Node
+	macros  map[string]bool
+	quiet   bool
+	diags   Diagnostics
+}
+
+// typecheck returns the type errors found in nodes.
+func typecheck(nodes []*Node) Diagnostics {
+	t := &typeChecker{globals: map[string]string{}, funcs: map[string]*Node{}, macros: map[string]bool{}}
+	t.collect(nodes)
+	for _, n := range nodes {
+		t.infer(n, nil)
+	}
+	return t.diags
+}
+
+// collect works out the type of every global bound to values of a single
+// type, and remembers functions that are bound once.
+func (t *typeChecker) collect(nodes []*Node) {
+	t.quiet = true
+	defer func() { t.quiet = false }()
+	seen := map[string]int{}
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		if n.Type != "LIST" || len(n.Children) == 0 {
+			return
+		}
+		switch head := n.Children[0].Value; {
+		case (head == "set" || head == "const") && len(n.Children) == 3:
+			name, v := n.Children[1].Value, n.Children[2]
+			seen[name]++
+			typ := t.infer(v, nil)
+			if old, ok := t.globals[name]; ok && old != typ {
+				typ = "any"
+			}
+			t.globals[name] = typ
+			if isForm(v, "func") && seen[name] == 1 {
+				t.funcs[name] = v
+			} else {
+				delete(t.funcs, name)
+			}
+		case head == "foreach" && len(n.Children) == 4:
+			t.globals[n.Children[1].Value] = "any"
+			delete(t.funcs, n.Children[1].Value)
+		case head == "try" && len(n.Children) == 4:
+			t.globals[n.Children[2].Value] = "any"
+			delete(t.funcs, n.Children[2].Value)
+		case head == "setmany" && len(n.Children) == 3:
+			for _, name := range n.Children[1].Children {
+				t.globals[name.Value] = "any"
+				delete(t.funcs, name.Value)
+			}
+		case head == "macro" && len(n.Children) > 1:
+			t.macros[n.Children[1].Value] = true
+		}
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	for _, n := range nodes {
+		visit(n)
+	}
+}
+
+func isForm(n *Node, name string) bool {
+	return n.Type == "LIST" && len(n.Children) > 0 && n.Children[0].Value == name
+}
+
+func (t *typeChecker) mismatch(n *Node, format string, args ...any) {
+	if !t.quiet {
+		t.diags = append(t.diags, &Diagnostic{Line: n.Line, Col: n.Col, Msg: fmt.Sprintf(format, args...)})
+	}
+}
+
+// infer returns the type of n in a scope mapping parameter names to their
+// annotated types, reporting mismatches inside it on the way.
+func (t *typeChecker) infer(n *Node, scope map[string]string) string {
+	switch n.Type {
+	case "INTEGER", "CHAR":
+		return "number"
+	case "FLOAT":
+		return "float"
+	case "STRING":
+		return "string"
+	case "IDENTIFIER":
+		if typ, ok := scope[n.Value]; ok {
+			return typ
+		}
+		if typ, ok := t.globals[n.Value]; ok {
+			return typ
+		}
+		return "any"
+	}
+	if len(n.Children) == 0 || n.Children[0].Type != "IDENTIFIER" {
+		return "any"
+	}
+	head, args := n.Children[0].Value, n.Children[1:]
+	if t.macros[head] {
+		return "any"
+	}
+	switch head {
+	case "quote", "macro", "import":
+		return "any"
+	case "func", "genfunc":
+		if len(args) < 2 || len(args) > 3 {
+			return "function"
+		}
+		inner := map[string]string{}
+		for k, v := range scope {
+			inner[k] = v
+		}
+		for _, p := range args[0].Children {
+			name, typ, def, ok := paramParts(p)
+			if !ok {
+				continue
+			}
+			if typ == "" {
+				typ = "any"
+			}
+			if def != nil {
+				if got := t.infer(def, inner); !compatible(typ, got) {
+					t.mismatch(def, "default of %s is %s, but it is annotated %s", name.Value, got, typ)
+				}
+			}
+			inner[name.Value] = typ
+		}
+		t.infer(args[len(args)-1], inner)
+		return "function"
+	case "if":
+		if len(args) != 3 {
+			return "any"
+		}
+		t.infer(args[0], scope)
+		a, b := t.infer(args[1], scope), t.infer(args[2], scope)
+		if a == b {
+			return a
+		}
+		return "any"
+	case "call":
+		return t.inferCall(args, scope)
+	case "dict":
+		for _, e := range args {
+			if len(e.Children) == 2 {
+				t.infer(e.Children[1], scope)
+			}
+		}
+		return "dict"
+	case "pipeline":
+		for _, stage := range args {
+			for _, w := range stage.Children {
+				if got := t.infer(w, scope); !compatible("string", got) {
+					t.mismatch(w, "pipeline expects string command words, got %s", got)
+				}
+			}
+		}
+		return "string"
+	}
+	sig, ok := builtinTypes[head]
+	result := sig.result
+	for i, a := range args {
+		want := "any"
+		if ok && i < len(sig.args) {
+			want = sig.args[i]
+		}
+		if want == "-" {
+			continue
+		}
+		got := t.infer(a, scope)
+		if !compatible(want, got) {
+			t.mismatch(a, "%s expects %s as argument %d, got %s", head, want, i+1, got)
+		}
+		// Arithmetic turns float when any operand is a float.
+		if result == "number" && want == "number" && got != "number" {
+			result = got
+		}
+	}
+	if !ok {
+		return "any"
+	}
+	return result
+}
+
+// inferCall checks a call form, matching positional arguments against the
+// annotations of a global function bound once to a func literal.
+func (t *typeChecker) inferCall(args []*Node, scope map[string]string) string {
+	if len(args) == 0 {
+		return "any"
+	}
+	f := args[0]
+	if got := t.infer(f, scope); !compatible("function", got) {
+		t.mismatch(f, "call expects a function, got %s", got)
+	}
+	var params []*Node
+	if _, shadowed := scope[f.Value]; f.Type == "IDENTIFIER" && !shadowed && t.funcs[f.Value] != nil {
+		if def := t.funcs[f.Value]; len(def.Children) >= 3 {
+			params = def.Children[1].Children
+		}
+	}
+	pos := 0
+	for _, a := range args[1:] {
+		p, named := namedParam(a, params)
+		if named {
+			a = a.Children[1]
+		} else if pos < len(params) {
+			p = params[pos]
+			pos++
+		}
+		got := t.infer(a, scope)
+		if p == nil {
+			continue
+		}
+		if name, typ, _, ok := paramParts(p); ok && typ != "" && !compatible(typ, got) {
+			t.mismatch(a, "argument %s of %s is annotated %s, got %s", name.Value, f.Value, typ, got)
+		}
+	}
+	return "any"
+}
+
+// namedParam returns the parameter a names when it is written as
+// [name value] for one of params.
+func namedParam(a *Node, params []*Node) (*Node, bool) {
+	if a.Type != "LIST" || len(a.Children) != 2 || a.Children[0].Type != "IDENTIFIER" || isBuiltin(a.Children[0].Value) {
+		return nil, false
+	}
+	for _, p := range params {
+		if name, _, _, ok := paramParts(p); ok && name.Value == a.Children[0].Value {
+			return p, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,205 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// version is the release this binary was built from. Release builds set it
+// with -ldflags "-X github.com/bora-yilmaz/PikuLang.version=v1.2.3".
+var version = "v0.0.0-dev"
+
+// Releases are published on GitHub. Each carries one binary per platform,
+// named piku-GOOS-GOARCH with .exe on Windows, and a checksums.txt in the
+// format written by sha256sum.
+const releasesURL = "https://api.github.com/repos/bora-yilmaz/PikuLang/releases"
+
+type release struct {
+	Tag        string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Draft      bool   `json:"draft"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) asset(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+func fetch(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// latestRelease returns the newest release on channel: stable only
+// considers full releases, beta includes prereleases.
+func latestRelease(channel string) (*release, error) {
+	data, err := fetch(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var releases []release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("reading release list: %v", err)
+	}
+	var best *release
+	var bestv semver
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || (r.Prerelease && channel == "stable") {
+			continue
+		}
+		v, err := parseSemver(r.Tag)
+		if err != nil {
+			continue
+		}
+		if best == nil || v.compare(bestv) > 0 {
+			best, bestv = r, v
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no %s release found", channel)
+	}
+	return best, nil
+}
+
+// checksum finds the sha256 of name in a sha256sum listing.
+func checksum(sums []byte, name string) (string, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// replaceExecutable swaps the file at path for data. The new binary is
+// written next to the old one and renamed over it, so the swap is atomic
+// and a failed download never leaves a broken interpreter behind.
+func replaceExecutable(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".piku-upgrade-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// A running executable cannot be overwritten on Windows, but it can
+		// be moved out of the way.
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Rename(old, path)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// upgradeCmd implements "piku upgrade [--channel=stable|beta]".
+func upgradeCmd(args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	channel := fs.String("channel", "stable", "release channel: stable or beta")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *channel != "stable" && *channel != "beta" {
+		return fmt.Errorf("unknown channel %q: expected stable or beta", *channel)
+	}
+	rel, err := latestRelease(*channel)
+	if err != nil {
+		return err
+	}
+	if cur, err := parseSemver(version); err == nil {
+		if latest, _ := parseSemver(rel.Tag); latest.compare(cur) <= 0 {
+			fmt.Printf("piku %s is up to date\n", version)
+			return nil
+		}
+	}
+	name := fmt.Sprintf("piku-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	binURL, ok := rel.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", rel.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL, ok := rel.asset("checksums.txt")
+	if !ok {
+		return fmt.Errorf("release %s has no checksums.txt", rel.Tag)
+	}
+	sums, err := fetch(sumsURL)
+	if err != nil {
+		return err
+	}
+	want, err := checksum(sums, name)
+	if err != nil {
+		return err
+	}
+	bin, err := fetch(binURL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(bin)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return errors.New("checksum mismatch: the download is corrupt, nothing was changed")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, bin); err != nil {
+		return fmt.Errorf("replacing %s: %v", exe, err)
+	}
+	fmt.Printf("upgraded piku %s to %s\n", version, rel.Tag)
+	return nil
+}
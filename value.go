@@ -0,0 +1,276 @@
+package piku
+
+import "math/big"
+
+// The values of piku. A program embedding piku makes the values it passes
+// to the interpreter with the New functions and reads those it gets back
+// with the methods named for their kinds, which report false for a value
+// of another kind.
+
+// Kind is the kind of a value.
+type Kind uint8
+
+const (
+	KindNil Kind = iota
+	// KindInt is an integer that fits an int and KindBigInt one that does
+	// not. Arithmetic moves between them, so both are numbers.
+	KindInt
+	KindBigInt
+	KindFloat
+	KindList
+	// KindPList is a persistent list, made by plist: one that is never
+	// changed in place.
+	KindPList
+	KindTuple
+	KindDict
+	KindSet
+	KindFunc
+	KindMacro
+	KindSymbol
+	// KindHandle holds a resource of the host, such as a file or a
+	// process, or a Go value handed to the interpreter.
+	KindHandle
+	KindError
+	// KindSeq is a lazy sequence.
+	KindSeq
+	KindGenerator
+	KindCoroutine
+)
+
+// String returns the name piku gives the kind, as typeof does.
+func (k Kind) String() string {
+	switch k {
+	case KindNil:
+		return "nil"
+	case KindInt, KindBigInt:
+		return "number"
+	case KindFloat:
+		return "float"
+	case KindList, KindPList:
+		return "list"
+	case KindTuple:
+		return "tuple"
+	case KindDict:
+		return "dict"
+	case KindSet:
+		return "set"
+	case KindFunc:
+		return "function"
+	case KindMacro:
+		return "macro"
+	case KindSymbol:
+		return "symbol"
+	case KindHandle:
+		return "handle"
+	case KindError:
+		return "error"
+	case KindSeq:
+		return "sequence"
+	case KindGenerator:
+		return "generator"
+	case KindCoroutine:
+		return "coroutine"
+	}
+	return "unknown"
+}
+
+// Value is a piku value, of the kind in kind. Numbers, lists and dicts are
+// held in fields of their own; every other kind keeps what it is made of
+// in ref, read through the method named for it, which is nil or "" for a
+// value of any other kind. Every element of a list is a Value, so it is
+// kept small. A Value is not changed once made, which lets mknum and mknil
+// hand out shared ones.
+//
+// Lists, dicts and sets are shared rather than copied when a value is
+// bound to a second name, passed to a function or put in a container:
+// edit and set-add change the one value wherever it is held. copy makes a
+// value of its own.
+type Value struct {
+	kind    Kind
+	varval  int
+	realval float64
+	listval *[]Value
+	dictval map[string]Value
+	ref     any
+	// text marks a list of character codes made as a string, by a string
+	// literal or a builtin giving text, which prints as the text. Any
+	// other list prints as a list, whatever numbers it holds.
+	text bool
+}
+
+// fn returns the function or macro behind the value.
+func (v *Value) fn() *Function {
+	f, _ := v.ref.(*Function)
+	return f
+}
+
+// big returns the value of a big integer, one too large for varval.
+func (v *Value) big() *big.Int {
+	b, _ := v.ref.(*big.Int)
+	return b
+}
+
+// sym returns the name of a symbol.
+func (v *Value) sym() string {
+	s, _ := v.ref.(string)
+	return s
+}
+
+// scriptErr returns the error behind an error value.
+func (v *Value) scriptErr() *scriptError {
+	e, _ := v.ref.(*scriptError)
+	return e
+}
+
+// handle returns the host resource behind a handle, such as a process.
+func (v *Value) handle() any {
+	if v.kind != KindHandle {
+		return nil
+	}
+	return v.ref
+}
+
+// seq returns the lazy sequence behind a sequence value.
+func (v *Value) seq() *lazySeq {
+	s, _ := v.ref.(*lazySeq)
+	return s
+}
+
+// gen returns the generator behind a generator value.
+func (v *Value) gen() *generator {
+	g, _ := v.ref.(*generator)
+	return g
+}
+
+// co returns the coroutine behind a coroutine value.
+func (v *Value) co() *coroutine {
+	c, _ := v.ref.(*coroutine)
+	return c
+}
+
+// Nil returns the nil value.
+func Nil() *Value {
+	return mknil()
+}
+
+// NewInt returns the integer n.
+func NewInt(n int) *Value {
+	return mknum(n)
+}
+
+// NewBigInt returns the integer x, which it copies.
+func NewBigInt(x *big.Int) *Value {
+	return mkint(new(big.Int).Set(x))
+}
+
+// NewFloat returns the float f.
+func NewFloat(f float64) *Value {
+	return mkfloat(f)
+}
+
+// NewString returns the string s.
+func NewString(s string) *Value {
+	return mkstr(s)
+}
+
+// NewList returns a list of the values in vs.
+func NewList(vs ...*Value) *Value {
+	lst := make([]Value, len(vs))
+	for i, v := range vs {
+		lst[i] = *v
+	}
+	return &Value{kind: KindList, listval: &lst}
+}
+
+// NewDict returns a dict of the entries in m.
+func NewDict(m map[string]*Value) *Value {
+	d := make(map[string]Value, len(m))
+	for k, v := range m {
+		d[k] = *v
+	}
+	return &Value{kind: KindDict, dictval: d}
+}
+
+// NewHandle returns a handle holding x, for the program to pass back to
+// the builtins of the host.
+func NewHandle(x any) *Value {
+	return &Value{kind: KindHandle, ref: x}
+}
+
+// Kind returns the kind of v.
+func (v *Value) Kind() Kind {
+	return v.kind
+}
+
+// IsNil reports whether v is nil.
+func (v *Value) IsNil() bool {
+	return isnil(v)
+}
+
+// Int returns the integer v holds, if it fits an int.
+func (v *Value) Int() (int, bool) {
+	return v.varval, v.kind == KindInt
+}
+
+// BigInt returns any integer v holds.
+func (v *Value) BigInt() (*big.Int, bool) {
+	switch v.kind {
+	case KindInt:
+		return big.NewInt(int64(v.varval)), true
+	case KindBigInt:
+		return new(big.Int).Set(v.big()), true
+	}
+	return nil, false
+}
+
+// Float returns the number v holds as a float.
+func (v *Value) Float() (float64, bool) {
+	if !isNumber(v) {
+		return 0, false
+	}
+	return floatval(v), true
+}
+
+// Text returns the string v holds.
+func (v *Value) Text() (string, bool) {
+	if typeof(v) != "string" {
+		return "", false
+	}
+	s, _ := strval(v)
+	return s, true
+}
+
+// Symbol returns the name of the symbol v holds.
+func (v *Value) Symbol() (string, bool) {
+	return v.sym(), v.kind == KindSymbol
+}
+
+// List returns the elements of a list or tuple.
+func (v *Value) List() ([]*Value, bool) {
+	l := asList(v)
+	if l.kind != KindList && l.kind != KindTuple {
+		return nil, false
+	}
+	vs := make([]*Value, len(*l.listval))
+	for i, e := range *l.listval {
+		vs[i] = &e
+	}
+	return vs, true
+}
+
+// Dict returns the entries of a dict.
+func (v *Value) Dict() (map[string]*Value, bool) {
+	if v.kind != KindDict {
+		return nil, false
+	}
+	m := make(map[string]*Value, len(v.dictval))
+	for k, e := range v.dictval {
+		m[k] = &e
+	}
+	return m, true
+}
+
+// Handle returns what a handle holds.
+func (v *Value) Handle() (any, bool) {
+	return v.handle(), v.kind == KindHandle
+}
@@ -0,0 +1,65 @@
+package piku
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBuiltinReadsAndMakesValues(t *testing.T) {
+	var out bytes.Buffer
+	in := &Interpreter{Stdout: &out}
+	in.RegisterBuiltin("describe", func(args []*Value) (*Value, error) {
+		if args[1].Kind() != KindList || args[1].Kind().String() != "list" {
+			t.Errorf("a string is of kind %v", args[1].Kind())
+		}
+		n, _ := args[0].Int()
+		s, _ := args[1].Text()
+		l, _ := args[2].List()
+		if _, ok := args[2].Text(); ok {
+			t.Error("a list of numbers read as text")
+		}
+		f, _ := args[3].Float()
+		return NewList(NewInt(n+1), NewString(s+"!"), NewInt(len(l)), NewFloat(f*2), NewDict(map[string]*Value{"s": args[1]})), nil
+	})
+	if err := in.Run(`[echo [describe 41 "hi" [list 104 105] 1.5]]`); err != nil {
+		t.Fatal(err)
+	}
+	want := `[list 42 "hi!" 2 3.0 [dict [s "hi"]]]` + "\n"
+	if out.String() != want {
+		t.Errorf("got %s want %s", out.String(), want)
+	}
+}
+
+func TestValueAccessorsCheckTheKind(t *testing.T) {
+	if _, ok := NewString("5").Int(); ok {
+		t.Error("Int of a string")
+	}
+	if _, ok := NewInt(5).Text(); ok {
+		t.Error("Text of a number")
+	}
+	if _, ok := NewInt(5).List(); ok {
+		t.Error("List of a number")
+	}
+	if !Nil().IsNil() || NewInt(0).IsNil() {
+		t.Error("IsNil")
+	}
+	x := struct{}{}
+	if h, ok := NewHandle(x).Handle(); !ok || h != x {
+		t.Error("Handle does not give back what NewHandle was given")
+	}
+}
+
+func TestElementsOutliveEdits(t *testing.T) {
+	src := `[set l [list 1 2 3]]
+[set a [index l 0]]
+[set b [find [func [x] [sub x 1]] l]]
+[set d [dict [k l]]]
+[set c [try-getpath d [list "k" 2] 0]]
+[edit l 0 9]
+[edit l 1 9]
+[edit l 2 9]
+[echo [list a b c]]`
+	if got := RunSource(src); got != "[list 1 2 3]\n" {
+		t.Errorf("got %q, want the elements as they were when read", got)
+	}
+}
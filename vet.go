@@ -0,0 +1,394 @@
+package piku
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// piku vet reports code that runs but is probably not what was meant: a
+// variable that is set and never read, a function that is defined and
+// never called, a name bound in a function that hides one bound further
+// out, and code after a return or exit that can never run. None of these
+// stops a program, unlike the problems check reports, so they are
+// warnings. An if without an else branch is not among them: if takes
+// three arguments, so check already reports one.
+//
+// A file that only defines things, as one written to be imported does,
+// is not warned about the names it leaves unused at the top level.
+
+// binding is a name bound in a scope.
+type binding struct {
+	node *Node
+	kind string
+	// fn is set for a name set to a func or genfunc.
+	fn   bool
+	used bool
+}
+
+// scope holds the names bound at the top level of a file or by a call of
+// a function: its parameters and what set, foreach and try bind in its
+// body, which are local to the call.
+type scope struct {
+	names map[string]*binding
+}
+
+type vetter struct {
+	scopes []*scope
+	// defining holds the functions whose bodies are being walked, so that
+	// a recursive call is not counted as a use.
+	defining []*binding
+	diags    Diagnostics
+}
+
+// vetProgram returns the warnings for nodes, a whole file.
+func vetProgram(nodes []*Node) Diagnostics {
+	v := &vetter{}
+	v.enter(nil, nodes)
+	for i, n := range nodes {
+		v.walk(n)
+		if i < len(nodes)-1 {
+			if exit := exits(n); exit != "" {
+				v.report(nodes[i+1], "unreachable code after %s", exit)
+			}
+		}
+	}
+	v.leave(!definesOnly(nodes))
+	sortDiagnostics(v.diags)
+	return v.diags
+}
+
+func (v *vetter) report(n *Node, format string, args ...any) {
+	v.diags = append(v.diags, &Diagnostic{Line: n.Line, Col: n.Col, Msg: fmt.Sprintf(format, args...)})
+}
+
+// enter opens the scope of the parameters params and of the names bound
+// in body.
+func (v *vetter) enter(params []*Node, body []*Node) {
+	v.scopes = append(v.scopes, &scope{names: map[string]*binding{}})
+	for _, p := range params {
+		v.bind(p, "parameter", nil)
+	}
+	for _, n := range body {
+		v.collect(n)
+	}
+}
+
+// leave closes the innermost scope, warning about its unused variables
+// if report is set.
+func (v *vetter) leave(report bool) {
+	s := v.scopes[len(v.scopes)-1]
+	v.scopes = v.scopes[:len(v.scopes)-1]
+	if !report {
+		return
+	}
+	for name, b := range s.names {
+		switch {
+		case b.used || b.kind != "set":
+		case b.fn:
+			v.report(b.node, "function %s is defined but never called", name)
+		default:
+			v.report(b.node, "%s is set but never used", name)
+		}
+	}
+}
+
+// collect binds the names that n binds in the current scope, leaving out
+// the bodies of the functions in it, which have scopes of their own.
+func (v *vetter) collect(n *Node) {
+	if n.Type != "LIST" || len(n.Children) == 0 || n.Children[0].Type != "IDENTIFIER" {
+		return
+	}
+	head, args := n.Children[0].Value, n.Children[1:]
+	if ar, ok := builtinArity(head); ok && !ar.allows(len(args)) {
+		return
+	}
+	switch head {
+	case "quote", "import", "func", "genfunc":
+		return
+	case "set", "const", "foreach", "macro":
+		if args[0].Type == "IDENTIFIER" {
+			v.bind(args[0], head, args[1])
+		}
+		if head == "macro" {
+			return
+		}
+	case "try":
+		if args[1].Type == "IDENTIFIER" {
+			v.bind(args[1], head, nil)
+		}
+	case "importdata":
+		if len(args) == 2 && args[1].Type == "IDENTIFIER" {
+			v.bind(args[1], head, nil)
+		}
+	case "setmany":
+		for _, name := range args[0].Children {
+			if name.Type == "IDENTIFIER" {
+				v.bind(name, head, nil)
+			}
+		}
+	}
+	for _, a := range args {
+		v.collect(a)
+	}
+}
+
+// bind adds name to the current scope, bound by the form kind to value,
+// unless it is there already.
+func (v *vetter) bind(name *Node, kind string, value *Node) {
+	s := v.scopes[len(v.scopes)-1]
+	if _, ok := s.names[name.Value]; ok {
+		return
+	}
+	if outer := v.lookup(name.Value); outer != nil {
+		if kind == "parameter" {
+			v.report(name, "parameter %s shadows the %s bound at line %d", name.Value, name.Value, outer.node.Line)
+		} else {
+			v.report(name, "%s binds a new %s local to the function, shadowing the one bound at line %d", kind, name.Value, outer.node.Line)
+		}
+	}
+	s.names[name.Value] = &binding{node: name, kind: kind, fn: isFuncForm(value)}
+}
+
+// lookup returns the binding of name in the innermost scope that has
+// one, or nil.
+func (v *vetter) lookup(name string) *binding {
+	for i := len(v.scopes) - 1; i >= 0; i-- {
+		if b, ok := v.scopes[i].names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// use records that name is read, unless from the body of the function
+// it names.
+func (v *vetter) use(name *Node) {
+	b := v.lookup(name.Value)
+	if b == nil {
+		return
+	}
+	for _, d := range v.defining {
+		if d == b {
+			return
+		}
+	}
+	b.used = true
+}
+
+func (v *vetter) isMacro(name string) bool {
+	b := v.lookup(name)
+	return b != nil && b.kind == "macro"
+}
+
+func isFuncForm(n *Node) bool {
+	return n != nil && n.Type == "LIST" && len(n.Children) >= 3 && n.Children[0].Type == "IDENTIFIER" &&
+		(n.Children[0].Value == "func" || n.Children[0].Value == "genfunc")
+}
+
+// definesOnly reports whether the top level of a file does nothing but
+// bind names and import others.
+func definesOnly(nodes []*Node) bool {
+	for _, n := range nodes {
+		if n.Type != "LIST" || len(n.Children) == 0 {
+			return false
+		}
+		switch n.Children[0].Value {
+		case "set", "const", "setmany", "macro", "import", "quote":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// evaluated returns how many of the n arguments of the builtin form head
+// are always evaluated, in order, when it is.
+func evaluated(head string, n int) int {
+	switch head {
+	case "quote", "import", "func", "genfunc", "macro", "try", "retry", "default":
+		return 0
+	case "if", "while", "importdata":
+		return 1
+	case "foreach":
+		return 2
+	}
+	return n
+}
+
+// exits returns the form that n always leaves by, return, exit, raise,
+// break or continue, or "" if it may finish.
+func exits(n *Node) string {
+	if n.Type != "LIST" || len(n.Children) == 0 {
+		return ""
+	}
+	head, args := n.Children[0].Value, n.Children[1:]
+	if ar, ok := builtinArity(head); !ok || !ar.allows(len(args)) {
+		return ""
+	}
+	switch head {
+	case "return", "exit", "raise", "break", "continue":
+		return head
+	case "if":
+		if exit := exits(args[1]); exit != "" && exits(args[2]) != "" {
+			return exit
+		}
+	}
+	for _, a := range args[:evaluated(head, len(args))] {
+		if exit := exits(a); exit != "" {
+			return exit
+		}
+	}
+	return ""
+}
+
+// function walks a function with the parameters in list and body, which
+// is bound to self if that is not nil.
+func (v *vetter) function(list, body *Node, self *binding) {
+	if list.Type != "LIST" {
+		return
+	}
+	var params []*Node
+	for _, p := range list.Children {
+		name, _, def, ok := paramParts(p)
+		if !ok {
+			continue
+		}
+		if def != nil {
+			v.walk(def)
+		}
+		params = append(params, name)
+	}
+	v.enter(params, []*Node{body})
+	if self != nil {
+		v.defining = append(v.defining, self)
+	}
+	v.walk(body)
+	if self != nil {
+		v.defining = v.defining[:len(v.defining)-1]
+	}
+	v.leave(true)
+}
+
+func (v *vetter) walk(n *Node) {
+	switch n.Type {
+	case "IDENTIFIER":
+		v.use(n)
+		return
+	case "LIST":
+	default:
+		return
+	}
+	if len(n.Children) == 0 {
+		return
+	}
+	head, args := n.Children[0], n.Children[1:]
+	if head.Type != "IDENTIFIER" {
+		return
+	}
+	ar, ok := builtinArity(head.Value)
+	if !ok {
+		// A macro, whose arguments may be code.
+		v.use(head)
+		for _, a := range args {
+			v.walk(a)
+		}
+		return
+	}
+	if !ar.allows(len(args)) {
+		return
+	}
+	for i, a := range args[:evaluated(head.Value, len(args))] {
+		if exit := exits(a); exit != "" && i < len(args)-1 {
+			v.report(args[i+1], "unreachable code after %s", exit)
+			break
+		}
+	}
+	switch head.Value {
+	case "quote", "import":
+		return
+	case "set", "const":
+		if isFuncForm(args[1]) && args[0].Type == "IDENTIFIER" {
+			f := args[1].Children[1:]
+			v.function(f[0], f[len(f)-1], v.scopes[len(v.scopes)-1].names[args[0].Value])
+			return
+		}
+		v.walk(args[1])
+		return
+	case "func", "genfunc":
+		v.function(args[0], args[len(args)-1], nil)
+		return
+	case "macro":
+		v.function(args[1], args[2], nil)
+		return
+	case "setmany":
+		v.walk(args[1])
+		return
+	case "importdata":
+		v.walk(args[0])
+		return
+	case "foreach":
+		v.walk(args[1])
+		v.walk(args[2])
+		return
+	case "try":
+		v.walk(args[0])
+		v.walk(args[2])
+		return
+	case "call":
+		v.walk(args[0])
+		for _, a := range args[1:] {
+			if a.Type == "LIST" && len(a.Children) == 2 && a.Children[0].Type == "IDENTIFIER" && !isBuiltin(a.Children[0].Value) && !v.isMacro(a.Children[0].Value) {
+				// A named argument.
+				v.walk(a.Children[1])
+				continue
+			}
+			v.walk(a)
+		}
+		return
+	case "exec", "dict":
+		// dict entries and exec options are written [name value].
+		for i, a := range args {
+			if head.Value == "exec" && i < 2 {
+				v.walk(a)
+			} else if a.Type == "LIST" && len(a.Children) == 2 {
+				v.walk(a.Children[1])
+			}
+		}
+		return
+	case "pipeline":
+		for _, stage := range args {
+			for _, w := range stage.Children {
+				v.walk(w)
+			}
+		}
+		return
+	}
+	for _, a := range args {
+		v.walk(a)
+	}
+}
+
+// vetCmd implements "piku vet file.pi".
+func vetCmd(args []string) error {
+	fs := flag.NewFlagSet("vet", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: piku vet file.pi")
+	}
+	src := fs.Arg(0)
+	nodes, err := LoadFile(src)
+	if err != nil {
+		return err
+	}
+	diags := vetProgram(nodes)
+	for _, d := range diags {
+		fmt.Printf("%s:%d:%d: %s\n", src, d.Line, d.Col, d.Msg)
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("%d warning(s)", len(diags))
+	}
+	return nil
+}
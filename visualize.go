@@ -0,0 +1,186 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"os"
+	"sort"
+)
+
+// maxVizSteps bounds the steps a visualization records, so a long run
+// does not produce a page too large to open.
+const maxVizSteps = 5000
+
+// vizStep is one evaluated form as the page replays it: the source span,
+// the result, how much output there was by then and the variables of
+// every scope from the innermost out.
+type vizStep struct {
+	Line    int          `json:"line"`
+	Col     int          `json:"col"`
+	EndLine int          `json:"endLine"`
+	EndCol  int          `json:"endCol"`
+	Depth   int          `json:"depth"`
+	Value   string       `json:"value,omitempty"`
+	Err     string       `json:"err,omitempty"`
+	Output  int          `json:"output"`
+	Frames  [][][]string `json:"frames"`
+}
+
+// visualizer records the steps of a run through the interpreter Hook.
+type visualizer struct {
+	steps     []vizStep
+	output    bytes.Buffer
+	truncated bool
+}
+
+func (v *visualizer) record(s *EvalStep) {
+	if len(v.steps) >= maxVizSteps {
+		v.truncated = true
+		return
+	}
+	st := vizStep{
+		Line: s.Node.Line, Col: s.Node.Col, EndLine: s.Node.EndLine, EndCol: s.Node.EndCol,
+		Depth: s.Depth, Output: v.output.Len(),
+	}
+	if s.Err != nil {
+		st.Err = s.Err.Error()
+	} else {
+		st.Value = describe(s.Value)
+	}
+	for e := s.Env; e != nil; e = e.parent {
+		names := make([]string, 0, len(e.vals))
+		for name := range e.vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		frame := [][]string{}
+		for _, name := range names {
+			frame = append(frame, []string{name, describe(e.vals[name])})
+		}
+		st.Frames = append(st.Frames, frame)
+	}
+	v.steps = append(v.steps, st)
+}
+
+// write saves the page replaying the run of source to path.
+func (v *visualizer) write(path, title, source string) error {
+	data, err := json.Marshal(map[string]any{
+		"source":    source,
+		"steps":     v.steps,
+		"output":    v.output.String(),
+		"truncated": v.truncated,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := vizPage.Execute(f, map[string]any{"Title": title, "Data": template.JS(data)}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var vizPage = template.Must(template.New("viz").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+#main { display: flex; gap: 2em; }
+pre { background: #f4f4f4; padding: .5em; min-width: 30em; }
+mark { background: #ffe066; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; text-align: left; font-family: monospace; }
+.err { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div>
+<button id="first">&laquo;</button>
+<button id="prev">&lsaquo; Back</button>
+<input id="slider" type="range" min="0" value="0">
+<button id="next">Forward &rsaquo;</button>
+<button id="last">&raquo;</button>
+<span id="pos"></span>
+</div>
+<p id="note"></p>
+<div id="main">
+<div><h3>Program</h3><pre id="source"></pre><h3>Output</h3><pre id="output"></pre></div>
+<div><h3>Result</h3><pre id="result"></pre><h3>Scopes</h3><div id="frames"></div></div>
+</div>
+<script>
+const data = {{.Data}};
+const lines = data.source.split("\n").map(l => Array.from(l));
+const slider = document.getElementById("slider");
+let cur = 0;
+
+function esc(s) {
+  return s.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+}
+
+function source(st) {
+  let out = "";
+  lines.forEach((chars, i) => {
+    const ln = i + 1;
+    chars.forEach((ch, j) => {
+      const col = j + 1;
+      if (ln == st.line && col == st.col) out += "<mark>";
+      out += esc(ch);
+      if (ln == st.endLine && col == st.endCol - 1) out += "</mark>";
+    });
+    out += "\n";
+  });
+  return out;
+}
+
+function show(i) {
+  cur = Math.max(0, Math.min(i, data.steps.length - 1));
+  const st = data.steps[cur];
+  slider.value = cur;
+  document.getElementById("pos").textContent = "step " + (cur + 1) + " of " + data.steps.length;
+  document.getElementById("source").innerHTML = source(st);
+  document.getElementById("output").textContent = data.output.slice(0, st.output);
+  const result = document.getElementById("result");
+  result.className = st.err ? "err" : "";
+  result.textContent = "line " + st.line + ": " + (st.err ? "Error " + st.err : st.value);
+  let frames = "";
+  st.frames.forEach((f, n) => {
+    const name = n == st.frames.length - 1 ? "global" : n == 0 ? "current" : "enclosing";
+    frames += "<table><tr><th colspan=2>" + name + "</th></tr>";
+    f.forEach(([k, v]) => { frames += "<tr><td>" + esc(k) + "</td><td>" + esc(v) + "</td></tr>"; });
+    frames += "</table>";
+  });
+  document.getElementById("frames").innerHTML = frames;
+}
+
+if (data.steps.length == 0) {
+  document.getElementById("note").textContent = "The program evaluated no forms.";
+} else {
+  slider.max = data.steps.length - 1;
+  if (data.truncated) {
+    document.getElementById("note").textContent = "Only the first " + data.steps.length + " steps were recorded.";
+  }
+  slider.oninput = () => show(+slider.value);
+  document.getElementById("first").onclick = () => show(0);
+  document.getElementById("prev").onclick = () => show(cur - 1);
+  document.getElementById("next").onclick = () => show(cur + 1);
+  document.getElementById("last").onclick = () => show(data.steps.length - 1);
+  document.onkeydown = e => {
+    if (e.key == "ArrowLeft") show(cur - 1);
+    if (e.key == "ArrowRight") show(cur + 1);
+  };
+  show(0);
+}
+</script>
+</body>
+</html>
+`))
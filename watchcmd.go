@@ -0,0 +1,114 @@
+//go:build !(js && wasm)
+
+package piku
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// programFiles returns file and every file it imports, directly or
+// through other imports. Files that cannot be parsed are still listed, so
+// that fixing them triggers a run.
+func programFiles(file string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+	var add func(string)
+	add = func(f string) {
+		if seen[f] {
+			return
+		}
+		seen[f] = true
+		files = append(files, f)
+		nodes, err := LoadFile(f)
+		if err != nil {
+			return
+		}
+		var visit func(n *Node)
+		visit = func(n *Node) {
+			// A URL import is fetched from its server, so there is no
+			// file of the program's own to watch.
+			if isForm(n, "import") && len(n.Children) == 2 && !isURL(n.Children[1].Value) {
+				add(importPath(n.Children[1].Value, filepath.Dir(f)))
+			}
+			for _, c := range n.Children {
+				visit(c)
+			}
+		}
+		for _, n := range nodes {
+			visit(n)
+		}
+	}
+	add(file)
+	return files
+}
+
+// fileStates records the state of each of files. A missing file has the
+// zero state.
+func fileStates(files []string) map[string]fileState {
+	states := map[string]fileState{}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			states[f] = fileState{info.ModTime(), info.Size()}
+		} else {
+			states[f] = fileState{}
+		}
+	}
+	return states
+}
+
+func sameStates(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, st := range a {
+		if b[f] != st {
+			return false
+		}
+	}
+	return true
+}
+
+// runWatched runs file once in a fresh environment, reporting rather than
+// returning whatever stopped it.
+func runWatched(file string) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("Error internal error:", r)
+		}
+	}()
+	_, err := runfile(file, newEnv(&Interpreter{}))
+	var exit *exitError
+	switch {
+	case errors.As(err, &exit):
+		fmt.Printf("exited with status %d\n", exit.code)
+	case err != nil:
+		fmt.Printf("Error %v%s\n", err, traceback(err))
+	}
+}
+
+// watchCmd implements "piku watch file.pi": it runs the program, then runs
+// it again every time it or a file it imports changes.
+func watchCmd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: piku watch file.pi")
+	}
+	file := args[0]
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	for {
+		files := programFiles(file)
+		states := fileStates(files)
+		fmt.Printf("--- %s %s ---\n", file, time.Now().Format("15:04:05"))
+		start := time.Now()
+		runWatched(file)
+		fmt.Printf("--- done in %v ---\n", time.Since(start).Round(time.Millisecond))
+		for sameStates(states, fileStates(files)) {
+			time.Sleep(watchInterval)
+		}
+	}
+}